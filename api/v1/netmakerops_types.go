@@ -17,29 +17,120 @@ limitations under the License.
 package v1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
-// EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
-// NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
-
 // NetmakerOpsSpec defines the desired state of NetmakerOps
 type NetmakerOpsSpec struct {
-	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
-	// Important: Run "make" to regenerate code after modifying this file
+	// NodeNetclient runs netclient on the cluster nodes instead of in every pod.
+	// Pods labeled netmaker.io/netclient: node reach the Netmaker network through their node.
+	// +optional
+	NodeNetclient *NodeNetclientSpec `json:"nodeNetclient,omitempty"`
+
+	// ClusterEgress registers cluster nodes as Netmaker egress gateways for the pod and service CIDRs,
+	// so Netmaker peers can reach pods and ClusterIPs directly. It needs nodeNetclient to enroll the nodes.
+	// +optional
+	ClusterEgress *ClusterEgressSpec `json:"clusterEgress,omitempty"`
+}
+
+// NodeNetclientSpec configures the node-level netclient DaemonSet
+type NodeNetclientSpec struct {
+	// Enabled deploys the netclient DaemonSet
+	Enabled bool `json:"enabled"`
+
+	// Network is the Netmaker network the nodes join. Defaults to NETCLIENT_NETWORK on the operator.
+	// +optional
+	Network string `json:"network,omitempty"`
+
+	// Server is the Netmaker server. Defaults to NETCLIENT_SERVER on the operator.
+	// +optional
+	Server string `json:"server,omitempty"`
+
+	// Image is the netclient image. Defaults to NETCLIENT_IMAGE on the operator.
+	// +optional
+	Image string `json:"image,omitempty"`
+
+	// TokenSecretRef selects the enrollment token in a Secret in the namespace of this NetmakerOps.
+	// Defaults to NETCLIENT_SECRET_NAME and NETCLIENT_SECRET_KEY on the operator.
+	// +optional
+	TokenSecretRef *corev1.SecretKeySelector `json:"tokenSecretRef,omitempty"`
+
+	// NodeSelector limits the nodes that join the network. Routed pods on other nodes can't reach it.
+	// +optional
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+
+	// Tolerations of the netclient pods
+	// +optional
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+}
+
+// ClusterEgressSpec configures the Netmaker egress gateways advertising the cluster's ranges
+type ClusterEgressSpec struct {
+	// Enabled registers the gateways; disabling it removes the egress resources from Netmaker
+	Enabled bool `json:"enabled"`
+
+	// NodeSelector selects the gateway nodes. They must also run the node-level netclient.
+	// +kubebuilder:validation:MinProperties=1
+	NodeSelector map[string]string `json:"nodeSelector"`
 
-	// Foo is an example field of NetmakerOps. Edit netmakerops_types.go to remove/update
-	Foo string `json:"foo,omitempty"`
+	// PodCIDRs are advertised as egress ranges. Defaults to the podCIDRs of the cluster nodes.
+	// +optional
+	PodCIDRs []string `json:"podCIDRs,omitempty"`
+
+	// ServiceCIDRs are advertised as egress ranges. The service range can't be read from the API,
+	// so ClusterIPs are only reachable when it is set.
+	// +optional
+	ServiceCIDRs []string `json:"serviceCIDRs,omitempty"`
 }
 
 // NetmakerOpsStatus defines the observed state of NetmakerOps
 type NetmakerOpsStatus struct {
-	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
-	// Important: Run "make" to regenerate code after modifying this file
+	// NodeNetclient reports the node-level netclient DaemonSet
+	// +optional
+	NodeNetclient *NodeNetclientStatus `json:"nodeNetclient,omitempty"`
+
+	// ClusterEgress reports the egress gateways registered with Netmaker
+	// +optional
+	ClusterEgress *ClusterEgressStatus `json:"clusterEgress,omitempty"`
+
+	// Conditions describe the state of the features this NetmakerOps manages
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// NodeNetclientStatus reports the node-level netclient DaemonSet
+type NodeNetclientStatus struct {
+	// DesiredNodes is the number of nodes that should run netclient
+	DesiredNodes int32 `json:"desiredNodes"`
+	// ReadyNodes is the number of nodes whose netclient pod is ready
+	ReadyNodes int32 `json:"readyNodes"`
+	// RoutedPods is the number of running pods routed through their node
+	RoutedPods int32 `json:"routedPods"`
+}
+
+// ClusterEgressStatus reports the egress gateways registered with Netmaker
+type ClusterEgressStatus struct {
+	// Gateways are the gateway nodes in order of preference; the first one carries the traffic
+	// +optional
+	Gateways []string `json:"gateways,omitempty"`
+	// Network is the Netmaker network the egress resources are registered in
+	// +optional
+	Network string `json:"network,omitempty"`
+	// Ranges are the CIDRs advertised through the gateways
+	// +optional
+	Ranges []string `json:"ranges,omitempty"`
 }
 
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Desired",type=integer,JSONPath=`.status.nodeNetclient.desiredNodes`
+// +kubebuilder:printcolumn:name="Ready",type=integer,JSONPath=`.status.nodeNetclient.readyNodes`
+// +kubebuilder:printcolumn:name="Routed Pods",type=integer,JSONPath=`.status.nodeNetclient.routedPods`
+// +kubebuilder:printcolumn:name="Gateway",type=string,JSONPath=`.status.clusterEgress.gateways[0]`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // NetmakerOps is the Schema for the netmakerops API
 type NetmakerOps struct {
@@ -21,16 +21,75 @@ limitations under the License.
 package v1
 
 import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterEgressSpec) DeepCopyInto(out *ClusterEgressSpec) {
+	*out = *in
+	if in.NodeSelector != nil {
+		in, out := &in.NodeSelector, &out.NodeSelector
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.PodCIDRs != nil {
+		in, out := &in.PodCIDRs, &out.PodCIDRs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ServiceCIDRs != nil {
+		in, out := &in.ServiceCIDRs, &out.ServiceCIDRs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterEgressSpec.
+func (in *ClusterEgressSpec) DeepCopy() *ClusterEgressSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterEgressSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterEgressStatus) DeepCopyInto(out *ClusterEgressStatus) {
+	*out = *in
+	if in.Gateways != nil {
+		in, out := &in.Gateways, &out.Gateways
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Ranges != nil {
+		in, out := &in.Ranges, &out.Ranges
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterEgressStatus.
+func (in *ClusterEgressStatus) DeepCopy() *ClusterEgressStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterEgressStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *NetmakerOps) DeepCopyInto(out *NetmakerOps) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
-	out.Status = in.Status
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetmakerOps.
@@ -86,6 +145,16 @@ func (in *NetmakerOpsList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *NetmakerOpsSpec) DeepCopyInto(out *NetmakerOpsSpec) {
 	*out = *in
+	if in.NodeNetclient != nil {
+		in, out := &in.NodeNetclient, &out.NodeNetclient
+		*out = new(NodeNetclientSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ClusterEgress != nil {
+		in, out := &in.ClusterEgress, &out.ClusterEgress
+		*out = new(ClusterEgressSpec)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetmakerOpsSpec.
@@ -101,6 +170,23 @@ func (in *NetmakerOpsSpec) DeepCopy() *NetmakerOpsSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *NetmakerOpsStatus) DeepCopyInto(out *NetmakerOpsStatus) {
 	*out = *in
+	if in.NodeNetclient != nil {
+		in, out := &in.NodeNetclient, &out.NodeNetclient
+		*out = new(NodeNetclientStatus)
+		**out = **in
+	}
+	if in.ClusterEgress != nil {
+		in, out := &in.ClusterEgress, &out.ClusterEgress
+		*out = new(ClusterEgressStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetmakerOpsStatus.
@@ -112,3 +198,52 @@ func (in *NetmakerOpsStatus) DeepCopy() *NetmakerOpsStatus {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NodeNetclientSpec) DeepCopyInto(out *NodeNetclientSpec) {
+	*out = *in
+	if in.TokenSecretRef != nil {
+		in, out := &in.TokenSecretRef, &out.TokenSecretRef
+		*out = new(corev1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.NodeSelector != nil {
+		in, out := &in.NodeSelector, &out.NodeSelector
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Tolerations != nil {
+		in, out := &in.Tolerations, &out.Tolerations
+		*out = make([]corev1.Toleration, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NodeNetclientSpec.
+func (in *NodeNetclientSpec) DeepCopy() *NodeNetclientSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(NodeNetclientSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NodeNetclientStatus) DeepCopyInto(out *NodeNetclientStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NodeNetclientStatus.
+func (in *NodeNetclientStatus) DeepCopy() *NodeNetclientStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(NodeNetclientStatus)
+	in.DeepCopyInto(out)
+	return out
+}
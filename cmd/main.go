@@ -22,6 +22,7 @@ import (
 	"flag"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"sync"
 	"syscall"
 
@@ -34,21 +35,21 @@ import (
 
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/discovery"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	"sigs.k8s.io/controller-runtime/pkg/metrics/filters"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
-
-	// [WEBHOOK] Uncomment to enable webhook-based netclient sidecar injection
-	// "sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 
 	networkv1 "github.com/gravitl/netmaker-k8s-ops/api/v1"
 	"github.com/gravitl/netmaker-k8s-ops/internal/controller"
-	// [WEBHOOK] Uncomment to enable webhook-based netclient sidecar injection
-	// netmakerwebhook "github.com/gravitl/netmaker-k8s-ops/internal/webhook"
+	"github.com/gravitl/netmaker-k8s-ops/internal/netmakerapi"
+	netmakerwebhook "github.com/gravitl/netmaker-k8s-ops/internal/webhook"
 	// +kubebuilder:scaffold:imports
 )
 
@@ -70,6 +71,13 @@ func main() {
 	var probeAddr string
 	var secureMetrics bool
 	var enableHTTP2 bool
+	var enableSidecarWebhook bool
+	var enableAnnotationWebhook bool
+	var webhookSelfManagedCerts bool
+	var webhookCertDir string
+	var webhookServiceName string
+	var webhookConfigName string
+	var validatingWebhookConfigName string
 	var tlsOpts []func(*tls.Config)
 	flag.StringVar(&metricsAddr, "metrics-bind-address", "0", "The address the metrics endpoint binds to. "+
 		"Use :8443 for HTTPS or :8080 for HTTP, or leave as 0 to disable the metrics service.")
@@ -83,6 +91,23 @@ func main() {
 		"If set, the metrics endpoint is served securely via HTTPS. Use --metrics-secure=false to use HTTP instead.")
 	flag.BoolVar(&enableHTTP2, "enable-http2", false,
 		"If set, HTTP/2 will be enabled for the metrics and webhook servers")
+	flag.BoolVar(&enableSidecarWebhook, "enable-sidecar-webhook", os.Getenv("ENABLE_SIDECAR_WEBHOOK") == "true",
+		"If set, the netclient sidecar injection webhook is registered with the webhook server.")
+	flag.BoolVar(&enableAnnotationWebhook, "enable-annotation-webhook", os.Getenv("ENABLE_ANNOTATION_WEBHOOK") == "true",
+		"If set, the webhook server runs the netmaker.io annotation validating webhook even without sidecar injection. "+
+			"It is always registered with the sidecar webhook.")
+	flag.BoolVar(&webhookSelfManagedCerts, "webhook-self-managed-certs", os.Getenv("WEBHOOK_SELF_MANAGED_CERTS") == "true",
+		"If set, the operator generates and rotates the webhook serving certificate and patches the "+
+			"MutatingWebhookConfiguration caBundle itself, so cert-manager is not required.")
+	flag.StringVar(&webhookCertDir, "webhook-cert-dir", "",
+		"The directory the webhook server reads tls.crt and tls.key from. "+
+			"Defaults to <tmp>/k8s-webhook-server/serving-certs.")
+	flag.StringVar(&webhookServiceName, "webhook-service-name", "netmaker-k8s-ops-webhook-service",
+		"The name of the webhook Service, used as the self-managed certificate hostname.")
+	flag.StringVar(&webhookConfigName, "webhook-config-name", "netmaker-k8s-ops-webhook",
+		"The name of the MutatingWebhookConfiguration whose caBundle is patched with self-managed certificates.")
+	flag.StringVar(&validatingWebhookConfigName, "validating-webhook-config-name", "netmaker-k8s-ops-validating-webhook",
+		"The name of the ValidatingWebhookConfiguration whose caBundle is patched with self-managed certificates.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -139,6 +164,7 @@ func main() {
 
 	webhookServer := webhook.NewServer(webhook.Options{
 		TLSOpts: tlsOpts,
+		CertDir: webhookCertDir,
 	})
 
 	// Metrics endpoint is enabled in 'config/default/kustomization.yaml'. The Metrics options configure the server.
@@ -189,9 +215,14 @@ func main() {
 		os.Exit(1)
 	}
 
+	// The Netmaker API client is nil when API_SERVER_DOMAIN or API_TOKEN is missing
+	netmakerClient := netmakerapi.NewClientFromEnv()
+
 	if err = (&controller.NetmakerOpsReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("netmakerops"),
+		Netmaker: netmakerClient,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "NetmakerOps")
 		os.Exit(1)
@@ -217,9 +248,68 @@ func main() {
 	}
 	setupLog.Info("registered ingress proxy controller for Services")
 
-	// [WEBHOOK] Register the netclient sidecar webhook for all supported resource types
-	// Uncomment the following section to enable webhook-based netclient sidecar injection
-	/*
+	// Assign netmaker.io/static-ip addresses through the Netmaker API once pods have enrolled
+	if netmakerClient != nil {
+		if err = (&controller.StaticIPReconciler{
+			Client:   mgr.GetClient(),
+			Scheme:   mgr.GetScheme(),
+			Recorder: mgr.GetEventRecorderFor("static-ip"),
+			Netmaker: netmakerClient,
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "StaticIP")
+			os.Exit(1)
+		}
+		setupLog.Info("registered static IP controller")
+	} else {
+		setupLog.Info("API_SERVER_DOMAIN or API_TOKEN not set, netmaker.io/static-ip annotations are ignored")
+	}
+
+	// The webhook server runs for sidecar injection and for annotation validation
+	if enableSidecarWebhook || enableAnnotationWebhook {
+		if webhookSelfManagedCerts {
+			// The manager's client is cache-backed and not usable before the manager starts,
+			// so the initial certificates are created with a direct client
+			directClient, err := client.New(mgr.GetConfig(), client.Options{Scheme: mgr.GetScheme()})
+			if err != nil {
+				setupLog.Error(err, "unable to create client for webhook certificates")
+				os.Exit(1)
+			}
+			certDir := webhookCertDir
+			if certDir == "" {
+				certDir = filepath.Join(os.TempDir(), "k8s-webhook-server", "serving-certs")
+			}
+			certManager := &netmakerwebhook.CertManager{
+				Client:                      directClient,
+				CertDir:                     certDir,
+				SecretName:                  webhookServiceName + "-cert",
+				Namespace:                   getOperatorNamespace(),
+				ServiceName:                 webhookServiceName,
+				WebhookConfigName:           webhookConfigName,
+				ValidatingWebhookConfigName: validatingWebhookConfigName,
+			}
+			if err := certManager.EnsureCerts(context.Background()); err != nil {
+				setupLog.Error(err, "unable to set up webhook certificates")
+				os.Exit(1)
+			}
+			if err := mgr.Add(certManager); err != nil {
+				setupLog.Error(err, "unable to add webhook certificate rotation")
+				os.Exit(1)
+			}
+			setupLog.Info("using self-managed webhook certificates", "dir", certDir, "namespace", certManager.Namespace)
+		}
+
+		// Reject typos and conflicting netmaker.io annotations on Services and workloads at admission time
+		// Only the operator may record the Netmaker host of a pod
+		annotationValidator := netmakerwebhook.NewNetmakerAnnotationValidator(admission.NewDecoder(scheme))
+		annotationValidator.SetOperatorUser(getOperatorUser())
+		mgr.GetWebhookServer().Register("/validate-netmaker-annotations", &admission.Webhook{
+			Handler: annotationValidator,
+		})
+		setupLog.Info("registered netmaker.io annotation validating webhook")
+	}
+
+	// Register the netclient sidecar webhook for all supported resource types
+	if enableSidecarWebhook {
 		netclientWebhook := netmakerwebhook.NewNetclientSidecarWebhook()
 
 		// Inject dependencies
@@ -228,6 +318,29 @@ func main() {
 			os.Exit(1)
 		}
 
+		// Inject netclient as a native sidecar when the API server supports it
+		discoveryClient, err := discovery.NewDiscoveryClientForConfig(mgr.GetConfig())
+		if err != nil {
+			setupLog.Error(err, "unable to create discovery client for webhook")
+			os.Exit(1)
+		}
+		serverVersion, err := discoveryClient.ServerVersion()
+		if err != nil {
+			setupLog.Error(err, "unable to get API server version, using regular netclient sidecars")
+		}
+		nativeSidecars := netmakerwebhook.NativeSidecarsSupported(serverVersion)
+		netclientWebhook.SetNativeSidecars(nativeSidecars)
+		setupLog.Info("configured netclient sidecar injection", "nativeSidecars", nativeSidecars)
+		netclientWebhook.SetEventRecorder(mgr.GetEventRecorderFor("netclient-webhook"))
+
+		// Inject into the pod templates of other kinds, such as Argo Rollouts, listed in NETCLIENT_POD_TEMPLATE_KINDS
+		podTemplateKinds, err := netmakerwebhook.PodTemplateKindsFromEnv()
+		if err != nil {
+			setupLog.Error(err, "invalid pod template kinds")
+			os.Exit(1)
+		}
+		netclientWebhook.SetPodTemplateKinds(podTemplateKinds)
+
 		// Create decoder
 		decoder := admission.NewDecoder(scheme)
 
@@ -242,9 +355,48 @@ func main() {
 		mgr.GetWebhookServer().Register("/mutate-statefulsets", &admission.Webhook{Handler: netclientWebhook})
 		mgr.GetWebhookServer().Register("/mutate-daemonsets", &admission.Webhook{Handler: netclientWebhook})
 		mgr.GetWebhookServer().Register("/mutate-jobs", &admission.Webhook{Handler: netclientWebhook})
+		mgr.GetWebhookServer().Register("/mutate-cronjobs", &admission.Webhook{Handler: netclientWebhook})
 		mgr.GetWebhookServer().Register("/mutate-replicasets", &admission.Webhook{Handler: netclientWebhook})
+		mgr.GetWebhookServer().Register("/mutate-pod-templates", &admission.Webhook{Handler: netclientWebhook})
 		setupLog.Info("registered netclient sidecar webhook for all resource types")
-	*/
+
+		// Create the PVCs and token secrets injected sidecars reference, outside the admission path
+		if err = (&controller.NetclientSidecarReconciler{
+			Client:   mgr.GetClient(),
+			Scheme:   mgr.GetScheme(),
+			Recorder: mgr.GetEventRecorderFor("netclient-sidecar"),
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "NetclientSidecar")
+			os.Exit(1)
+		}
+		setupLog.Info("registered netclient sidecar controller for injected pods")
+
+		// Delete claims and deregister hosts of pods whose workload dropped the sidecar
+		if err = (&controller.NetclientCleanupReconciler{
+			Client:            mgr.GetClient(),
+			Scheme:            mgr.GetScheme(),
+			Recorder:          mgr.GetEventRecorderFor("netclient-cleanup"),
+			APIReader:         mgr.GetAPIReader(),
+			Netmaker:          netmakerClient,
+			PodTemplateOwners: netmakerwebhook.PodTemplateOwners(podTemplateKinds),
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "NetclientCleanup")
+			os.Exit(1)
+		}
+		setupLog.Info("registered netclient cleanup controller for injected pods")
+
+		// Report the Netmaker connection of sidecars that serve their status (NETCLIENT_STATUS_PORT)
+		if err = (&controller.NetclientHealthReconciler{
+			Client: mgr.GetClient(),
+			Scheme: mgr.GetScheme(),
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "NetclientHealth")
+			os.Exit(1)
+		}
+		setupLog.Info("registered netclient health controller for injected pods")
+	} else {
+		setupLog.Info("Sidecar webhook not enabled, skipping webhook registration")
+	}
 
 	// +kubebuilder:scaffold:builder
 
@@ -293,3 +445,23 @@ func main() {
 	setupLog.Info("netmaker k8s operator...")
 
 }
+
+// getOperatorNamespace returns the namespace the operator runs in
+func getOperatorNamespace() string {
+	if namespace := os.Getenv("OPERATOR_NAMESPACE"); namespace != "" {
+		return namespace
+	}
+	if namespace, err := os.ReadFile("/var/run/secrets/kubernetes.io/serviceaccount/namespace"); err == nil {
+		return string(namespace)
+	}
+	return "netmaker-k8s-ops-system"
+}
+
+// getOperatorUser returns the user name of the operator's service account, set in OPERATOR_SERVICE_ACCOUNT
+func getOperatorUser() string {
+	serviceAccount := os.Getenv("OPERATOR_SERVICE_ACCOUNT")
+	if serviceAccount == "" {
+		serviceAccount = "netmaker-k8s-ops-controller-manager"
+	}
+	return "system:serviceaccount:" + getOperatorNamespace() + ":" + serviceAccount
+}
@@ -0,0 +1,460 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	networkv1 "github.com/gravitl/netmaker-k8s-ops/api/v1"
+	"github.com/gravitl/netmaker-k8s-ops/internal/netmakerapi"
+)
+
+const (
+	// clusterEgressFinalizer removes the egress resources from Netmaker before the NetmakerOps goes away
+	clusterEgressFinalizer = "netmaker.io/cluster-egress"
+
+	// conditionClusterEgressReady reports whether the cluster ranges are routed through a gateway node
+	conditionClusterEgressReady = "ClusterEgressReady"
+
+	// clusterEgressResync picks up gateway nodes that enrolled since the last reconcile
+	clusterEgressResync = time.Minute
+	// clusterEgressMetricStep separates the route metrics of the gateways; peers prefer the lowest
+	clusterEgressMetricStep = 100
+
+	eventReasonClusterEgressFailover = "ClusterEgressFailover"
+)
+
+// clusterEgressEnabled checks if a NetmakerOps registers the cluster egress gateways
+func clusterEgressEnabled(ops *networkv1.NetmakerOps) bool {
+	return ops.Spec.ClusterEgress != nil && ops.Spec.ClusterEgress.Enabled
+}
+
+// clusterEgressDescription marks the egress resources managed for a NetmakerOps
+func clusterEgressDescription(ops *networkv1.NetmakerOps) string {
+	return fmt.Sprintf("managed by netmaker-k8s-ops for NetmakerOps %s/%s", ops.Namespace, ops.Name)
+}
+
+// clusterEgressName returns the Netmaker name of the egress resource for a range
+func clusterEgressName(ops *networkv1.NetmakerOps, cidr string) string {
+	return fmt.Sprintf("k8s-%s-%s", ops.Name, strings.NewReplacer(".", "-", "/", "-", ":", "-").Replace(cidr))
+}
+
+// ensureClusterEgressFinalizer adds the finalizer while cluster egress is enabled, and removes it together with
+// the egress resources once it is disabled
+func (r *NetmakerOpsReconciler) ensureClusterEgressFinalizer(ctx context.Context, ops *networkv1.NetmakerOps) error {
+	if clusterEgressEnabled(ops) {
+		if controllerutil.AddFinalizer(ops, clusterEgressFinalizer) {
+			return r.Update(ctx, ops)
+		}
+		return nil
+	}
+	if !controllerutil.ContainsFinalizer(ops, clusterEgressFinalizer) {
+		return nil
+	}
+	if err := r.deleteClusterEgress(ctx, ops); err != nil {
+		return err
+	}
+	controllerutil.RemoveFinalizer(ops, clusterEgressFinalizer)
+	return r.Update(ctx, ops)
+}
+
+// finalizeClusterEgress removes the egress resources of a deleted NetmakerOps
+func (r *NetmakerOpsReconciler) finalizeClusterEgress(ctx context.Context, ops *networkv1.NetmakerOps) error {
+	if !controllerutil.ContainsFinalizer(ops, clusterEgressFinalizer) {
+		return nil
+	}
+	if err := r.deleteClusterEgress(ctx, ops); err != nil {
+		return err
+	}
+	controllerutil.RemoveFinalizer(ops, clusterEgressFinalizer)
+	return r.Update(ctx, ops)
+}
+
+// reconcileClusterEgress registers the gateway nodes as Netmaker egress gateways for the cluster ranges
+// Every ready gateway is listed on each range with its own metric, so peers fail over to the next gateway
+// on their own; gateways whose Kubernetes node, netclient pod or Netmaker node is down are taken off the list
+func (r *NetmakerOpsReconciler) reconcileClusterEgress(ctx context.Context, ops *networkv1.NetmakerOps) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	if !clusterEgressEnabled(ops) {
+		ops.Status.ClusterEgress = nil
+		meta.RemoveStatusCondition(&ops.Status.Conditions, conditionClusterEgressReady)
+		return ctrl.Result{}, nil
+	}
+	if r.Netmaker == nil {
+		r.setClusterEgressCondition(ops, metav1.ConditionFalse, "APINotConfigured",
+			"set API_SERVER_DOMAIN and API_TOKEN on the operator to register egress gateways")
+		return ctrl.Result{}, nil
+	}
+	if ops.Spec.NodeNetclient == nil || !ops.Spec.NodeNetclient.Enabled {
+		// The gateway nodes leave the network with the DaemonSet, so nothing is left to route through
+		if err := r.removeClusterEgress(ctx, ops); err != nil {
+			return ctrl.Result{}, err
+		}
+		r.setClusterEgressCondition(ops, metav1.ConditionFalse, "NodeNetclientDisabled",
+			"cluster egress needs nodeNetclient to enroll the gateway nodes")
+		return ctrl.Result{}, nil
+	}
+	if meta.IsStatusConditionPresentAndEqual(ops.Status.Conditions, conditionNodeNetclientReady, metav1.ConditionFalse) &&
+		meta.FindStatusCondition(ops.Status.Conditions, conditionNodeNetclientReady).Reason == "Conflict" {
+		r.setClusterEgressCondition(ops, metav1.ConditionFalse, "Conflict",
+			"node-level netclient is managed by another NetmakerOps")
+		return ctrl.Result{}, nil
+	}
+	network := nodeNetclientNetwork(ops.Spec.NodeNetclient)
+	if network == "" {
+		if err := r.removeClusterEgress(ctx, ops); err != nil {
+			return ctrl.Result{}, err
+		}
+		r.setClusterEgressCondition(ops, metav1.ConditionFalse, "NetworkUnknown",
+			"set nodeNetclient.network or NETCLIENT_NETWORK on the operator")
+		return ctrl.Result{}, nil
+	}
+	if previous := ops.Status.ClusterEgress; previous != nil && previous.Network != "" && previous.Network != network {
+		// The gateways joined the new network; the ranges are registered there below
+		logger.Info("Moving cluster egress to another network", "netmakerops", client.ObjectKeyFromObject(ops),
+			"from", previous.Network, "to", network)
+		if err := r.deleteClusterEgressIn(ctx, ops, previous.Network); err != nil {
+			return ctrl.Result{}, err
+		}
+		ops.Status.ClusterEgress = nil
+	}
+
+	ranges, err := r.clusterEgressRanges(ctx, ops.Spec.ClusterEgress)
+	if err != nil {
+		r.setClusterEgressCondition(ops, metav1.ConditionFalse, "InvalidRange", err.Error())
+		return ctrl.Result{}, nil
+	}
+	if len(ranges) == 0 {
+		r.setClusterEgressCondition(ops, metav1.ConditionFalse, "NoRanges",
+			"no podCIDRs found on the nodes; set podCIDRs or serviceCIDRs")
+		return ctrl.Result{}, nil
+	}
+
+	gateways, gatewayNodeIDs, err := r.readyClusterEgressGateways(ctx, ops, network)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if len(gateways) == 0 {
+		// Leave the egress resources as they are; there is nothing to fail over to
+		r.setClusterEgressCondition(ops, metav1.ConditionFalse, "NoReadyGateways",
+			"no node matching the gateway selector runs a connected netclient")
+		return ctrl.Result{RequeueAfter: clusterEgressResync}, nil
+	}
+
+	nodes := make(map[string]int, len(gatewayNodeIDs))
+	for i, nodeID := range gatewayNodeIDs {
+		nodes[nodeID] = (i + 1) * clusterEgressMetricStep
+	}
+	if err := r.syncClusterEgress(ctx, ops, network, ranges, nodes); err != nil {
+		logger.Error(err, "Failed to register cluster egress gateways", "netmakerops", client.ObjectKeyFromObject(ops))
+		// Some ranges may be registered already, record where so they can be removed
+		if ops.Status.ClusterEgress == nil {
+			ops.Status.ClusterEgress = &networkv1.ClusterEgressStatus{}
+		}
+		ops.Status.ClusterEgress.Network = network
+		r.setClusterEgressCondition(ops, metav1.ConditionFalse, "APIError", err.Error())
+		return ctrl.Result{RequeueAfter: clusterEgressResync}, nil
+	}
+
+	if previous := ops.Status.ClusterEgress; previous != nil && len(previous.Gateways) > 0 && previous.Gateways[0] != gateways[0] {
+		r.Recorder.Eventf(ops, corev1.EventTypeWarning, eventReasonClusterEgressFailover,
+			"Cluster egress moved from gateway %s to %s", previous.Gateways[0], gateways[0])
+	}
+	ops.Status.ClusterEgress = &networkv1.ClusterEgressStatus{Gateways: gateways, Network: network, Ranges: ranges}
+	r.setClusterEgressCondition(ops, metav1.ConditionTrue, "Ready",
+		fmt.Sprintf("%d ranges routed through %s (%d gateways)", len(ranges), gateways[0], len(gateways)))
+	return ctrl.Result{RequeueAfter: clusterEgressResync}, nil
+}
+
+// setClusterEgressCondition sets the ClusterEgressReady condition
+func (r *NetmakerOpsReconciler) setClusterEgressCondition(ops *networkv1.NetmakerOps, status metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(&ops.Status.Conditions, metav1.Condition{
+		Type:               conditionClusterEgressReady,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: ops.Generation,
+	})
+}
+
+// clusterEgressRanges returns the sorted IPv4 ranges to advertise; pod ranges default to the podCIDRs of the nodes
+func (r *NetmakerOpsReconciler) clusterEgressRanges(ctx context.Context, spec *networkv1.ClusterEgressSpec) ([]string, error) {
+	podCIDRs := spec.PodCIDRs
+	if len(podCIDRs) == 0 {
+		nodes := &corev1.NodeList{}
+		if err := r.List(ctx, nodes); err != nil {
+			return nil, err
+		}
+		for _, node := range nodes.Items {
+			podCIDRs = append(podCIDRs, node.Spec.PodCIDRs...)
+		}
+	}
+
+	seen := map[string]bool{}
+	var ranges []string
+	for _, cidr := range append(append([]string{}, podCIDRs...), spec.ServiceCIDRs...) {
+		ip, ipNet, err := net.ParseCIDR(strings.TrimSpace(cidr))
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a CIDR", cidr)
+		}
+		// Netmaker networks are routed over IPv4
+		if ip.To4() == nil {
+			continue
+		}
+		if !seen[ipNet.String()] {
+			seen[ipNet.String()] = true
+			ranges = append(ranges, ipNet.String())
+		}
+	}
+	sort.Strings(ranges)
+	return ranges, nil
+}
+
+// readyClusterEgressGateways returns the names and Netmaker node IDs of the usable gateways, sorted by node name
+// A gateway is usable when its Kubernetes node is Ready, its netclient pod is ready and its Netmaker node is connected
+func (r *NetmakerOpsReconciler) readyClusterEgressGateways(ctx context.Context, ops *networkv1.NetmakerOps, network string) ([]string, []string, error) {
+	nodes := &corev1.NodeList{}
+	if err := r.List(ctx, nodes, client.MatchingLabels(ops.Spec.ClusterEgress.NodeSelector)); err != nil {
+		return nil, nil, err
+	}
+	pods := &corev1.PodList{}
+	if err := r.List(ctx, pods, client.InNamespace(ops.Namespace), client.MatchingLabels(nodeNetclientLabels(ops))); err != nil {
+		return nil, nil, err
+	}
+	netclientReady := map[string]bool{}
+	for _, pod := range pods.Items {
+		if isPodReady(&pod) {
+			netclientReady[pod.Spec.NodeName] = true
+		}
+	}
+
+	var candidates []string
+	for _, node := range nodes.Items {
+		if node.DeletionTimestamp == nil && isNodeReady(&node) && netclientReady[node.Name] {
+			candidates = append(candidates, node.Name)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, nil, nil
+	}
+	sort.Strings(candidates)
+
+	// With host networking netclient registers the node's host name, which is the node name
+	hosts, err := r.Netmaker.ListHosts(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	hostIDs := map[string]string{}
+	for _, host := range hosts {
+		hostIDs[host.Name] = host.ID
+	}
+	netmakerNodes, err := r.Netmaker.ListNodes(ctx, network)
+	if err != nil {
+		return nil, nil, err
+	}
+	nodeIDs := map[string]string{}
+	for _, node := range netmakerNodes {
+		if node.Connected && !node.PendingDelete {
+			nodeIDs[node.HostID] = node.ID
+		}
+	}
+
+	var gateways, gatewayNodeIDs []string
+	for _, name := range candidates {
+		if nodeID := nodeIDs[hostIDs[name]]; hostIDs[name] != "" && nodeID != "" {
+			gateways = append(gateways, name)
+			gatewayNodeIDs = append(gatewayNodeIDs, nodeID)
+		}
+	}
+	return gateways, gatewayNodeIDs, nil
+}
+
+// syncClusterEgress creates, updates and deletes the egress resources of a NetmakerOps so there is one per range
+func (r *NetmakerOpsReconciler) syncClusterEgress(ctx context.Context, ops *networkv1.NetmakerOps, network string, ranges []string, nodes map[string]int) error {
+	logger := log.FromContext(ctx)
+	existing, err := r.Netmaker.ListEgress(ctx, network)
+	if err != nil {
+		return err
+	}
+
+	description := clusterEgressDescription(ops)
+	byRange := map[string]netmakerapi.Egress{}
+	for _, egress := range existing {
+		if egress.Description == description {
+			byRange[egress.Range] = egress
+		}
+	}
+
+	for _, cidr := range ranges {
+		desired := netmakerapi.Egress{
+			Name:        clusterEgressName(ops, cidr),
+			Network:     network,
+			Description: description,
+			Nodes:       nodes,
+			Range:       cidr,
+			Nat:         true,
+			Status:      true,
+		}
+		current, ok := byRange[cidr]
+		delete(byRange, cidr)
+		if !ok {
+			logger.Info("Creating cluster egress", "range", cidr, "network", network, "nodes", nodes)
+			if _, err := r.Netmaker.CreateEgress(ctx, &desired); err != nil {
+				return fmt.Errorf("failed to create egress for %s: %w", cidr, err)
+			}
+			continue
+		}
+		if current.Name == desired.Name && current.Nat && current.Status && equalMetrics(current.Nodes, nodes) {
+			continue
+		}
+		logger.Info("Updating cluster egress", "range", cidr, "network", network, "nodes", nodes)
+		desired.ID = current.ID
+		if err := r.Netmaker.UpdateEgress(ctx, &desired); err != nil {
+			return fmt.Errorf("failed to update egress for %s: %w", cidr, err)
+		}
+	}
+
+	// Ranges that are no longer advertised
+	for cidr, egress := range byRange {
+		logger.Info("Deleting cluster egress", "range", cidr, "network", network)
+		if err := r.Netmaker.DeleteEgress(ctx, egress.ID); err != nil {
+			return fmt.Errorf("failed to delete egress for %s: %w", cidr, err)
+		}
+	}
+	return nil
+}
+
+// removeClusterEgress deletes the egress resources of a NetmakerOps that can no longer route the cluster ranges
+func (r *NetmakerOpsReconciler) removeClusterEgress(ctx context.Context, ops *networkv1.NetmakerOps) error {
+	if err := r.deleteClusterEgress(ctx, ops); err != nil {
+		return err
+	}
+	ops.Status.ClusterEgress = nil
+	return nil
+}
+
+// deleteClusterEgress deletes the egress resources of a NetmakerOps from Netmaker
+// They are looked up in the network recorded in the status and in the one nodeNetclient joins now
+func (r *NetmakerOpsReconciler) deleteClusterEgress(ctx context.Context, ops *networkv1.NetmakerOps) error {
+	logger := log.FromContext(ctx)
+	var networks []string
+	if ops.Status.ClusterEgress != nil && ops.Status.ClusterEgress.Network != "" {
+		networks = append(networks, ops.Status.ClusterEgress.Network)
+	}
+	if ops.Spec.NodeNetclient != nil {
+		if network := nodeNetclientNetwork(ops.Spec.NodeNetclient); network != "" && (len(networks) == 0 || networks[0] != network) {
+			networks = append(networks, network)
+		}
+	}
+	if r.Netmaker == nil || len(networks) == 0 {
+		logger.Info("Can't remove cluster egress from Netmaker, the API or network is not configured", "netmakerops", client.ObjectKeyFromObject(ops))
+		return nil
+	}
+	for _, network := range networks {
+		if err := r.deleteClusterEgressIn(ctx, ops, network); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteClusterEgressIn deletes the egress resources of a NetmakerOps in one network
+func (r *NetmakerOpsReconciler) deleteClusterEgressIn(ctx context.Context, ops *networkv1.NetmakerOps, network string) error {
+	logger := log.FromContext(ctx)
+	existing, err := r.Netmaker.ListEgress(ctx, network)
+	if err != nil {
+		return err
+	}
+	description := clusterEgressDescription(ops)
+	for _, egress := range existing {
+		if egress.Description != description {
+			continue
+		}
+		logger.Info("Deleting cluster egress", "range", egress.Range, "network", network)
+		if err := r.Netmaker.DeleteEgress(ctx, egress.ID); err != nil {
+			return fmt.Errorf("failed to delete egress for %s: %w", egress.Range, err)
+		}
+	}
+	return nil
+}
+
+// equalMetrics checks if two egress node lists are the same
+func equalMetrics(a, b map[string]int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for nodeID, metric := range a {
+		if other, ok := b[nodeID]; !ok || other != metric {
+			return false
+		}
+	}
+	return true
+}
+
+// isNodeReady checks the Ready condition of a node
+func isNodeReady(node *corev1.Node) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == corev1.NodeReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// nodeReadinessChanged passes node events that can add or remove a gateway: creation, deletion,
+// label changes and Ready transitions, but not the periodic status heartbeats
+var nodeReadinessChanged = predicate.Funcs{
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		oldNode, ok := e.ObjectOld.(*corev1.Node)
+		newNode, ok2 := e.ObjectNew.(*corev1.Node)
+		if !ok || !ok2 {
+			return false
+		}
+		return isNodeReady(oldNode) != isNodeReady(newNode) ||
+			!equalLabels(oldNode.Labels, newNode.Labels) ||
+			strings.Join(oldNode.Spec.PodCIDRs, ",") != strings.Join(newNode.Spec.PodCIDRs, ",")
+	},
+}
+
+// equalLabels checks if two label sets are the same
+func equalLabels(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key, value := range a {
+		if other, ok := b[key]; !ok || other != value {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,203 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/gravitl/netmaker/models"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	networkv1 "github.com/gravitl/netmaker-k8s-ops/api/v1"
+	"github.com/gravitl/netmaker-k8s-ops/internal/netmakerapi"
+)
+
+var _ = Describe("Cluster egress", func() {
+	var (
+		egress map[string]netmakerapi.Egress
+		nextID int
+		r      *NetmakerOpsReconciler
+		ctx    = context.Background()
+	)
+
+	gatewayNode := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-a", Labels: map[string]string{"egress": "true"}},
+		Spec:       corev1.NodeSpec{PodCIDRs: []string{"10.244.0.0/24", "fd00:10:244::/64"}},
+		Status:     corev1.NodeStatus{Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionTrue}}},
+	}
+	newOps := func(network string) *networkv1.NetmakerOps {
+		return &networkv1.NetmakerOps{
+			ObjectMeta: metav1.ObjectMeta{Name: "ops", Namespace: "netmaker"},
+			Spec: networkv1.NetmakerOpsSpec{
+				NodeNetclient: &networkv1.NodeNetclientSpec{Enabled: true, Network: network},
+				ClusterEgress: &networkv1.ClusterEgressSpec{
+					Enabled:      true,
+					NodeSelector: map[string]string{"egress": "true"},
+					ServiceCIDRs: []string{"10.96.0.0/12"},
+				},
+			},
+		}
+	}
+	netclientPod := func(ops *networkv1.NetmakerOps) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "node-netclient-a", Namespace: ops.Namespace, Labels: nodeNetclientLabels(ops)},
+			Spec:       corev1.PodSpec{NodeName: "node-a"},
+			Status:     corev1.PodStatus{Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}},
+		}
+	}
+	inNetwork := func(network string) []netmakerapi.Egress {
+		var found []netmakerapi.Egress
+		for _, e := range egress {
+			if e.Network == network {
+				found = append(found, e)
+			}
+		}
+		return found
+	}
+
+	BeforeEach(func() {
+		egress, nextID = map[string]netmakerapi.Egress{}, 0
+		wrap := func(w http.ResponseWriter, response interface{}) {
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"Code": 200, "Message": "ok", "Response": response})
+		}
+		mux := http.NewServeMux()
+		mux.HandleFunc("GET /api/hosts", func(w http.ResponseWriter, _ *http.Request) {
+			_ = json.NewEncoder(w).Encode([]models.ApiHost{{ID: "host-a", Name: "node-a"}})
+		})
+		mux.HandleFunc("GET /api/nodes/{network}", func(w http.ResponseWriter, req *http.Request) {
+			network := req.PathValue("network")
+			_ = json.NewEncoder(w).Encode([]models.ApiNode{{ID: "node-a-" + network, HostID: "host-a", Network: network, Connected: true}})
+		})
+		mux.HandleFunc("GET /api/v1/egress", func(w http.ResponseWriter, req *http.Request) {
+			wrap(w, inNetwork(req.URL.Query().Get("network")))
+		})
+		mux.HandleFunc("POST /api/v1/egress", func(w http.ResponseWriter, req *http.Request) {
+			created := netmakerapi.Egress{}
+			Expect(json.NewDecoder(req.Body).Decode(&created)).To(Succeed())
+			nextID++
+			created.ID = fmt.Sprintf("egress-%d", nextID)
+			egress[created.ID] = created
+			wrap(w, created)
+		})
+		mux.HandleFunc("PUT /api/v1/egress", func(w http.ResponseWriter, req *http.Request) {
+			updated := netmakerapi.Egress{}
+			Expect(json.NewDecoder(req.Body).Decode(&updated)).To(Succeed())
+			Expect(egress).To(HaveKey(updated.ID))
+			egress[updated.ID] = updated
+			wrap(w, nil)
+		})
+		mux.HandleFunc("DELETE /api/v1/egress", func(w http.ResponseWriter, req *http.Request) {
+			delete(egress, req.URL.Query().Get("id"))
+			wrap(w, nil)
+		})
+		server := httptest.NewServer(mux)
+		DeferCleanup(server.Close)
+
+		ops := newOps("edge")
+		c := fake.NewClientBuilder().WithScheme(newOpsScheme()).WithObjects(gatewayNode, netclientPod(ops)).Build()
+		r = &NetmakerOpsReconciler{Client: c, Scheme: c.Scheme(), Recorder: record.NewFakeRecorder(10),
+			Netmaker: netmakerapi.NewClient(server.URL, "master-key", false)}
+	})
+
+	It("registers one egress per IPv4 range and records the network", func() {
+		ops := newOps("edge")
+		_, err := r.reconcileClusterEgress(ctx, ops)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(meta.IsStatusConditionTrue(ops.Status.Conditions, conditionClusterEgressReady)).To(BeTrue())
+		Expect(ops.Status.ClusterEgress).To(Equal(&networkv1.ClusterEgressStatus{
+			Gateways: []string{"node-a"},
+			Network:  "edge",
+			Ranges:   []string{"10.244.0.0/24", "10.96.0.0/12"},
+		}))
+		registered := inNetwork("edge")
+		Expect(registered).To(HaveLen(2))
+		for _, e := range registered {
+			Expect(e.Description).To(Equal(clusterEgressDescription(ops)))
+			Expect(e.Nodes).To(Equal(map[string]int{"node-a-edge": clusterEgressMetricStep}))
+		}
+	})
+
+	It("updates stale egress and deletes ranges that are no longer advertised", func() {
+		ops := newOps("edge")
+		egress["stale"] = netmakerapi.Egress{ID: "stale", Network: "edge", Description: clusterEgressDescription(ops),
+			Name: clusterEgressName(ops, "10.96.0.0/12"), Range: "10.96.0.0/12", Nodes: map[string]int{"gone": 100}, Nat: true, Status: true}
+		egress["old-range"] = netmakerapi.Egress{ID: "old-range", Network: "edge", Description: clusterEgressDescription(ops), Range: "10.0.0.0/8"}
+		egress["foreign"] = netmakerapi.Egress{ID: "foreign", Network: "edge", Description: "someone else", Range: "10.0.0.0/8"}
+
+		_, err := r.reconcileClusterEgress(ctx, ops)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(egress).NotTo(HaveKey("old-range"))
+		Expect(egress).To(HaveKey("foreign"))
+		Expect(egress["stale"].Nodes).To(Equal(map[string]int{"node-a-edge": clusterEgressMetricStep}))
+		Expect(inNetwork("edge")).To(HaveLen(3))
+	})
+
+	It("removes the egress when nodeNetclient is disabled", func() {
+		ops := newOps("edge")
+		_, err := r.reconcileClusterEgress(ctx, ops)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(egress).To(HaveLen(2))
+
+		ops.Spec.NodeNetclient.Enabled = false
+		_, err = r.reconcileClusterEgress(ctx, ops)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(egress).To(BeEmpty())
+		Expect(ops.Status.ClusterEgress).To(BeNil())
+		condition := meta.FindStatusCondition(ops.Status.Conditions, conditionClusterEgressReady)
+		Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+		Expect(condition.Reason).To(Equal("NodeNetclientDisabled"))
+	})
+
+	It("moves the egress when nodeNetclient joins another network", func() {
+		ops := newOps("edge")
+		_, err := r.reconcileClusterEgress(ctx, ops)
+		Expect(err).NotTo(HaveOccurred())
+
+		ops.Spec.NodeNetclient.Network = "core"
+		_, err = r.reconcileClusterEgress(ctx, ops)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(inNetwork("edge")).To(BeEmpty())
+		Expect(inNetwork("core")).To(HaveLen(2))
+		Expect(ops.Status.ClusterEgress.Network).To(Equal("core"))
+	})
+
+	It("deletes the egress from the recorded network on finalization", func() {
+		ops := newOps("edge")
+		_, err := r.reconcileClusterEgress(ctx, ops)
+		Expect(err).NotTo(HaveOccurred())
+
+		// The spec no longer names the network the egress was registered in
+		ops.Spec.NodeNetclient = nil
+		Expect(r.deleteClusterEgress(ctx, ops)).To(Succeed())
+		Expect(egress).To(BeEmpty())
+	})
+})
@@ -0,0 +1,741 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	// egressGatewayName is the name of the shared egress gateway StatefulSet and ConfigMap
+	egressGatewayName = "netmaker-egress-gateway"
+	// egressGatewayListenersKey is the ConfigMap key holding the combined listener config
+	egressGatewayListenersKey = "listeners"
+
+	// egressGatewayModeNamespace runs one shared gateway per namespace
+	egressGatewayModeNamespace = "namespace"
+	// egressGatewayModeCluster runs one shared gateway for the whole cluster in the operator namespace
+	egressGatewayModeCluster = "cluster"
+
+	// EgressGatewayConfigHashAnnotation rolls the gateway StatefulSet only when its pod template changed
+	EgressGatewayConfigHashAnnotation = "netmaker.io/egress-gateway-config-hash"
+)
+
+// egressGatewayListener is a single gateway port forwarding to a Netmaker target
+type egressGatewayListener struct {
+	// Key identifies the Service port as namespace/name/port
+	Key        string
+	ListenPort int32
+	TargetAddr string
+	TargetPort int32
+}
+
+// getEgressGatewayMode returns the shared egress gateway mode, or "" for one proxy pod per Service
+func getEgressGatewayMode() string {
+	switch mode := getEnvOrDefault("EGRESS_GATEWAY_MODE", ""); mode {
+	case egressGatewayModeNamespace, egressGatewayModeCluster:
+		return mode
+	default:
+		return ""
+	}
+}
+
+// getEgressGatewayNamespace returns the namespace that hosts the gateway serving a Service namespace
+func getEgressGatewayNamespace(serviceNamespace string) string {
+	if getEgressGatewayMode() == egressGatewayModeCluster {
+		return getEnvOrDefault("OPERATOR_NAMESPACE", "netmaker-k8s-ops-system")
+	}
+	return serviceNamespace
+}
+
+// egressGatewayPodLabels returns the labels of the shared egress gateway pods
+func egressGatewayPodLabels() map[string]string {
+	return map[string]string{
+		"app":        egressGatewayName,
+		"managed-by": "netmaker-k8s-ops",
+	}
+}
+
+// reconcileGatewayService handles a Service when the shared egress gateway mode is enabled
+func (r *EgressProxyReconciler) reconcileGatewayService(ctx context.Context, namespacedName types.NamespacedName, service *corev1.Service) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	// Remove any dedicated proxy pod left over from per-Service mode
+	if _, err := r.cleanupProxyPod(ctx, namespacedName); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	listeners, err := r.reconcileEgressGateway(ctx, namespacedName.Namespace)
+	if err != nil {
+		logger.Error(err, "Failed to reconcile egress gateway", "service", namespacedName)
+		return ctrl.Result{}, err
+	}
+
+	// Only Services served by the gateway get their endpoints managed
+	if service == nil || !hasEgressGatewayListener(service, listeners) {
+		if err := r.cleanupGatewayServiceEndpoints(ctx, namespacedName); err != nil {
+			logger.Error(err, "Failed to delete service endpoints for egress gateway", "service", namespacedName)
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, nil
+	}
+
+	if err := r.updateGatewayServiceEndpoints(ctx, service, listeners); err != nil {
+		logger.Error(err, "Failed to update service endpoints for egress gateway", "service", namespacedName)
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// reconcileEgressGateway rebuilds the listener config and gateway StatefulSet serving a Service namespace
+// Returns the listeners keyed by namespace/name/port
+func (r *EgressProxyReconciler) reconcileEgressGateway(ctx context.Context, serviceNamespace string) (map[string]egressGatewayListener, error) {
+	logger := log.FromContext(ctx)
+	gatewayNamespace := getEgressGatewayNamespace(serviceNamespace)
+
+	// Collect every egress Service served by this gateway
+	services := &corev1.ServiceList{}
+	listOpts := []client.ListOption{}
+	if getEgressGatewayMode() == egressGatewayModeNamespace {
+		listOpts = append(listOpts, client.InNamespace(serviceNamespace))
+	}
+	if err := r.List(ctx, services, listOpts...); err != nil {
+		return nil, fmt.Errorf("failed to list services for egress gateway: %w", err)
+	}
+
+	namespaces := map[string]*corev1.Namespace{}
+	desired := []egressGatewayListener{}
+	for i := range services.Items {
+		service := &services.Items[i]
+		namespace, ok := namespaces[service.Namespace]
+		if !ok {
+			namespace = getServiceNamespace(ctx, r.Client, service)
+			namespaces[service.Namespace] = namespace
+		}
+		if !isEgressEnabled(service, namespace) {
+			continue
+		}
+		targetIP, targetDNS := getEgressTarget(service)
+		targetAddr := targetIP
+		if targetDNS != "" {
+			targetAddr = targetDNS
+		}
+		if targetAddr == "" {
+			continue
+		}
+		for _, port := range service.Spec.Ports {
+			desired = append(desired, egressGatewayListener{
+				Key:        egressGatewayListenerKey(service, port),
+				TargetAddr: targetAddr,
+				TargetPort: egressTargetPort(port),
+			})
+		}
+	}
+
+	// Load the current config so existing Services keep their gateway ports
+	configMap := &corev1.ConfigMap{}
+	err := r.Get(ctx, types.NamespacedName{Name: egressGatewayName, Namespace: gatewayNamespace}, configMap)
+	createConfigMap := errors.IsNotFound(err)
+	if err != nil && !createConfigMap {
+		return nil, err
+	}
+
+	if len(desired) == 0 {
+		// Nothing left to serve, remove the gateway
+		return nil, r.cleanupEgressGateway(ctx, gatewayNamespace)
+	}
+
+	existing := parseEgressGatewayListeners(configMap.Data[egressGatewayListenersKey])
+	listeners, err := allocateEgressGatewayPorts(existing, desired, getEgressGatewayBasePort())
+	if err != nil {
+		return nil, err
+	}
+	config := renderEgressGatewayListeners(listeners)
+
+	if createConfigMap {
+		logger.Info("Creating egress gateway config", "namespace", gatewayNamespace, "listeners", len(listeners))
+		configMap = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      egressGatewayName,
+				Namespace: gatewayNamespace,
+				Labels:    egressGatewayPodLabels(),
+			},
+			Data: map[string]string{egressGatewayListenersKey: config},
+		}
+		if err := r.Create(ctx, configMap); err != nil {
+			return nil, fmt.Errorf("failed to create egress gateway config: %w", err)
+		}
+	} else if configMap.Data[egressGatewayListenersKey] != config {
+		logger.Info("Updating egress gateway config", "namespace", gatewayNamespace, "listeners", len(listeners))
+		configMap.Data = map[string]string{egressGatewayListenersKey: config}
+		if err := r.Update(ctx, configMap); err != nil {
+			return nil, fmt.Errorf("failed to update egress gateway config: %w", err)
+		}
+	}
+
+	if err := r.ensureEgressGatewayStatefulSet(ctx, gatewayNamespace); err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]egressGatewayListener, len(listeners))
+	for _, listener := range listeners {
+		result[listener.Key] = listener
+	}
+	return result, nil
+}
+
+// ensureEgressGatewayStatefulSet creates the shared egress gateway StatefulSet and keeps its replicas and pod template in sync
+// Listener changes are picked up by the running pods from the mounted ConfigMap, so they never roll the gateway
+func (r *EgressProxyReconciler) ensureEgressGatewayStatefulSet(ctx context.Context, namespace string) error {
+	logger := log.FromContext(ctx)
+
+	// Remove the Deployment run by earlier versions, its pods kept their netclient state in an EmptyDir
+	deployment := &appsv1.Deployment{}
+	if err := r.Get(ctx, types.NamespacedName{Name: egressGatewayName, Namespace: namespace}, deployment); err == nil {
+		logger.Info("Deleting egress gateway Deployment replaced by a StatefulSet", "namespace", namespace)
+		if err := r.Delete(ctx, deployment); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	} else if !errors.IsNotFound(err) {
+		return err
+	}
+
+	desired, err := r.buildEgressGatewayStatefulSet(ctx, namespace)
+	if err != nil {
+		return err
+	}
+
+	existing := &appsv1.StatefulSet{}
+	err = r.Get(ctx, types.NamespacedName{Name: egressGatewayName, Namespace: namespace}, existing)
+	if errors.IsNotFound(err) {
+		logger.Info("Creating egress gateway", "namespace", namespace, "replicas", *desired.Spec.Replicas)
+		if err := r.Create(ctx, desired); err != nil {
+			return fmt.Errorf("failed to create egress gateway: %w", err)
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// The API server defaults template fields, so the template is compared by the hash of the desired one
+	sameReplicas := existing.Spec.Replicas != nil && *existing.Spec.Replicas == *desired.Spec.Replicas
+	sameTemplate := existing.Spec.Template.Annotations[EgressGatewayConfigHashAnnotation] == desired.Spec.Template.Annotations[EgressGatewayConfigHashAnnotation]
+	if sameReplicas && sameTemplate {
+		return nil
+	}
+
+	logger.Info("Updating egress gateway", "namespace", namespace, "replicas", *desired.Spec.Replicas, "templateChanged", !sameTemplate)
+	existing.Spec.Replicas = desired.Spec.Replicas
+	existing.Spec.Template = desired.Spec.Template
+	if err := r.Update(ctx, existing); err != nil {
+		return fmt.Errorf("failed to update egress gateway: %w", err)
+	}
+	return nil
+}
+
+// buildEgressGatewayStatefulSet builds the shared egress gateway StatefulSet specification
+// Each replica keeps its netclient state in its own claim, so a restarted pod rejoins as the same Netmaker host
+func (r *EgressProxyReconciler) buildEgressGatewayStatefulSet(ctx context.Context, namespace string) (*appsv1.StatefulSet, error) {
+	netclientImage := getEnvOrDefault("NETCLIENT_IMAGE", "gravitl/netclient:v1.4.0")
+	proxyImage := getEnvOrDefault("EGRESS_PROXY_IMAGE", "alpine/socat:latest")
+	storageSize := getEnvOrDefault("NETCLIENT_PVC_STORAGE_SIZE", "1Gi")
+	storageClass := getEnvOrDefault("NETCLIENT_PVC_STORAGE_CLASS", "") // Empty means use default
+	replicas := getEgressGatewayReplicas()
+
+	// The gateway is not tied to a single Service, so it uses the default token secret of its namespace
+	gatewayService := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: namespace}}
+	netclientToken := r.getNetclientToken(ctx, gatewayService)
+
+	podLabels := egressGatewayPodLabels()
+
+	claim := corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "etc-netclient",
+			Labels: podLabels,
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+			Resources: corev1.VolumeResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceStorage: resource.MustParse(storageSize),
+				},
+			},
+		},
+	}
+	if storageClass != "" {
+		claim.Spec.StorageClassName = &storageClass
+	}
+
+	template := corev1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels:      podLabels,
+			Annotations: map[string]string{},
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				// Netclient sidecar
+				{
+					Name:  "netclient",
+					Image: netclientImage,
+					Env:   r.buildNetclientEnvVars(ctx, gatewayService, netclientToken),
+					VolumeMounts: []corev1.VolumeMount{
+						{Name: "etc-netclient", MountPath: "/etc/netclient"},
+						{Name: "log-netclient", MountPath: "/var/log"},
+					},
+					SecurityContext: &corev1.SecurityContext{
+						Capabilities: &corev1.Capabilities{
+							Add: []corev1.Capability{"NET_ADMIN", "SYS_MODULE"},
+						},
+					},
+					Resources: corev1.ResourceRequirements{
+						Limits: corev1.ResourceList{
+							corev1.ResourceCPU:    resource.MustParse("200m"),
+							corev1.ResourceMemory: resource.MustParse("128Mi"),
+						},
+						Requests: corev1.ResourceList{
+							corev1.ResourceCPU:    resource.MustParse("50m"),
+							corev1.ResourceMemory: resource.MustParse("64Mi"),
+						},
+					},
+				},
+				// TCP proxy container running one socat listener per Service port
+				{
+					Name:    "proxy",
+					Image:   proxyImage,
+					Command: buildEgressGatewayCommand(),
+					VolumeMounts: []corev1.VolumeMount{
+						{Name: "gateway-config", MountPath: "/etc/egress-gateway", ReadOnly: true},
+					},
+					Resources: corev1.ResourceRequirements{
+						Limits: corev1.ResourceList{
+							corev1.ResourceCPU:    resource.MustParse("200m"),
+							corev1.ResourceMemory: resource.MustParse("128Mi"),
+						},
+						Requests: corev1.ResourceList{
+							corev1.ResourceCPU:    resource.MustParse("20m"),
+							corev1.ResourceMemory: resource.MustParse("32Mi"),
+						},
+					},
+					// Ready only once netclient holds an address and every configured listener is bound
+					ReadinessProbe: &corev1.Probe{
+						ProbeHandler: corev1.ProbeHandler{
+							Exec: &corev1.ExecAction{
+								Command: buildEgressGatewayReadinessCommand(),
+							},
+						},
+						InitialDelaySeconds: 10,
+						PeriodSeconds:       5,
+						TimeoutSeconds:      5,
+						FailureThreshold:    3,
+					},
+				},
+			},
+			Volumes: []corev1.Volume{
+				{Name: "log-netclient", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{Medium: corev1.StorageMediumMemory}}},
+				{Name: "gateway-config", VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{
+					LocalObjectReference: corev1.LocalObjectReference{Name: egressGatewayName},
+				}}},
+			},
+		},
+	}
+
+	data, err := json.Marshal(template)
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256(data)
+	template.Annotations[EgressGatewayConfigHashAnnotation] = hex.EncodeToString(hash[:])
+
+	return &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      egressGatewayName,
+			Namespace: namespace,
+			Labels:    egressGatewayPodLabels(),
+		},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas:            &replicas,
+			ServiceName:         egressGatewayName,
+			PodManagementPolicy: appsv1.ParallelPodManagement,
+			Selector:            &metav1.LabelSelector{MatchLabels: podLabels},
+			// Claims outlive the gateway so it rejoins as the same hosts when it comes back
+			PersistentVolumeClaimRetentionPolicy: &appsv1.StatefulSetPersistentVolumeClaimRetentionPolicy{
+				WhenDeleted: appsv1.RetainPersistentVolumeClaimRetentionPolicyType,
+				WhenScaled:  appsv1.RetainPersistentVolumeClaimRetentionPolicyType,
+			},
+			VolumeClaimTemplates: []corev1.PersistentVolumeClaim{claim},
+			Template:             template,
+		},
+	}, nil
+}
+
+// buildEgressGatewayCommand creates the gateway proxy command
+// Each line of the listener config runs one socat process: <listenPort> <targetAddr> <targetPort> <key>
+// The config is re-read every few seconds: listeners whose line changed or went away are stopped, new lines
+// are started and listeners that exited are restarted. Connections already accepted are left to finish.
+func buildEgressGatewayCommand() []string {
+	script := `config=/etc/egress-gateway/` + egressGatewayListenersKey + `
+state=/tmp/egress-gateway
+mkdir -p "$state"
+alive() {
+  status=$(sed 's/.*) //' "/proc/$1/stat" 2>/dev/null | cut -c1)
+  [ -n "$status" ] && [ "$status" != "Z" ]
+}
+while true; do
+  for pidfile in "$state"/*.pid; do
+    [ -e "$pidfile" ] || continue
+    listen=$(basename "$pidfile" .pid)
+    line=$(cat "$state/$listen.line")
+    pid=$(cat "$pidfile")
+    if ! grep -qxF "$line" "$config" 2>/dev/null || ! alive "$pid"; then
+      echo "Stopping socat listener: $line"
+      kill "$pid" 2>/dev/null
+      wait "$pid" 2>/dev/null
+      rm -f "$pidfile" "$state/$listen.line"
+    fi
+  done
+  while read -r listen target port key; do
+    [ -z "$listen" ] && continue
+    [ -e "$state/$listen.pid" ] && continue
+    echo "Starting socat listener: $listen -> $target:$port ($key)"
+    socat TCP-LISTEN:$listen,fork,reuseaddr TCP:$target:$port &
+    echo $! > "$state/$listen.pid"
+    echo "$listen $target $port $key" > "$state/$listen.line"
+  done < "$config"
+  sleep 10
+done
+`
+	return []string{"/bin/sh", "-c", script}
+}
+
+// buildEgressGatewayReadinessCommand creates the readiness check for the gateway proxy
+// The gateway is ready when an interface other than eth0/lo holds an IPv4 address, that is netclient joined,
+// and every listener in the mounted config is bound. The config is read at probe time, like the proxy reads it.
+func buildEgressGatewayReadinessCommand() []string {
+	script := `if ! ip -o -4 addr show | awk '$2 != "lo" && $2 != "eth0" { found = 1 } END { exit !found }'; then
+  echo "No Netmaker interface has an address"
+  exit 1
+fi
+while read -r listen target port key; do
+  [ -z "$listen" ] && continue
+  if ! netstat -ltn 2>/dev/null | grep -q ":$listen "; then
+    echo "Listener not bound on port $listen ($key)"
+    exit 1
+  fi
+done < /etc/egress-gateway/` + egressGatewayListenersKey + `
+`
+	return []string{"/bin/sh", "-c", script}
+}
+
+// updateGatewayServiceEndpoints points the Service endpoints at the gateway port allocated to each Service port
+func (r *EgressProxyReconciler) updateGatewayServiceEndpoints(ctx context.Context, service *corev1.Service, listeners map[string]egressGatewayListener) error {
+	gatewayNamespace := getEgressGatewayNamespace(service.Namespace)
+
+	pods := &corev1.PodList{}
+	if err := r.List(ctx, pods, client.InNamespace(gatewayNamespace), client.MatchingLabels(egressGatewayPodLabels())); err != nil {
+		return err
+	}
+
+	addresses := []corev1.EndpointAddress{}
+	for _, pod := range pods.Items {
+		if pod.Status.PodIP == "" || pod.DeletionTimestamp != nil || !isPodReady(&pod) {
+			continue
+		}
+		addresses = append(addresses, corev1.EndpointAddress{
+			IP: pod.Status.PodIP,
+			TargetRef: &corev1.ObjectReference{
+				Kind:      "Pod",
+				Namespace: pod.Namespace,
+				Name:      pod.Name,
+				UID:       pod.UID,
+			},
+		})
+	}
+	if len(addresses) == 0 {
+		return nil // Gateway not ready yet
+	}
+
+	ports := make([]corev1.EndpointPort, 0, len(service.Spec.Ports))
+	for _, port := range service.Spec.Ports {
+		listener, ok := listeners[egressGatewayListenerKey(service, port)]
+		if !ok {
+			continue
+		}
+		ports = append(ports, corev1.EndpointPort{
+			Name:     port.Name,
+			Port:     listener.ListenPort,
+			Protocol: port.Protocol,
+		})
+	}
+
+	subsets := []corev1.EndpointSubset{{Addresses: addresses, Ports: ports}}
+
+	endpoints := &corev1.Endpoints{}
+	err := r.Get(ctx, types.NamespacedName{Name: service.Name, Namespace: service.Namespace}, endpoints)
+	if errors.IsNotFound(err) {
+		endpoints = &corev1.Endpoints{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      service.Name,
+				Namespace: service.Namespace,
+			},
+			Subsets: subsets,
+		}
+		return r.Create(ctx, endpoints)
+	}
+	if err != nil {
+		return err
+	}
+
+	endpoints.Subsets = subsets
+	return r.Update(ctx, endpoints)
+}
+
+// cleanupGatewayServiceEndpoints deletes the endpoints of a Service that is no longer served by the gateway
+// Endpoints not pointing at gateway pods belong to someone else and are left alone
+func (r *EgressProxyReconciler) cleanupGatewayServiceEndpoints(ctx context.Context, namespacedName types.NamespacedName) error {
+	endpoints := &corev1.Endpoints{}
+	if err := r.Get(ctx, namespacedName, endpoints); err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	if !isEgressGatewayEndpoints(endpoints, getEgressGatewayNamespace(namespacedName.Namespace)) {
+		return nil
+	}
+
+	log.FromContext(ctx).Info("Deleting endpoints of service no longer served by egress gateway", "service", namespacedName)
+	if err := r.Delete(ctx, endpoints); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// isEgressGatewayEndpoints checks if the endpoints point at the gateway pods in gatewayNamespace
+func isEgressGatewayEndpoints(endpoints *corev1.Endpoints, gatewayNamespace string) bool {
+	for _, subset := range endpoints.Subsets {
+		for _, address := range append(subset.Addresses, subset.NotReadyAddresses...) {
+			ref := address.TargetRef
+			if ref != nil && ref.Kind == "Pod" && ref.Namespace == gatewayNamespace && strings.HasPrefix(ref.Name, egressGatewayName+"-") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// cleanupEgressGateway removes the shared egress gateway once no egress Service uses it
+// The netclient claims of the replicas are kept, so the gateway rejoins as the same hosts when it is needed again
+func (r *EgressProxyReconciler) cleanupEgressGateway(ctx context.Context, namespace string) error {
+	logger := log.FromContext(ctx)
+
+	for _, gateway := range []client.Object{&appsv1.StatefulSet{}, &appsv1.Deployment{}} {
+		if err := r.Get(ctx, types.NamespacedName{Name: egressGatewayName, Namespace: namespace}, gateway); err == nil {
+			logger.Info("Deleting egress gateway", "namespace", namespace)
+			if err := r.Delete(ctx, gateway); err != nil && !errors.IsNotFound(err) {
+				return err
+			}
+		} else if !errors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	configMap := &corev1.ConfigMap{}
+	if err := r.Get(ctx, types.NamespacedName{Name: egressGatewayName, Namespace: namespace}, configMap); err == nil {
+		if err := r.Delete(ctx, configMap); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	} else if !errors.IsNotFound(err) {
+		return err
+	}
+
+	return nil
+}
+
+// mapGatewayPodToServices enqueues the egress Services served by a gateway pod so their endpoints follow the gateway
+func (r *EgressProxyReconciler) mapGatewayPodToServices(ctx context.Context, obj client.Object) []reconcile.Request {
+	if getEgressGatewayMode() == "" || obj.GetLabels()["app"] != egressGatewayName {
+		return nil
+	}
+
+	services := &corev1.ServiceList{}
+	listOpts := []client.ListOption{}
+	if getEgressGatewayMode() == egressGatewayModeNamespace {
+		listOpts = append(listOpts, client.InNamespace(obj.GetNamespace()))
+	}
+	if err := r.List(ctx, services, listOpts...); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list services for egress gateway pod", "pod", obj.GetName())
+		return nil
+	}
+
+	requests := []reconcile.Request{}
+	for _, service := range services.Items {
+		_, hasIP := service.Annotations["netmaker.io/egress-target-ip"]
+		_, hasDNS := service.Annotations["netmaker.io/egress-target-dns"]
+		if !hasIP && !hasDNS {
+			continue
+		}
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Name: service.Name, Namespace: service.Namespace},
+		})
+	}
+	return requests
+}
+
+// hasEgressGatewayListener checks if any port of the Service is served by the gateway
+func hasEgressGatewayListener(service *corev1.Service, listeners map[string]egressGatewayListener) bool {
+	for _, port := range service.Spec.Ports {
+		if _, ok := listeners[egressGatewayListenerKey(service, port)]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// egressGatewayListenerKey identifies a Service port in the gateway listener config
+func egressGatewayListenerKey(service *corev1.Service, port corev1.ServicePort) string {
+	return fmt.Sprintf("%s/%s/%d", service.Namespace, service.Name, port.Port)
+}
+
+// egressTargetPort returns the port on the Netmaker device that a Service port forwards to
+func egressTargetPort(port corev1.ServicePort) int32 {
+	if port.TargetPort.IntVal != 0 {
+		return port.TargetPort.IntVal
+	}
+	return port.Port
+}
+
+// allocateEgressGatewayPorts assigns a distinct gateway port to each desired listener
+// Listeners already present in the current config keep their port so Services don't move on every change
+// Fails when the listeners don't fit between basePort and 65535
+func allocateEgressGatewayPorts(existing, desired []egressGatewayListener, basePort int32) ([]egressGatewayListener, error) {
+	existingPorts := make(map[string]int32, len(existing))
+	for _, listener := range existing {
+		existingPorts[listener.Key] = listener.ListenPort
+	}
+
+	used := map[int32]bool{}
+	result := make([]egressGatewayListener, 0, len(desired))
+	pending := []int{}
+	for _, listener := range desired {
+		if port, ok := existingPorts[listener.Key]; ok && !used[port] {
+			listener.ListenPort = port
+			used[port] = true
+		} else {
+			pending = append(pending, len(result))
+		}
+		result = append(result, listener)
+	}
+
+	next := basePort
+	for _, i := range pending {
+		for used[next] {
+			next++
+		}
+		if next > 65535 {
+			return nil, fmt.Errorf("egress gateway has no free port for %s, %d listeners don't fit between port %d and 65535",
+				result[i].Key, len(desired), basePort)
+		}
+		result[i].ListenPort = next
+		used[next] = true
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].ListenPort < result[j].ListenPort })
+	return result, nil
+}
+
+// parseEgressGatewayListeners parses the listener config stored in the gateway ConfigMap
+func parseEgressGatewayListeners(config string) []egressGatewayListener {
+	listeners := []egressGatewayListener{}
+	for _, line := range strings.Split(config, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 4 {
+			continue
+		}
+		listenPort, err := strconv.ParseInt(fields[0], 10, 32)
+		if err != nil {
+			continue
+		}
+		targetPort, err := strconv.ParseInt(fields[2], 10, 32)
+		if err != nil {
+			continue
+		}
+		listeners = append(listeners, egressGatewayListener{
+			Key:        fields[3],
+			ListenPort: int32(listenPort),
+			TargetAddr: fields[1],
+			TargetPort: int32(targetPort),
+		})
+	}
+	return listeners
+}
+
+// renderEgressGatewayListeners renders the listener config stored in the gateway ConfigMap
+func renderEgressGatewayListeners(listeners []egressGatewayListener) string {
+	var b strings.Builder
+	for _, listener := range listeners {
+		fmt.Fprintf(&b, "%d %s %d %s\n", listener.ListenPort, listener.TargetAddr, listener.TargetPort, listener.Key)
+	}
+	return b.String()
+}
+
+// getEgressGatewayReplicas returns the number of gateway replicas
+func getEgressGatewayReplicas() int32 {
+	replicas, err := strconv.ParseInt(getEnvOrDefault("EGRESS_GATEWAY_REPLICAS", "2"), 10, 32)
+	if err != nil || replicas < 1 {
+		return 2
+	}
+	return int32(replicas)
+}
+
+// getEgressGatewayBasePort returns the first port allocated to gateway listeners
+func getEgressGatewayBasePort() int32 {
+	port, err := strconv.ParseInt(getEnvOrDefault("EGRESS_GATEWAY_BASE_PORT", "20000"), 10, 32)
+	if err != nil || port < 1024 || port > 65535 {
+		return 20000
+	}
+	return int32(port)
+}
+
+// isPodReady checks if the pod has the Ready condition set
+func isPodReady(pod *corev1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
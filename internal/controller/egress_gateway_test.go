@@ -0,0 +1,157 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Egress gateway", func() {
+	listener := func(key string, listenPort int32) egressGatewayListener {
+		return egressGatewayListener{Key: key, ListenPort: listenPort, TargetAddr: "10.101.0.5", TargetPort: 5432}
+	}
+
+	DescribeTable("allocateEgressGatewayPorts",
+		func(existing, desired, expected []egressGatewayListener) {
+			Expect(allocateEgressGatewayPorts(existing, desired, 20000)).To(Equal(expected))
+		},
+		Entry("allocates from the base port",
+			nil,
+			[]egressGatewayListener{listener("default/db/5432", 0), listener("default/cache/6379", 0)},
+			[]egressGatewayListener{listener("default/db/5432", 20000), listener("default/cache/6379", 20001)}),
+		Entry("reuses the port of existing listeners",
+			[]egressGatewayListener{listener("default/db/5432", 20003)},
+			[]egressGatewayListener{listener("default/cache/6379", 0), listener("default/db/5432", 0)},
+			[]egressGatewayListener{listener("default/cache/6379", 20000), listener("default/db/5432", 20003)}),
+		Entry("frees the port of removed listeners",
+			[]egressGatewayListener{listener("default/old/80", 20000), listener("default/db/5432", 20001)},
+			[]egressGatewayListener{listener("default/db/5432", 0), listener("default/new/80", 0)},
+			[]egressGatewayListener{listener("default/new/80", 20000), listener("default/db/5432", 20001)}),
+		Entry("skips ports kept by existing listeners",
+			[]egressGatewayListener{listener("default/db/5432", 20000)},
+			[]egressGatewayListener{listener("default/new/80", 0), listener("default/db/5432", 0)},
+			[]egressGatewayListener{listener("default/db/5432", 20000), listener("default/new/80", 20001)}),
+		Entry("moves one of two listeners colliding on a port",
+			[]egressGatewayListener{listener("default/a/80", 20000), listener("default/b/80", 20000)},
+			[]egressGatewayListener{listener("default/a/80", 0), listener("default/b/80", 0)},
+			[]egressGatewayListener{listener("default/a/80", 20000), listener("default/b/80", 20001)}),
+	)
+
+	It("rejects listeners past port 65535", func() {
+		_, err := allocateEgressGatewayPorts(
+			[]egressGatewayListener{listener("default/db/5432", 65535)},
+			[]egressGatewayListener{listener("default/db/5432", 0), listener("default/new/80", 0)},
+			65535)
+		Expect(err).To(MatchError(ContainSubstring("default/new/80")))
+	})
+
+	DescribeTable("parseEgressGatewayListeners",
+		func(config string, expected []egressGatewayListener) {
+			Expect(parseEgressGatewayListeners(config)).To(Equal(expected))
+		},
+		Entry("empty config", "", []egressGatewayListener{}),
+		Entry("listener lines",
+			"20000 10.101.0.5 5432 default/db/5432\n20001 db.example.com 443 team-a/api/443\n",
+			[]egressGatewayListener{
+				listener("default/db/5432", 20000),
+				{Key: "team-a/api/443", ListenPort: 20001, TargetAddr: "db.example.com", TargetPort: 443},
+			}),
+		Entry("malformed lines are skipped",
+			"20000 10.101.0.5 5432\nport 10.101.0.5 5432 default/a/80\n20001 10.101.0.5 port default/b/80\n\n20002 10.101.0.5 5432 default/db/5432\n",
+			[]egressGatewayListener{listener("default/db/5432", 20002)}),
+	)
+
+	It("renders listeners that parse back to the same listeners", func() {
+		listeners := []egressGatewayListener{listener("default/db/5432", 20000), listener("team-a/api/443", 20001)}
+		config := renderEgressGatewayListeners(listeners)
+		Expect(config).To(Equal("20000 10.101.0.5 5432 default/db/5432\n20001 10.101.0.5 5432 team-a/api/443\n"))
+		Expect(parseEgressGatewayListeners(config)).To(Equal(listeners))
+	})
+
+	It("builds a StatefulSet that keeps netclient state in claims and doesn't roll on listener changes", func() {
+		r := &EgressProxyReconciler{Client: fake.NewClientBuilder().WithScheme(scheme.Scheme).Build(), Scheme: scheme.Scheme}
+		statefulSet, err := r.buildEgressGatewayStatefulSet(context.Background(), "default")
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(statefulSet.Spec.VolumeClaimTemplates).To(HaveLen(1))
+		Expect(statefulSet.Spec.VolumeClaimTemplates[0].Name).To(Equal("etc-netclient"))
+		for _, volume := range statefulSet.Spec.Template.Spec.Volumes {
+			Expect(volume.Name).NotTo(Equal("etc-netclient"))
+		}
+		Expect(statefulSet.Spec.Template.Annotations).To(HaveKey(EgressGatewayConfigHashAnnotation))
+		Expect(statefulSet.Spec.Template.Annotations).To(HaveLen(1))
+		for _, container := range statefulSet.Spec.Template.Spec.Containers {
+			Expect(container.Ports).To(BeEmpty())
+		}
+		Expect(statefulSet.Spec.Template.Spec.Containers[1].ReadinessProbe).NotTo(BeNil())
+	})
+
+	It("updates the pod template of an existing gateway", func() {
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+		r := &EgressProxyReconciler{Client: c, Scheme: scheme.Scheme}
+		ctx := context.Background()
+		Expect(r.ensureEgressGatewayStatefulSet(ctx, "default")).To(Succeed())
+
+		GinkgoT().Setenv("EGRESS_PROXY_IMAGE", "alpine/socat:1.8.0")
+		Expect(r.ensureEgressGatewayStatefulSet(ctx, "default")).To(Succeed())
+
+		updated := &appsv1.StatefulSet{}
+		Expect(c.Get(ctx, types.NamespacedName{Name: egressGatewayName, Namespace: "default"}, updated)).To(Succeed())
+		Expect(updated.Spec.Template.Spec.Containers[1].Image).To(Equal("alpine/socat:1.8.0"))
+	})
+
+	Context("when a Service is no longer served by the gateway", func() {
+		gatewayEndpoints := func(name string, podName string) *corev1.Endpoints {
+			return &corev1.Endpoints{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+				Subsets: []corev1.EndpointSubset{{
+					Addresses: []corev1.EndpointAddress{{
+						IP:        "10.0.0.10",
+						TargetRef: &corev1.ObjectReference{Kind: "Pod", Namespace: "default", Name: podName},
+					}},
+				}},
+			}
+		}
+
+		It("deletes endpoints pointing at the gateway and keeps others", func() {
+			c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+				gatewayEndpoints("db", egressGatewayName+"-0"),
+				gatewayEndpoints("web", "web-7d9f8"),
+			).Build()
+			r := &EgressProxyReconciler{Client: c, Scheme: scheme.Scheme}
+
+			Expect(r.cleanupGatewayServiceEndpoints(context.Background(), types.NamespacedName{Namespace: "default", Name: "db"})).To(Succeed())
+			Expect(r.cleanupGatewayServiceEndpoints(context.Background(), types.NamespacedName{Namespace: "default", Name: "web"})).To(Succeed())
+			Expect(r.cleanupGatewayServiceEndpoints(context.Background(), types.NamespacedName{Namespace: "default", Name: "missing"})).To(Succeed())
+
+			err := c.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "db"}, &corev1.Endpoints{})
+			Expect(errors.IsNotFound(err)).To(BeTrue())
+			Expect(c.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "web"}, &corev1.Endpoints{})).To(Succeed())
+		})
+	})
+})
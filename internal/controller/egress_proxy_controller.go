@@ -20,6 +20,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
@@ -29,9 +30,13 @@ import (
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
+// errEgressProxyPodRecreating signals that the proxy pod is being replaced and the Service should be requeued
+var errEgressProxyPodRecreating = fmt.Errorf("egress proxy pod is being recreated")
+
 // EgressProxyReconciler reconciles Services with egress annotations
 type EgressProxyReconciler struct {
 	client.Client
@@ -42,6 +47,9 @@ type EgressProxyReconciler struct {
 // +kubebuilder:rbac:groups="",resources=services/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups="",resources=endpoints,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=apps,resources=deployments;statefulsets,verbs=get;list;watch;create;update;patch;delete
 
 // Reconcile processes Service objects to create egress proxy pods
 func (r *EgressProxyReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
@@ -51,14 +59,23 @@ func (r *EgressProxyReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	service := &corev1.Service{}
 	if err := r.Get(ctx, req.NamespacedName, service); err != nil {
 		if errors.IsNotFound(err) {
+			if getEgressGatewayMode() != "" {
+				// Service deleted, drop its listeners from the shared gateway
+				return r.reconcileGatewayService(ctx, req.NamespacedName, nil)
+			}
 			// Service deleted, clean up proxy pod
 			return r.cleanupProxyPod(ctx, req.NamespacedName)
 		}
 		return ctrl.Result{}, err
 	}
 
-	// Check if egress is enabled
-	if !isEgressEnabled(service) {
+	// In shared gateway mode a single gateway serves all egress Services
+	if getEgressGatewayMode() != "" {
+		return r.reconcileGatewayService(ctx, req.NamespacedName, service)
+	}
+
+	// Check if egress is enabled (per Service or via namespace labels)
+	if !isEgressEnabled(service, getServiceNamespace(ctx, r.Client, service)) {
 		// Egress not enabled, clean up any existing proxy pod
 		return r.cleanupProxyPod(ctx, req.NamespacedName)
 	}
@@ -70,8 +87,16 @@ func (r *EgressProxyReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		return ctrl.Result{}, nil
 	}
 
+	if _, err := getProxyProtocol(service); err != nil {
+		logger.Info("Invalid PROXY protocol setting, skipping egress", "service", req.NamespacedName, "error", err.Error())
+		return ctrl.Result{}, nil
+	}
+
 	// Create or update proxy pod
 	if err := r.ensureProxyPod(ctx, service, targetIP, targetDNS); err != nil {
+		if err == errEgressProxyPodRecreating {
+			return ctrl.Result{RequeueAfter: 5 * time.Second}, nil
+		}
 		logger.Error(err, "Failed to ensure proxy pod", "service", req.NamespacedName)
 		return ctrl.Result{}, err
 	}
@@ -86,11 +111,18 @@ func (r *EgressProxyReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 }
 
 // isEgressEnabled checks if egress is enabled for the service
-func isEgressEnabled(service *corev1.Service) bool {
-	if service.Annotations == nil {
+// The Service annotation takes priority; any value other than "enabled" opts the Service out.
+// Without the annotation, the namespace-wide default (netmaker.io/egress-default) applies,
+// but only to Services that declare an egress target.
+func isEgressEnabled(service *corev1.Service, namespace *corev1.Namespace) bool {
+	if value, exists := service.Annotations["netmaker.io/egress"]; exists {
+		return value == "enabled"
+	}
+	targetIP, targetDNS := getEgressTarget(service)
+	if targetIP == "" && targetDNS == "" {
 		return false
 	}
-	return service.Annotations["netmaker.io/egress"] == "enabled"
+	return namespaceDefaultEnabled(namespace, service, egressDefaultLabel, egressSelectorAnnotation)
 }
 
 // getEgressTarget extracts egress target configuration from service annotations
@@ -119,8 +151,15 @@ func (r *EgressProxyReconciler) ensureProxyPod(ctx context.Context, service *cor
 	}, existingPod)
 
 	if err == nil {
+		// Old pod is still shutting down after an update, retry once it's gone
+		if existingPod.DeletionTimestamp != nil {
+			return errEgressProxyPodRecreating
+		}
+		if err := syncProxyStaticIP(ctx, r.Client, existingPod, service); err != nil {
+			return fmt.Errorf("failed to update static IP of proxy pod: %w", err)
+		}
 		// Pod exists, check if it needs update
-		if needsUpdate(existingPod, targetIP, targetDNS) {
+		if needsUpdate(existingPod, service, targetIP, targetDNS) || proxyNetworkChanged(existingPod, service) {
 			logger.Info("Updating egress proxy pod", "pod", podName)
 			return r.updateProxyPod(ctx, existingPod, service, targetIP, targetDNS)
 		}
@@ -151,7 +190,8 @@ func (r *EgressProxyReconciler) buildProxyPod(ctx context.Context, service *core
 	// Try to get token from secret first (checks Service annotations), fallback to environment variable
 	netclientToken := r.getNetclientToken(ctx, service)
 	// Use socat for simple TCP forwarding - much lighter than nginx
-	proxyImage := getEnvOrDefault("EGRESS_PROXY_IMAGE", "alpine/socat:latest")
+	// HAProxy is used instead when PROXY protocol is enabled
+	proxyImage := getProxyImage(service, "EGRESS_PROXY_IMAGE")
 
 	// Build target address (used in pod labels, actual proxying handled by nginx config)
 
@@ -181,7 +221,7 @@ func (r *EgressProxyReconciler) buildProxyPod(ctx context.Context, service *core
 				{
 					Name:  "netclient",
 					Image: netclientImage,
-					Env:   r.buildNetclientEnvVars(ctx, service, netclientToken),
+					Env:   withProxyNetwork(r.buildNetclientEnvVars(ctx, service, netclientToken), service),
 					VolumeMounts: []corev1.VolumeMount{
 						{Name: "etc-netclient", MountPath: "/etc/netclient"},
 						{Name: "log-netclient", MountPath: "/var/log"},
@@ -207,7 +247,9 @@ func (r *EgressProxyReconciler) buildProxyPod(ctx context.Context, service *core
 					Name:    "proxy",
 					Image:   proxyImage,
 					Ports:   buildProxyPorts(service.Spec.Ports),
-					Command: buildSocatCommand(targetIP, targetDNS, service.Spec.Ports),
+					Command: buildEgressProxyCommand(service, targetIP, targetDNS),
+					// The HAProxy image runs as a non-root user by default, which can't bind privileged ports
+					SecurityContext: egressProxySecurityContext(service),
 					Resources: corev1.ResourceRequirements{
 						Limits: corev1.ResourceList{
 							corev1.ResourceCPU:    resource.MustParse("50m"),
@@ -226,10 +268,36 @@ func (r *EgressProxyReconciler) buildProxyPod(ctx context.Context, service *core
 			},
 		},
 	}
+	if staticIP := service.Annotations[staticIPAnnotation]; staticIP != "" {
+		pod.Annotations = map[string]string{staticIPAnnotation: staticIP}
+	}
 
 	return pod
 }
 
+// buildEgressProxyCommand creates the egress proxy command for the Service
+// With PROXY protocol enabled, HAProxy accepts the header from cluster clients and passes it on to the Netmaker device
+func buildEgressProxyCommand(service *corev1.Service, targetIP, targetDNS string) []string {
+	version, _ := getProxyProtocol(service)
+	if version == "" {
+		return buildSocatCommand(targetIP, targetDNS, service.Spec.Ports)
+	}
+
+	targetAddr := targetIP
+	if targetDNS != "" {
+		targetAddr = targetDNS
+	}
+	listeners := make([]haproxyListener, 0, len(service.Spec.Ports))
+	for _, port := range service.Spec.Ports {
+		// Listen on targetPort (what the Service routes to) and forward to the same port on the Netmaker device
+		listeners = append(listeners, haproxyListener{
+			Bind:   fmt.Sprintf(":%d", egressTargetPort(port)),
+			Target: fmt.Sprintf("%s:%d", targetAddr, egressTargetPort(port)),
+		})
+	}
+	return []string{"/bin/sh", "-c", buildHAProxyScript(listeners, true, version)}
+}
+
 // buildSocatCommand creates socat command for TCP forwarding
 // Uses Service spec's targetPort for each port (standard Kubernetes way)
 // For multiple ports, we use a shell script that runs multiple socat processes
@@ -291,20 +359,54 @@ func buildProxyPorts(servicePorts []corev1.ServicePort) []corev1.ContainerPort {
 	return ports
 }
 
+// egressProxySecurityContext returns the proxy container security context
+// HAProxy runs as root when it listens on a privileged target port, socat already runs as root
+func egressProxySecurityContext(service *corev1.Service) *corev1.SecurityContext {
+	if version, _ := getProxyProtocol(service); version == "" {
+		return nil
+	}
+	for _, port := range service.Spec.Ports {
+		if egressTargetPort(port) < 1024 {
+			return &corev1.SecurityContext{
+				RunAsUser: &[]int64{0}[0],
+			}
+		}
+	}
+	return nil
+}
+
 // needsUpdate checks if pod needs to be updated
-func needsUpdate(pod *corev1.Pod, targetIP, targetDNS string) bool {
-	// Simple check - in production, you'd want more sophisticated comparison
-	// For now, we'll recreate if target changes
-	return false // Simplified - always return false to avoid unnecessary updates
+// Only the proxy image and command are compared, they cover the target and the PROXY protocol setting
+func needsUpdate(pod *corev1.Pod, service *corev1.Service, targetIP, targetDNS string) bool {
+	desired := buildEgressProxyCommand(service, targetIP, targetDNS)
+	for _, container := range pod.Spec.Containers {
+		if container.Name != "proxy" {
+			continue
+		}
+		// Toggling PROXY protocol switches between the socat and HAProxy images
+		if container.Image != getProxyImage(service, "EGRESS_PROXY_IMAGE") {
+			return true
+		}
+		if len(container.Command) != len(desired) {
+			return true
+		}
+		for i := range desired {
+			if container.Command[i] != desired[i] {
+				return true
+			}
+		}
+	}
+	return false
 }
 
 // updateProxyPod updates an existing proxy pod
+// The pod is deleted and recreated on a later reconcile once the old pod is gone
 func (r *EgressProxyReconciler) updateProxyPod(ctx context.Context, pod *corev1.Pod, service *corev1.Service, targetIP, targetDNS string) error {
 	// For simplicity, delete and recreate
-	if err := r.Delete(ctx, pod); err != nil {
+	if err := r.Delete(ctx, pod); err != nil && !errors.IsNotFound(err) {
 		return err
 	}
-	return r.ensureProxyPod(ctx, service, targetIP, targetDNS)
+	return errEgressProxyPodRecreating
 }
 
 // updateServiceEndpoints updates Service endpoints to point to proxy pod
@@ -419,6 +521,10 @@ func (r *EgressProxyReconciler) cleanupProxyPod(ctx context.Context, namespacedN
 func (r *EgressProxyReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&corev1.Service{}).
+		// Re-evaluate Services when namespace-wide egress labels change
+		Watches(&corev1.Namespace{}, handler.EnqueueRequestsFromMapFunc(mapNamespaceToServices(mgr.GetClient()))).
+		// Keep Service endpoints in sync with the shared egress gateway pods
+		Watches(&corev1.Pod{}, handler.EnqueueRequestsFromMapFunc(r.mapGatewayPodToServices)).
 		Complete(r)
 }
 
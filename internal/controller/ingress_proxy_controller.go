@@ -20,18 +20,36 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
+const (
+	// ingressBindIPFile is where the proxy records the IP its listeners are bound to
+	ingressBindIPFile = "/tmp/netmaker-ingress-ip"
+	// ingressReadyCondition is the Service status condition reflecting the ingress proxy readiness
+	ingressReadyCondition = "netmaker.io/IngressReady"
+	// IngressDNSNameAnnotation is the DNS name of the ingress; it is copied onto the proxy pod
+	IngressDNSNameAnnotation = "netmaker.io/ingress-dns-name"
+)
+
+// errIngressProxyPodRecreating signals that the proxy pod is being replaced and the Service should be requeued
+var errIngressProxyPodRecreating = fmt.Errorf("ingress proxy pod is being recreated")
+
 // IngressProxyReconciler reconciles Services with ingress annotations
 type IngressProxyReconciler struct {
 	client.Client
@@ -42,6 +60,7 @@ type IngressProxyReconciler struct {
 // +kubebuilder:rbac:groups="",resources=services/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups="",resources=endpoints,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
 
 // Reconcile processes Service objects to create ingress proxy pods
 func (r *IngressProxyReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
@@ -57,33 +76,122 @@ func (r *IngressProxyReconciler) Reconcile(ctx context.Context, req ctrl.Request
 		return ctrl.Result{}, err
 	}
 
+	// Namespace labels can enable ingress for all Services in the namespace
+	namespace := getServiceNamespace(ctx, r.Client, service)
+
 	// Check if ingress is enabled
-	if !isIngressEnabled(service) {
-		// Ingress not enabled, clean up any existing proxy pod
+	if !isIngressEnabled(service, namespace) {
+		// Ingress not enabled, drop the readiness condition and clean up any existing proxy pod
+		if err := r.removeIngressStatus(ctx, service); err != nil {
+			return ctrl.Result{}, err
+		}
 		return r.cleanupProxyPod(ctx, req.NamespacedName)
 	}
 
 	// Prevent both egress and ingress on the same service (they conflict)
-	if service.Annotations != nil && service.Annotations["netmaker.io/egress"] == "enabled" {
+	if isEgressEnabled(service, namespace) {
 		logger.Info("Service has both egress and ingress enabled, skipping ingress", "service", req.NamespacedName)
 		return ctrl.Result{}, nil
 	}
 
+	// Validate the Netmaker-facing port mapping before building the proxy
+	if _, err := getIngressListenPorts(service); err != nil {
+		logger.Info("Invalid ingress listen port mapping, skipping ingress", "service", req.NamespacedName, "error", err.Error())
+		return ctrl.Result{}, nil
+	}
+	if _, err := getProxyProtocol(service); err != nil {
+		logger.Info("Invalid PROXY protocol setting, skipping ingress", "service", req.NamespacedName, "error", err.Error())
+		return ctrl.Result{}, nil
+	}
+
 	// Create or update ingress proxy pod
 	if err := r.ensureProxyPod(ctx, service); err != nil {
+		if err == errIngressProxyPodRecreating {
+			return ctrl.Result{RequeueAfter: 5 * time.Second}, nil
+		}
 		logger.Error(err, "Failed to ensure ingress proxy pod", "service", req.NamespacedName)
 		return ctrl.Result{}, err
 	}
 
+	// Reflect the proxy readiness in the Service status
+	if err := r.updateIngressStatus(ctx, service); err != nil {
+		logger.Error(err, "Failed to update ingress status", "service", req.NamespacedName)
+		return ctrl.Result{}, err
+	}
+
 	return ctrl.Result{}, nil
 }
 
+// updateIngressStatus sets the netmaker.io/IngressReady condition on the Service from the proxy pod readiness
+func (r *IngressProxyReconciler) updateIngressStatus(ctx context.Context, service *corev1.Service) error {
+	podName := fmt.Sprintf("%s-ingress-proxy", service.Name)
+
+	condition := metav1.Condition{
+		Type:               ingressReadyCondition,
+		Status:             metav1.ConditionFalse,
+		Reason:             "ProxyPodPending",
+		Message:            fmt.Sprintf("Ingress proxy pod %s has not been created yet", podName),
+		ObservedGeneration: service.Generation,
+	}
+
+	pod := &corev1.Pod{}
+	err := r.Get(ctx, types.NamespacedName{Name: podName, Namespace: service.Namespace}, pod)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	if err == nil {
+		condition.Reason = "ProxyNotReady"
+		condition.Message = fmt.Sprintf("Ingress proxy pod %s is %s", podName, pod.Status.Phase)
+		for _, podCondition := range pod.Status.Conditions {
+			if podCondition.Type != corev1.PodReady {
+				continue
+			}
+			if podCondition.Status == corev1.ConditionTrue {
+				condition.Status = metav1.ConditionTrue
+				condition.Reason = "ProxyReady"
+				condition.Message = fmt.Sprintf("Ingress proxy pod %s is listening on the Netmaker network", podName)
+			} else if podCondition.Message != "" {
+				condition.Message = fmt.Sprintf("Ingress proxy pod %s: %s", podName, podCondition.Message)
+			}
+		}
+	}
+
+	if !meta.SetStatusCondition(&service.Status.Conditions, condition) {
+		return nil
+	}
+	return r.Status().Update(ctx, service)
+}
+
+// removeIngressStatus removes the netmaker.io/IngressReady condition from the Service
+func (r *IngressProxyReconciler) removeIngressStatus(ctx context.Context, service *corev1.Service) error {
+	if !meta.RemoveStatusCondition(&service.Status.Conditions, ingressReadyCondition) {
+		return nil
+	}
+	return r.Status().Update(ctx, service)
+}
+
+// mapProxyPodToService enqueues the Service of an ingress proxy pod when the pod changes
+func mapProxyPodToService(ctx context.Context, obj client.Object) []reconcile.Request {
+	labels := obj.GetLabels()
+	if labels["app"] != "netmaker-ingress-proxy" || labels["service-name"] == "" {
+		return nil
+	}
+	return []reconcile.Request{{
+		NamespacedName: types.NamespacedName{
+			Name:      labels["service-name"],
+			Namespace: obj.GetNamespace(),
+		},
+	}}
+}
+
 // isIngressEnabled checks if ingress is enabled for the service
-func isIngressEnabled(service *corev1.Service) bool {
-	if service.Annotations == nil {
-		return false
+// The Service annotation takes priority; any value other than "enabled" opts the Service out.
+// Without the annotation, the namespace-wide default (netmaker.io/ingress-default) applies.
+func isIngressEnabled(service *corev1.Service, namespace *corev1.Namespace) bool {
+	if value, exists := service.Annotations["netmaker.io/ingress"]; exists {
+		return value == "enabled"
 	}
-	return service.Annotations["netmaker.io/ingress"] == "enabled"
+	return namespaceDefaultEnabled(namespace, service, ingressDefaultLabel, ingressSelectorAnnotation)
 }
 
 // getIngressConfig extracts ingress configuration from service annotations
@@ -93,11 +201,73 @@ func getIngressConfig(service *corev1.Service) (bindIP, dnsName string) {
 	}
 
 	bindIP = service.Annotations["netmaker.io/ingress-bind-ip"]
-	dnsName = service.Annotations["netmaker.io/ingress-dns-name"]
+	dnsName = service.Annotations[IngressDNSNameAnnotation]
 
 	return bindIP, dnsName
 }
 
+// getIngressListenPorts parses the netmaker.io/ingress-listen-ports annotation
+// The annotation maps Service ports (by number or name) to the port the proxy listens on
+// in the Netmaker network, e.g. "443:8443,http:8080". Unmapped ports listen on the Service port.
+func getIngressListenPorts(service *corev1.Service) (map[string]int32, error) {
+	listenPorts := map[string]int32{}
+	value := service.Annotations["netmaker.io/ingress-listen-ports"]
+	if strings.TrimSpace(value) == "" {
+		return listenPorts, nil
+	}
+
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, ":", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf("invalid entry %q, expected <service-port>:<listen-port>", entry)
+		}
+		listenPort, err := strconv.ParseInt(strings.TrimSpace(parts[1]), 10, 32)
+		if err != nil || listenPort < 1 || listenPort > 65535 {
+			return nil, fmt.Errorf("invalid listen port in entry %q", entry)
+		}
+		listenPorts[strings.TrimSpace(parts[0])] = int32(listenPort)
+	}
+
+	// Two Service ports can't share a listener
+	used := map[int32]string{}
+	for _, port := range service.Spec.Ports {
+		listenPort := ingressListenPort(port, listenPorts)
+		if other, exists := used[listenPort]; exists {
+			return nil, fmt.Errorf("service ports %s and %d both listen on port %d", other, port.Port, listenPort)
+		}
+		used[listenPort] = strconv.Itoa(int(port.Port))
+	}
+
+	return listenPorts, nil
+}
+
+// ingressListenPort returns the port the proxy listens on in the Netmaker network for a Service port
+func ingressListenPort(port corev1.ServicePort, listenPorts map[string]int32) int32 {
+	if listenPort, exists := listenPorts[strconv.Itoa(int(port.Port))]; exists {
+		return listenPort
+	}
+	if port.Name != "" {
+		if listenPort, exists := listenPorts[port.Name]; exists {
+			return listenPort
+		}
+	}
+	return port.Port
+}
+
+// ingressListenersUnprivileged checks if every listener uses a non-privileged port
+func ingressListenersUnprivileged(service *corev1.Service, listenPorts map[string]int32) bool {
+	for _, port := range service.Spec.Ports {
+		if ingressListenPort(port, listenPorts) < 1024 {
+			return false
+		}
+	}
+	return true
+}
+
 // ensureProxyPod creates or updates the ingress proxy pod
 func (r *IngressProxyReconciler) ensureProxyPod(ctx context.Context, service *corev1.Service) error {
 	logger := log.FromContext(ctx)
@@ -111,8 +281,15 @@ func (r *IngressProxyReconciler) ensureProxyPod(ctx context.Context, service *co
 	}, existingPod)
 
 	if err == nil {
+		// Old pod is still shutting down after an update, retry once it's gone
+		if existingPod.DeletionTimestamp != nil {
+			return errIngressProxyPodRecreating
+		}
+		if err := syncProxyStaticIP(ctx, r.Client, existingPod, service); err != nil {
+			return fmt.Errorf("failed to update static IP of proxy pod: %w", err)
+		}
 		// Pod exists, check if it needs update
-		if needsIngressUpdate(existingPod, service) {
+		if needsIngressUpdate(existingPod, service) || proxyNetworkChanged(existingPod, service) {
 			logger.Info("Updating ingress proxy pod", "pod", podName)
 			return r.updateProxyPod(ctx, existingPod, service)
 		}
@@ -141,10 +318,27 @@ func (r *IngressProxyReconciler) buildProxyPod(ctx context.Context, service *cor
 	netclientImage := getEnvOrDefaultIngress("NETCLIENT_IMAGE", "gravitl/netclient:v1.4.0")
 	// Try to get token from secret first (checks Service annotations), fallback to environment variable
 	netclientToken := r.getNetclientToken(ctx, service)
-	// Use socat for simple TCP forwarding
-	proxyImage := getEnvOrDefaultIngress("INGRESS_PROXY_IMAGE", "alpine/socat:latest")
+	// Use socat for simple TCP forwarding, or HAProxy when PROXY protocol is enabled
+	proxyImage := getProxyImage(service, "INGRESS_PROXY_IMAGE")
 
 	bindIP, dnsName := getIngressConfig(service)
+	// Already validated in Reconcile
+	listenPorts, _ := getIngressListenPorts(service)
+
+	// Listeners on non-privileged ports don't need root
+	var proxySecurityContext *corev1.SecurityContext
+	if ingressListenersUnprivileged(service, listenPorts) {
+		proxySecurityContext = &corev1.SecurityContext{
+			RunAsNonRoot:             &[]bool{true}[0],
+			RunAsUser:                &[]int64{65534}[0],
+			AllowPrivilegeEscalation: &[]bool{false}[0],
+		}
+	} else if version, _ := getProxyProtocol(service); version != "" {
+		// The HAProxy image runs as a non-root user by default, which can't bind privileged ports
+		proxySecurityContext = &corev1.SecurityContext{
+			RunAsUser: &[]int64{0}[0],
+		}
+	}
 
 	// Build pod
 	pod := &corev1.Pod{
@@ -166,7 +360,7 @@ func (r *IngressProxyReconciler) buildProxyPod(ctx context.Context, service *cor
 				},
 			},
 			Annotations: map[string]string{
-				"netmaker.io/ingress-dns-name": dnsName,
+				IngressDNSNameAnnotation: dnsName,
 			},
 		},
 		Spec: corev1.PodSpec{
@@ -175,7 +369,7 @@ func (r *IngressProxyReconciler) buildProxyPod(ctx context.Context, service *cor
 				{
 					Name:  "netclient",
 					Image: netclientImage,
-					Env:   r.buildNetclientEnvVars(ctx, service, netclientToken),
+					Env:   withProxyNetwork(r.buildNetclientEnvVars(ctx, service, netclientToken), service),
 					VolumeMounts: []corev1.VolumeMount{
 						{Name: "etc-netclient", MountPath: "/etc/netclient"},
 						{Name: "log-netclient", MountPath: "/var/log"},
@@ -202,14 +396,15 @@ func (r *IngressProxyReconciler) buildProxyPod(ctx context.Context, service *cor
 				{
 					Name:    "proxy",
 					Image:   proxyImage,
-					Ports:   buildIngressProxyPorts(service.Spec.Ports),
-					Command: buildIngressSocatCommand(service, bindIP),
+					Ports:   buildIngressProxyPorts(service.Spec.Ports, listenPorts),
+					Command: buildIngressSocatCommand(service, bindIP, listenPorts),
 					Env: []corev1.EnvVar{
 						{Name: "SERVICE_NAME", Value: service.Name},
 						{Name: "SERVICE_NAMESPACE", Value: service.Namespace},
 					},
 					// Share netclient's network namespace to access WireGuard interface
 					// Both containers run in the same pod, so they share network namespace by default
+					SecurityContext: proxySecurityContext,
 					Resources: corev1.ResourceRequirements{
 						Limits: corev1.ResourceList{
 							corev1.ResourceCPU:    resource.MustParse("50m"),
@@ -220,20 +415,16 @@ func (r *IngressProxyReconciler) buildProxyPod(ctx context.Context, service *cor
 							corev1.ResourceMemory: resource.MustParse("16Mi"),
 						},
 					},
-					// Add readiness probe to ensure WireGuard IP is detected before marking ready
+					// Ready only once the listeners are bound on the WireGuard IP and the backend is reachable
 					ReadinessProbe: &corev1.Probe{
 						ProbeHandler: corev1.ProbeHandler{
 							Exec: &corev1.ExecAction{
-								Command: []string{
-									"/bin/sh",
-									"-c",
-									"ip addr show | grep -E 'inet.*(10\\.|172\\.(1[6-9]|2[0-9]|3[01])\\.|192\\.168\\.)' | grep -v '127.0.0.1' || exit 1",
-								},
+								Command: buildIngressReadinessCommand(service, listenPorts),
 							},
 						},
 						InitialDelaySeconds: 10,
 						PeriodSeconds:       5,
-						TimeoutSeconds:      2,
+						TimeoutSeconds:      5,
 						FailureThreshold:    3,
 					},
 				},
@@ -244,13 +435,15 @@ func (r *IngressProxyReconciler) buildProxyPod(ctx context.Context, service *cor
 			},
 		},
 	}
+	if staticIP := service.Annotations[staticIPAnnotation]; staticIP != "" {
+		pod.Annotations[staticIPAnnotation] = staticIP
+	}
 
 	return pod
 }
 
-// buildIngressSocatCommand creates socat command for ingress proxying
-// Listens on Netmaker network IP and forwards to Kubernetes Service
-func buildIngressSocatCommand(service *corev1.Service, bindIP string) []string {
+// ingressBackendAddress returns the address the ingress proxy forwards to
+func ingressBackendAddress(service *corev1.Service) string {
 	// Use Service ClusterIP directly for more reliable connectivity
 	// Fallback to DNS if ClusterIP is not available (headless service)
 	serviceAddr := service.Spec.ClusterIP
@@ -258,6 +451,51 @@ func buildIngressSocatCommand(service *corev1.Service, bindIP string) []string {
 		// Headless service - use DNS
 		serviceAddr = fmt.Sprintf("%s.%s.svc.cluster.local", service.Name, service.Namespace)
 	}
+	return serviceAddr
+}
+
+// buildIngressReadinessCommand creates the readiness check for the ingress proxy
+// The proxy is ready when the IP it bound to is held by an interface other than eth0/lo,
+// every listener is bound on that IP, and every backend Service port accepts connections
+func buildIngressReadinessCommand(service *corev1.Service, listenPorts map[string]int32) []string {
+	serviceAddr := ingressBackendAddress(service)
+
+	script := fmt.Sprintf(`WG_IP=$(cat %s 2>/dev/null)
+if [ -z "$WG_IP" ] || [ "$WG_IP" = "0.0.0.0" ]; then
+  echo "WireGuard IP not detected yet"
+  exit 1
+fi
+WG_INTERFACE=$(ip -o -4 addr show | grep " inet $WG_IP/" | awk '{print $2}' | head -n1)
+if [ -z "$WG_INTERFACE" ] || [ "$WG_INTERFACE" = "eth0" ] || [ "$WG_INTERFACE" = "lo" ]; then
+  echo "No Netmaker interface holds $WG_IP"
+  exit 1
+fi
+`, ingressBindIPFile)
+
+	for _, port := range service.Spec.Ports {
+		listenPort := ingressListenPort(port, listenPorts)
+		script += fmt.Sprintf(`if ! netstat -ltn 2>/dev/null | grep -q " $WG_IP:%d "; then
+  echo "Listener not bound on $WG_IP:%d"
+  exit 1
+fi
+`, listenPort, listenPort)
+		// The HAProxy image has no socat, fall back to nc there
+		script += fmt.Sprintf(`if command -v socat >/dev/null 2>&1; then
+  socat -u /dev/null TCP:%[1]s:%[2]d,connect-timeout=2 2>/dev/null
+else
+  nc -z -w 2 %[1]s %[2]d 2>/dev/null
+fi || { echo "Backend %[1]s:%[2]d not reachable"; exit 1; }
+`, serviceAddr, port.Port)
+	}
+
+	return []string{"/bin/sh", "-c", script}
+}
+
+// buildIngressSocatCommand creates socat command for ingress proxying
+// Listens on Netmaker network IP and forwards to Kubernetes Service
+// The listen port defaults to the Service port and can be remapped per port via listenPorts
+func buildIngressSocatCommand(service *corev1.Service, bindIP string, listenPorts map[string]int32) []string {
+	serviceAddr := ingressBackendAddress(service)
 	commands := []string{"/bin/sh", "-c"}
 	socatCmds := ""
 
@@ -327,17 +565,33 @@ fi
 
 echo "Using WireGuard IP: $WG_IP"
 `
+		socatCmds += fmt.Sprintf("echo \"$WG_IP\" > %s\n", ingressBindIPFile)
 	} else {
 		socatCmds += fmt.Sprintf("WG_IP=%s\n", bindIP)
 		socatCmds += "echo \"Using configured bind IP: $WG_IP\"\n"
+		socatCmds += fmt.Sprintf("echo \"$WG_IP\" > %s\n", ingressBindIPFile)
+	}
+
+	// With PROXY protocol enabled, HAProxy forwards instead of socat so the backend sees the Netmaker peer address
+	if version, _ := getProxyProtocol(service); version != "" {
+		listeners := make([]haproxyListener, 0, len(service.Spec.Ports))
+		for _, port := range service.Spec.Ports {
+			listeners = append(listeners, haproxyListener{
+				Bind:   fmt.Sprintf("$WG_IP:%d", ingressListenPort(port, listenPorts)),
+				Target: fmt.Sprintf("%s:%d", serviceAddr, port.Port),
+			})
+		}
+		commands = append(commands, socatCmds+buildHAProxyScript(listeners, false, version))
+		return commands
 	}
 
 	// Build socat commands for each port
 	for _, port := range service.Spec.Ports {
 		servicePort := port.Port
+		listenPort := ingressListenPort(port, listenPorts)
 		// Forward to Service port (Service will route to pods via targetPort)
-		socatCmds += fmt.Sprintf("echo \"Starting socat proxy: $WG_IP:%d -> %s:%d\"\n", servicePort, serviceAddr, servicePort)
-		socatCmds += fmt.Sprintf("socat TCP-LISTEN:%d,bind=$WG_IP,fork,reuseaddr TCP:%s:%d &\n", servicePort, serviceAddr, servicePort)
+		socatCmds += fmt.Sprintf("echo \"Starting socat proxy: $WG_IP:%d -> %s:%d\"\n", listenPort, serviceAddr, servicePort)
+		socatCmds += fmt.Sprintf("socat TCP-LISTEN:%d,bind=$WG_IP,fork,reuseaddr TCP:%s:%d &\n", listenPort, serviceAddr, servicePort)
 	}
 
 	// Wait for all background processes
@@ -348,12 +602,13 @@ echo "Using WireGuard IP: $WG_IP"
 }
 
 // buildIngressProxyPorts creates container ports from service ports
-func buildIngressProxyPorts(servicePorts []corev1.ServicePort) []corev1.ContainerPort {
+// Container ports match the Netmaker-facing listen ports
+func buildIngressProxyPorts(servicePorts []corev1.ServicePort, listenPorts map[string]int32) []corev1.ContainerPort {
 	ports := make([]corev1.ContainerPort, 0, len(servicePorts))
 	for _, port := range servicePorts {
 		ports = append(ports, corev1.ContainerPort{
 			Name:          port.Name,
-			ContainerPort: port.Port,
+			ContainerPort: ingressListenPort(port, listenPorts),
 			Protocol:      port.Protocol,
 		})
 	}
@@ -362,17 +617,40 @@ func buildIngressProxyPorts(servicePorts []corev1.ServicePort) []corev1.Containe
 
 // needsIngressUpdate checks if pod needs to be updated
 func needsIngressUpdate(pod *corev1.Pod, service *corev1.Service) bool {
-	// Simple check - in production, you'd want more sophisticated comparison
-	return false // Simplified - always return false to avoid unnecessary updates
+	// Only the listen ports and proxy image are compared; other changes don't recreate the pod
+	listenPorts, err := getIngressListenPorts(service)
+	if err != nil {
+		return false
+	}
+	desired := buildIngressProxyPorts(service.Spec.Ports, listenPorts)
+	for _, container := range pod.Spec.Containers {
+		if container.Name != "proxy" {
+			continue
+		}
+		// Toggling PROXY protocol switches between the socat and HAProxy images
+		if container.Image != getProxyImage(service, "INGRESS_PROXY_IMAGE") {
+			return true
+		}
+		if len(container.Ports) != len(desired) {
+			return true
+		}
+		for i, port := range container.Ports {
+			if port.ContainerPort != desired[i].ContainerPort {
+				return true
+			}
+		}
+	}
+	return false
 }
 
 // updateProxyPod updates an existing proxy pod
+// The pod is deleted and recreated on a later reconcile once the old pod is gone
 func (r *IngressProxyReconciler) updateProxyPod(ctx context.Context, pod *corev1.Pod, service *corev1.Service) error {
 	// For simplicity, delete and recreate
-	if err := r.Delete(ctx, pod); err != nil {
+	if err := r.Delete(ctx, pod); err != nil && !errors.IsNotFound(err) {
 		return err
 	}
-	return r.ensureProxyPod(ctx, service)
+	return errIngressProxyPodRecreating
 }
 
 // cleanupProxyPod removes the proxy pod when service is deleted or ingress is disabled
@@ -403,6 +681,10 @@ func (r *IngressProxyReconciler) cleanupProxyPod(ctx context.Context, namespaced
 func (r *IngressProxyReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&corev1.Service{}).
+		// Re-evaluate Services when namespace-wide ingress labels change
+		Watches(&corev1.Namespace{}, handler.EnqueueRequestsFromMapFunc(mapNamespaceToServices(mgr.GetClient()))).
+		// Keep the Service status in sync with the proxy pod readiness
+		Watches(&corev1.Pod{}, handler.EnqueueRequestsFromMapFunc(mapProxyPodToService)).
 		Complete(r)
 }
 
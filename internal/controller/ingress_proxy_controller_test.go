@@ -0,0 +1,185 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var _ = Describe("Ingress proxy", func() {
+	newService := func(listenPorts string, ports ...corev1.ServicePort) *corev1.Service {
+		service := &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", Annotations: map[string]string{}},
+			Spec:       corev1.ServiceSpec{ClusterIP: "10.96.0.10", Ports: ports},
+		}
+		if listenPorts != "" {
+			service.Annotations["netmaker.io/ingress-listen-ports"] = listenPorts
+		}
+		return service
+	}
+	https := corev1.ServicePort{Name: "https", Port: 443, Protocol: corev1.ProtocolTCP}
+	http := corev1.ServicePort{Name: "http", Port: 80, Protocol: corev1.ProtocolTCP}
+
+	Context("listen ports", func() {
+		DescribeTable("getIngressListenPorts",
+			func(annotation string, expected map[string]int32, expectErr bool) {
+				listenPorts, err := getIngressListenPorts(newService(annotation, https, http))
+				if expectErr {
+					Expect(err).To(HaveOccurred())
+					return
+				}
+				Expect(err).NotTo(HaveOccurred())
+				Expect(listenPorts).To(Equal(expected))
+			},
+			Entry("no annotation", "", map[string]int32{}, false),
+			Entry("by number and name", "443:8443, http:8080", map[string]int32{"443": 8443, "http": 8080}, false),
+			Entry("empty entries are ignored", "443:8443,,", map[string]int32{"443": 8443}, false),
+			Entry("missing listen port", "443", nil, true),
+			Entry("missing service port", ":8443", nil, true),
+			Entry("listen port out of range", "443:70000", nil, true),
+			Entry("listen port not a number", "443:https", nil, true),
+			Entry("two ports on one listener", "443:80", nil, true),
+		)
+
+		DescribeTable("ingressListenPort",
+			func(port corev1.ServicePort, listenPorts map[string]int32, expected int32) {
+				Expect(ingressListenPort(port, listenPorts)).To(Equal(expected))
+			},
+			Entry("unmapped port listens on the Service port", https, map[string]int32{}, int32(443)),
+			Entry("mapped by number", https, map[string]int32{"443": 8443}, int32(8443)),
+			Entry("mapped by name", https, map[string]int32{"https": 9443}, int32(9443)),
+			Entry("number takes priority over name", https, map[string]int32{"443": 8443, "https": 9443}, int32(8443)),
+		)
+
+		It("runs the proxy unprivileged only when every listener is above 1024", func() {
+			service := newService("", https, http)
+			Expect(ingressListenersUnprivileged(service, map[string]int32{})).To(BeFalse())
+			Expect(ingressListenersUnprivileged(service, map[string]int32{"443": 8443})).To(BeFalse())
+			Expect(ingressListenersUnprivileged(service, map[string]int32{"443": 8443, "http": 8080})).To(BeTrue())
+		})
+
+		It("builds container ports on the listen ports", func() {
+			ports := buildIngressProxyPorts([]corev1.ServicePort{https, http}, map[string]int32{"http": 8080})
+			Expect(ports).To(Equal([]corev1.ContainerPort{
+				{Name: "https", ContainerPort: 443, Protocol: corev1.ProtocolTCP},
+				{Name: "http", ContainerPort: 8080, Protocol: corev1.ProtocolTCP},
+			}))
+		})
+
+		It("listens on the remapped port and forwards to the Service port", func() {
+			command := buildIngressSocatCommand(newService("", https), "", map[string]int32{"443": 8443})
+			Expect(command[len(command)-1]).To(ContainSubstring("TCP-LISTEN:8443,bind=$WG_IP,fork,reuseaddr TCP:10.96.0.10:443"))
+		})
+
+		DescribeTable("needsIngressUpdate",
+			func(annotation string, containerPorts []int32, expected bool) {
+				service := newService(annotation, https, http)
+				proxy := corev1.Container{Name: "proxy", Image: getProxyImage(service, "INGRESS_PROXY_IMAGE")}
+				for _, port := range containerPorts {
+					proxy.Ports = append(proxy.Ports, corev1.ContainerPort{ContainerPort: port})
+				}
+				pod := &corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "netclient"}, proxy}}}
+				Expect(needsIngressUpdate(pod, service)).To(Equal(expected))
+			},
+			Entry("ports unchanged", "", []int32{443, 80}, false),
+			Entry("port remapped", "443:8443", []int32{443, 80}, true),
+			Entry("remapping unchanged", "443:8443", []int32{8443, 80}, false),
+			Entry("port added", "", []int32{443}, true),
+			Entry("invalid mapping keeps the pod", "443:80", []int32{443, 80}, false),
+		)
+	})
+
+	Context("readiness", func() {
+		It("checks every listener and backend port", func() {
+			command := buildIngressReadinessCommand(newService("", https, http), map[string]int32{"443": 8443})
+			script := command[len(command)-1]
+			Expect(script).To(ContainSubstring("cat " + ingressBindIPFile))
+			Expect(script).To(ContainSubstring(`grep -q " $WG_IP:8443 "`))
+			Expect(script).To(ContainSubstring(`grep -q " $WG_IP:80 "`))
+			Expect(script).To(ContainSubstring("TCP:10.96.0.10:443,connect-timeout=2"))
+			Expect(script).To(ContainSubstring("nc -z -w 2 10.96.0.10 80"))
+		})
+
+		It("forwards headless Services by DNS name", func() {
+			service := newService("", https)
+			service.Spec.ClusterIP = corev1.ClusterIPNone
+			Expect(ingressBackendAddress(service)).To(Equal("web.default.svc.cluster.local"))
+		})
+
+		It("maps proxy pods to their Service", func() {
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web-ingress-proxy", Namespace: "default",
+				Labels: map[string]string{"app": "netmaker-ingress-proxy", "service-name": "web"}}}
+			Expect(mapProxyPodToService(context.Background(), pod)).To(Equal([]reconcile.Request{
+				{NamespacedName: types.NamespacedName{Namespace: "default", Name: "web"}},
+			}))
+
+			pod.Labels["app"] = "web"
+			Expect(mapProxyPodToService(context.Background(), pod)).To(BeEmpty())
+		})
+
+		DescribeTable("updateIngressStatus",
+			func(pod *corev1.Pod, status metav1.ConditionStatus, reason string) {
+				service := newService("", https)
+				builder := fake.NewClientBuilder().WithScheme(scheme.Scheme).
+					WithStatusSubresource(&corev1.Service{}).WithObjects(service)
+				if pod != nil {
+					builder = builder.WithObjects(pod)
+				}
+				c := builder.Build()
+				r := &IngressProxyReconciler{Client: c, Scheme: scheme.Scheme}
+
+				Expect(r.updateIngressStatus(context.Background(), service)).To(Succeed())
+
+				updated := &corev1.Service{}
+				Expect(c.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "web"}, updated)).To(Succeed())
+				condition := meta.FindStatusCondition(updated.Status.Conditions, ingressReadyCondition)
+				Expect(condition).NotTo(BeNil())
+				Expect(condition.Status).To(Equal(status))
+				Expect(condition.Reason).To(Equal(reason))
+
+				Expect(r.removeIngressStatus(context.Background(), updated)).To(Succeed())
+				Expect(c.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "web"}, updated)).To(Succeed())
+				Expect(meta.FindStatusCondition(updated.Status.Conditions, ingressReadyCondition)).To(BeNil())
+			},
+			Entry("no proxy pod", nil, metav1.ConditionFalse, "ProxyPodPending"),
+			Entry("proxy pod not ready", proxyPod(corev1.ConditionFalse), metav1.ConditionFalse, "ProxyNotReady"),
+			Entry("proxy pod ready", proxyPod(corev1.ConditionTrue), metav1.ConditionTrue, "ProxyReady"),
+		)
+	})
+})
+
+// proxyPod returns the ingress proxy pod of the web Service with the given readiness
+func proxyPod(ready corev1.ConditionStatus) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "web-ingress-proxy", Namespace: "default"},
+		Status: corev1.PodStatus{
+			Phase:      corev1.PodRunning,
+			Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: ready}},
+		},
+	}
+}
@@ -0,0 +1,31 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+// ManagedAnnotations are the netmaker.io annotations the operator sets on the workloads and pods it creates or
+// injects into; the validating webhook accepts them, so add every new one here
+var ManagedAnnotations = []string{
+	NetclientPVCAnnotation,
+	TokenSourceAnnotation,
+	NetclientStatusPortAnnotation,
+	NetclientHostIDAnnotation,
+	NodeNetclientConfigHashAnnotation,
+	EgressGatewayConfigHashAnnotation,
+	IngressDNSNameAnnotation,
+	NetclientInjectedResourcesAnnotation,
+	InjectedAnnotation,
+}
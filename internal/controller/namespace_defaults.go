@@ -0,0 +1,100 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	// ingressDefaultLabel on a Namespace enables ingress for every Service in it
+	ingressDefaultLabel = "netmaker.io/ingress-default"
+	// egressDefaultLabel on a Namespace enables egress for every Service in it that has an egress target
+	egressDefaultLabel = "netmaker.io/egress-default"
+	// ingressSelectorAnnotation optionally restricts namespace-wide ingress to Services matching a label selector
+	ingressSelectorAnnotation = "netmaker.io/ingress-selector"
+	// egressSelectorAnnotation optionally restricts namespace-wide egress to Services matching a label selector
+	egressSelectorAnnotation = "netmaker.io/egress-selector"
+)
+
+// getServiceNamespace fetches the Namespace of a Service
+// Returns nil if the Namespace cannot be read, in which case namespace defaults are ignored
+func getServiceNamespace(ctx context.Context, c client.Client, service *corev1.Service) *corev1.Namespace {
+	logger := log.FromContext(ctx)
+
+	namespace := &corev1.Namespace{}
+	if err := c.Get(ctx, types.NamespacedName{Name: service.Namespace}, namespace); err != nil {
+		if !errors.IsNotFound(err) {
+			logger.Error(err, "Failed to get namespace, ignoring namespace defaults", "namespace", service.Namespace)
+		}
+		return nil
+	}
+	return namespace
+}
+
+// namespaceDefaultEnabled checks if a namespace-wide default applies to the service
+// The default applies when the Namespace carries defaultLabel=enabled and the Service
+// matches the optional label selector stored in the selectorAnnotation of the Namespace
+func namespaceDefaultEnabled(namespace *corev1.Namespace, service *corev1.Service, defaultLabel, selectorAnnotation string) bool {
+	if namespace == nil || namespace.Labels[defaultLabel] != "enabled" {
+		return false
+	}
+
+	selectorValue := namespace.Annotations[selectorAnnotation]
+	if selectorValue == "" {
+		return true
+	}
+
+	selector, err := labels.Parse(selectorValue)
+	if err != nil {
+		// An invalid selector must not expose every Service in the namespace
+		return false
+	}
+	return selector.Matches(labels.Set(service.Labels))
+}
+
+// mapNamespaceToServices enqueues all Services in a Namespace when its labels or annotations change
+func mapNamespaceToServices(c client.Client) func(ctx context.Context, obj client.Object) []reconcile.Request {
+	return func(ctx context.Context, obj client.Object) []reconcile.Request {
+		logger := log.FromContext(ctx)
+
+		services := &corev1.ServiceList{}
+		if err := c.List(ctx, services, client.InNamespace(obj.GetName())); err != nil {
+			logger.Error(err, "Failed to list services for namespace", "namespace", obj.GetName())
+			return nil
+		}
+
+		requests := make([]reconcile.Request, 0, len(services.Items))
+		for _, service := range services.Items {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Name:      service.Name,
+					Namespace: service.Namespace,
+				},
+			})
+		}
+		return requests
+	}
+}
@@ -0,0 +1,75 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var _ = Describe("Namespace defaults", func() {
+	newNamespace := func(labels, annotations map[string]string) *corev1.Namespace {
+		return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a", Labels: labels, Annotations: annotations}}
+	}
+	newService := func(namespace, name string, labels map[string]string) *corev1.Service {
+		return &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, Labels: labels}}
+	}
+
+	DescribeTable("namespaceDefaultEnabled",
+		func(namespace *corev1.Namespace, serviceLabels map[string]string, expected bool) {
+			service := newService("team-a", "api", serviceLabels)
+			Expect(namespaceDefaultEnabled(namespace, service, ingressDefaultLabel, ingressSelectorAnnotation)).To(Equal(expected))
+		},
+		Entry("no namespace", nil, nil, false),
+		Entry("unlabeled namespace", newNamespace(nil, nil), nil, false),
+		Entry("label not enabled", newNamespace(map[string]string{ingressDefaultLabel: "disabled"}, nil), nil, false),
+		Entry("other default label", newNamespace(map[string]string{egressDefaultLabel: "enabled"}, nil), nil, false),
+		Entry("enabled without selector", newNamespace(map[string]string{ingressDefaultLabel: "enabled"}, nil), nil, true),
+		Entry("matching selector",
+			newNamespace(map[string]string{ingressDefaultLabel: "enabled"}, map[string]string{ingressSelectorAnnotation: "expose=true"}),
+			map[string]string{"expose": "true"}, true),
+		Entry("selector not matching",
+			newNamespace(map[string]string{ingressDefaultLabel: "enabled"}, map[string]string{ingressSelectorAnnotation: "expose=true"}),
+			map[string]string{"expose": "false"}, false),
+		Entry("invalid selector",
+			newNamespace(map[string]string{ingressDefaultLabel: "enabled"}, map[string]string{ingressSelectorAnnotation: "expose in (true"}),
+			map[string]string{"expose": "true"}, false),
+	)
+
+	It("maps a namespace to the services in it", func() {
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+			newService("team-a", "api", nil),
+			newService("team-a", "web", nil),
+			newService("team-b", "api", nil),
+		).Build()
+
+		requests := mapNamespaceToServices(c)(context.Background(), newNamespace(nil, nil))
+		Expect(requests).To(ConsistOf(
+			reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "team-a", Name: "api"}},
+			reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "team-a", Name: "web"}},
+		))
+	})
+})
@@ -0,0 +1,372 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	"github.com/gravitl/netmaker-k8s-ops/internal/netmakerapi"
+)
+
+const (
+	// netclientCleanupFinalizer holds injected pods until their claim and Netmaker host are cleaned up,
+	// in case their workload dropped the sidecar
+	netclientCleanupFinalizer = "netmaker.io/netclient-cleanup"
+	// NetclientInjectionKey is the Namespace label that injects netclient into every workload in it,
+	// and the workload annotation that opts a single workload out with "disabled"
+	NetclientInjectionKey = "netmaker.io/netclient-injection"
+	// NetclientInjectedResourcesAnnotation records on a pod template what injection added, so it can be removed again
+	NetclientInjectedResourcesAnnotation = "netmaker.io/netclient-injected-resources"
+	// InjectedAnnotation summarizes on the admitted object what the webhook injected
+	InjectedAnnotation = "netmaker.io/injected"
+
+	eventReasonNetclientCleanedUp   = "NetclientCleanedUp"
+	eventReasonNetclientHostUnknown = "NetclientHostUnknown"
+	eventReasonNetclientHostKept    = "NetclientHostKept"
+)
+
+// PodTemplateOwner is a configured workload kind (NETCLIENT_POD_TEMPLATE_KINDS) whose pod template the webhook
+// injects into; Fields is the path of the template in the object
+type PodTemplateOwner struct {
+	GroupVersionKind schema.GroupVersionKind
+	Fields           []string
+}
+
+// NetclientCleanupReconciler cleans up after pods whose workload no longer injects netclient
+// The webhook removes the sidecar from the workload template; when the old pods go away, the claim the operator
+// created for them is deleted and their Netmaker host is deregistered. Pods of workloads that still inject
+// netclient keep both, so restarted pods get their identity back.
+type NetclientCleanupReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+	// APIReader reads the owning workloads without caching every ReplicaSet and Job in the cluster
+	APIReader client.Reader
+	// Netmaker deregisters hosts; without it only claims are cleaned up
+	Netmaker *netmakerapi.Client
+	// PodTemplateOwners are the configured kinds pods are followed to, such as Argo Rollouts
+	PodTemplateOwners []PodTemplateOwner
+}
+
+// +kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups="",resources=persistentvolumeclaims,verbs=get;list;watch;delete
+// +kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+// +kubebuilder:rbac:groups=apps,resources=deployments;daemonsets;replicasets;statefulsets,verbs=get
+// +kubebuilder:rbac:groups=batch,resources=jobs;cronjobs,verbs=get
+
+// Reconcile adds the cleanup finalizer to injected pods and cleans up once they are deleted
+func (r *NetclientCleanupReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	pod := &corev1.Pod{}
+	if err := r.Get(ctx, req.NamespacedName, pod); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	if pod.DeletionTimestamp == nil {
+		if !isInjectedPod(pod) || !r.hasCleanup(pod) {
+			return ctrl.Result{}, nil
+		}
+		if controllerutil.AddFinalizer(pod, netclientCleanupFinalizer) {
+			return ctrl.Result{}, r.Update(ctx, pod)
+		}
+		return ctrl.Result{}, nil
+	}
+	if !controllerutil.ContainsFinalizer(pod, netclientCleanupFinalizer) {
+		return ctrl.Result{}, nil
+	}
+
+	dropped, err := r.droppedSidecar(ctx, pod)
+	if err != nil {
+		logger.Error(err, "Failed to check whether the workload still injects netclient", "pod", req.NamespacedName)
+		return ctrl.Result{}, err
+	}
+	if dropped {
+		if err := r.cleanup(ctx, pod); err != nil {
+			logger.Error(err, "Failed to clean up after netclient", "pod", req.NamespacedName)
+			return ctrl.Result{}, err
+		}
+	}
+
+	controllerutil.RemoveFinalizer(pod, netclientCleanupFinalizer)
+	return ctrl.Result{}, client.IgnoreNotFound(r.Update(ctx, pod))
+}
+
+// isInjectedPod checks if the webhook injected netclient into a pod, directly or through its workload template
+// Pods that run a netclient container of their own are left alone
+func isInjectedPod(pod *corev1.Pod) bool {
+	if findNetclientContainer(pod) == nil {
+		return false
+	}
+	return pod.Annotations[NetclientInjectedResourcesAnnotation] != "" || pod.Annotations[InjectedAnnotation] != ""
+}
+
+// hasCleanup checks if anything would be left behind by the pod: a claim created by the operator, or a Netmaker host
+func (r *NetclientCleanupReconciler) hasCleanup(pod *corev1.Pod) bool {
+	return r.Netmaker != nil || pod.Annotations[NetclientPVCAnnotation] != ""
+}
+
+// droppedSidecar checks if the pod's workload no longer injects netclient
+// Pods can't drop containers, so a pod without a workload counts once it lost the netclient label. Workloads
+// that are gone, Jobs, whose template is immutable, and unknown kinds are left alone.
+func (r *NetclientCleanupReconciler) droppedSidecar(ctx context.Context, pod *corev1.Pod) (bool, error) {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil {
+		return r.podDroppedLabel(ctx, pod)
+	}
+
+	template, err := r.ownerTemplate(ctx, pod.Namespace, owner)
+	if err != nil {
+		return false, client.IgnoreNotFound(err)
+	}
+	if template == nil {
+		return false, nil
+	}
+	return !hasNetclientContainer(&template.Spec), nil
+}
+
+// podDroppedLabel checks if a pod without a workload no longer asks for the sidecar
+func (r *NetclientCleanupReconciler) podDroppedLabel(ctx context.Context, pod *corev1.Pod) (bool, error) {
+	switch pod.Labels[netclientModeLabel] {
+	case "enabled":
+		return false, nil
+	case "disabled", nodeRoutedMode:
+		return true, nil
+	}
+	namespace := &corev1.Namespace{}
+	if err := r.Get(ctx, types.NamespacedName{Name: pod.Namespace}, namespace); err != nil {
+		return false, client.IgnoreNotFound(err)
+	}
+	return namespace.Labels[NetclientInjectionKey] != "enabled", nil
+}
+
+// ownerTemplate returns the pod template of the top-level workload behind owner
+// ReplicaSets of Deployments or configured kinds and Jobs of CronJobs are followed to their parent, whose template
+// the webhook changes
+func (r *NetclientCleanupReconciler) ownerTemplate(ctx context.Context, namespace string, owner *metav1.OwnerReference) (*corev1.PodTemplateSpec, error) {
+	key := types.NamespacedName{Name: owner.Name, Namespace: namespace}
+	switch owner.Kind {
+	case "ReplicaSet":
+		replicaSet := &appsv1.ReplicaSet{}
+		if err := r.APIReader.Get(ctx, key, replicaSet); err != nil {
+			return nil, err
+		}
+		if parent := metav1.GetControllerOf(replicaSet); parent != nil {
+			if parent.Kind != "Deployment" || parent.APIVersion != appsv1.SchemeGroupVersion.String() {
+				return r.configuredOwnerTemplate(ctx, namespace, parent)
+			}
+			deployment := &appsv1.Deployment{}
+			if err := r.APIReader.Get(ctx, types.NamespacedName{Name: parent.Name, Namespace: namespace}, deployment); err != nil {
+				return nil, err
+			}
+			return &deployment.Spec.Template, nil
+		}
+		return &replicaSet.Spec.Template, nil
+	case "StatefulSet":
+		statefulSet := &appsv1.StatefulSet{}
+		if err := r.APIReader.Get(ctx, key, statefulSet); err != nil {
+			return nil, err
+		}
+		return &statefulSet.Spec.Template, nil
+	case "DaemonSet":
+		daemonSet := &appsv1.DaemonSet{}
+		if err := r.APIReader.Get(ctx, key, daemonSet); err != nil {
+			return nil, err
+		}
+		return &daemonSet.Spec.Template, nil
+	case "Job":
+		job := &batchv1.Job{}
+		if err := r.APIReader.Get(ctx, key, job); err != nil {
+			return nil, err
+		}
+		parent := metav1.GetControllerOf(job)
+		if parent == nil || parent.Kind != "CronJob" {
+			return nil, nil
+		}
+		cronJob := &batchv1.CronJob{}
+		if err := r.APIReader.Get(ctx, types.NamespacedName{Name: parent.Name, Namespace: namespace}, cronJob); err != nil {
+			return nil, err
+		}
+		return &cronJob.Spec.JobTemplate.Spec.Template, nil
+	default:
+		return r.configuredOwnerTemplate(ctx, namespace, owner)
+	}
+}
+
+// configuredOwnerTemplate returns the pod template of an owner of a configured kind, nil for other kinds and
+// objects without a template at the configured path
+func (r *NetclientCleanupReconciler) configuredOwnerTemplate(ctx context.Context, namespace string, owner *metav1.OwnerReference) (*corev1.PodTemplateSpec, error) {
+	groupVersion, err := schema.ParseGroupVersion(owner.APIVersion)
+	if err != nil {
+		return nil, nil
+	}
+	for _, kind := range r.PodTemplateOwners {
+		// Owner references may name another served version of the kind
+		if kind.GroupVersionKind.GroupKind() != groupVersion.WithKind(owner.Kind).GroupKind() {
+			continue
+		}
+		object := &unstructured.Unstructured{}
+		object.SetGroupVersionKind(kind.GroupVersionKind)
+		err := r.APIReader.Get(ctx, types.NamespacedName{Name: owner.Name, Namespace: namespace}, object)
+		if errors.IsForbidden(err) || meta.IsNoMatchError(err) {
+			// Without access to the kind, or once its CRD is gone, the pod must not stay terminating
+			log.FromContext(ctx).Info("Can't read the pod's workload, leaving its netclient state alone",
+				"kind", owner.Kind, "name", owner.Name, "namespace", namespace, "error", err.Error())
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		value, found, err := unstructured.NestedMap(object.Object, kind.Fields...)
+		if err != nil || !found {
+			return nil, nil
+		}
+		// The webhook decodes the template the same way, so one it can't decode never got a sidecar
+		template := &corev1.PodTemplateSpec{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(value, template); err != nil {
+			return nil, nil
+		}
+		return template, nil
+	}
+	return nil, nil
+}
+
+// cleanup deletes the claim the operator created for the pod and deregisters its Netmaker host
+// StatefulSet claims come from the volumeClaimTemplates, which can't be removed, so they are kept.
+// The host is the one the sidecar reported in netmaker.io/netclient-host-id, and it must still carry the pod's
+// host name; host names alone are not unique, so without the annotation no host is deleted.
+func (r *NetclientCleanupReconciler) cleanup(ctx context.Context, pod *corev1.Pod) error {
+	logger := log.FromContext(ctx)
+	var cleaned []string
+
+	if pvcName := pod.Annotations[NetclientPVCAnnotation]; pvcName != "" {
+		pvc := &corev1.PersistentVolumeClaim{}
+		err := r.Get(ctx, types.NamespacedName{Name: pvcName, Namespace: pod.Namespace}, pvc)
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		// Never delete a claim the operator didn't create
+		if err == nil && pvc.Labels["app.kubernetes.io/managed-by"] == sidecarManagedBy {
+			if err := r.Delete(ctx, pvc); client.IgnoreNotFound(err) != nil {
+				return fmt.Errorf("failed to delete netclient PVC %s: %w", pvcName, err)
+			}
+			logger.Info("Deleted netclient PVC", "pod", client.ObjectKeyFromObject(pod), "pvc", pvcName)
+			cleaned = append(cleaned, "claim "+pvcName)
+		}
+	}
+
+	if r.Netmaker != nil {
+		hostID, err := r.deregisterHost(ctx, pod)
+		if err != nil {
+			return err
+		}
+		if hostID != "" {
+			cleaned = append(cleaned, "Netmaker host "+hostID)
+		}
+	}
+
+	if len(cleaned) > 0 {
+		r.Recorder.Eventf(pod, corev1.EventTypeNormal, eventReasonNetclientCleanedUp,
+			"netclient was removed from the workload, deleted %s", strings.Join(cleaned, ", "))
+	}
+	return nil
+}
+
+// deregisterHost deletes the Netmaker host the pod's sidecar enrolled and returns its ID, "" when none was deleted
+// The annotation alone isn't trusted: the host must still belong to the pod in Netmaker, see netclientHostOwnedBy,
+// and the pod must run the operator's netclient image, otherwise it could have reported any host
+func (r *NetclientCleanupReconciler) deregisterHost(ctx context.Context, pod *corev1.Pod) (string, error) {
+	logger := log.FromContext(ctx)
+	hostID := pod.Annotations[NetclientHostIDAnnotation]
+	if hostID == "" {
+		r.Recorder.Event(pod, corev1.EventTypeWarning, eventReasonNetclientHostUnknown,
+			"netclient never reported its Netmaker host, so it is kept; remove it from Netmaker by hand")
+		return "", nil
+	}
+	if !runsOperatorNetclient(pod) {
+		r.Recorder.Eventf(pod, corev1.EventTypeWarning, eventReasonNetclientHostKept,
+			"netclient doesn't run the operator's image, so Netmaker host %s is kept; remove it from Netmaker by hand", hostID)
+		return "", nil
+	}
+
+	hosts, err := r.Netmaker.ListHosts(ctx)
+	if err != nil {
+		return "", err
+	}
+	for i := range hosts {
+		host := &hosts[i]
+		if host.ID != hostID {
+			continue
+		}
+		// A renamed host, or one without the pod IP, may belong to someone else by now
+		if !netclientHostOwnedBy(host, pod) {
+			r.Recorder.Eventf(pod, corev1.EventTypeWarning, eventReasonNetclientHostKept,
+				"Netmaker host %s is named %q and reports no interface with the pod IP, so it is kept", host.ID, host.Name)
+			return "", nil
+		}
+		if err := r.Netmaker.DeleteHost(ctx, host.ID); err != nil {
+			return "", fmt.Errorf("failed to delete Netmaker host %s: %w", host.ID, err)
+		}
+		logger.Info("Deregistered Netmaker host", "pod", client.ObjectKeyFromObject(pod), "host", host.ID)
+		return host.ID, nil
+	}
+	return "", nil
+}
+
+// hasNetclientContainer checks if a pod spec runs netclient, as a container or native sidecar
+func hasNetclientContainer(podSpec *corev1.PodSpec) bool {
+	for _, containers := range [][]corev1.Container{podSpec.InitContainers, podSpec.Containers} {
+		for _, container := range containers {
+			if container.Name == "netclient" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SetupWithManager sets up the controller with the Manager
+func (r *NetclientCleanupReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("netclient-cleanup").
+		For(&corev1.Pod{}, builder.WithPredicates(predicate.NewPredicateFuncs(func(obj client.Object) bool {
+			pod := obj.(*corev1.Pod)
+			return isInjectedPod(pod) || controllerutil.ContainsFinalizer(pod, netclientCleanupFinalizer)
+		}))).
+		Complete(r)
+}
@@ -0,0 +1,252 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/gravitl/netmaker/models"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/gravitl/netmaker-k8s-ops/internal/netmakerapi"
+)
+
+var _ = Describe("Netclient cleanup", func() {
+	var (
+		hosts    []models.ApiHost
+		deleted  []string
+		recorder *record.FakeRecorder
+		api      *netmakerapi.Client
+		ctx      = context.Background()
+	)
+
+	BeforeEach(func() {
+		hosts, deleted = nil, nil
+		recorder = record.NewFakeRecorder(10)
+		mux := http.NewServeMux()
+		mux.HandleFunc("GET /api/hosts", func(w http.ResponseWriter, _ *http.Request) {
+			_ = json.NewEncoder(w).Encode(hosts)
+		})
+		mux.HandleFunc("DELETE /api/hosts/{id}", func(w http.ResponseWriter, req *http.Request) {
+			deleted = append(deleted, req.PathValue("id"))
+			_, _ = w.Write([]byte("{}"))
+		})
+		server := httptest.NewServer(mux)
+		DeferCleanup(server.Close)
+		api = netmakerapi.NewClient(server.URL, "master-key", false)
+	})
+
+	newReconciler := func(objects ...client.Object) (*NetclientCleanupReconciler, client.Client) {
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(objects...).Build()
+		return &NetclientCleanupReconciler{Client: c, Scheme: c.Scheme(), Recorder: recorder, APIReader: c, Netmaker: api}, c
+	}
+	podTemplate := func(containers ...string) corev1.PodTemplateSpec {
+		template := corev1.PodTemplateSpec{}
+		for _, name := range containers {
+			template.Spec.Containers = append(template.Spec.Containers, corev1.Container{Name: name, Image: name})
+		}
+		return template
+	}
+	deployment := func(containers ...string) []client.Object {
+		controller := true
+		return []client.Object{
+			&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+				Spec: appsv1.DeploymentSpec{Template: podTemplate(containers...)}},
+			&appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Name: "web-5d4f", Namespace: "default",
+				OwnerReferences: []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "Deployment", Name: "web", Controller: &controller}}}},
+		}
+	}
+	injectedPod := func(annotations map[string]string) *corev1.Pod {
+		controller := true
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "web-5d4f-x2k9", Namespace: "default", Annotations: annotations,
+				OwnerReferences: []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: "web-5d4f", Controller: &controller}}},
+			Spec:   podTemplate("app", "netclient").Spec,
+			Status: corev1.PodStatus{PodIP: "10.244.1.5", PodIPs: []corev1.PodIP{{IP: "10.244.1.5"}}},
+		}
+		pod.Spec.Containers[1].Image = "gravitl/netclient:v1.4.0"
+		return pod
+	}
+	podIface := []models.ApiIface{{Name: "eth0", AddressString: "10.244.1.5/24"}}
+	deleting := func(pod *corev1.Pod) *corev1.Pod {
+		now := metav1.Now()
+		pod.DeletionTimestamp = &now
+		pod.Finalizers = []string{netclientCleanupFinalizer}
+		return pod
+	}
+	reconcile := func(r *NetclientCleanupReconciler, pod *corev1.Pod) {
+		_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(pod)})
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	DescribeTable("adds the finalizer",
+		func(annotations map[string]string, expected bool) {
+			pod := injectedPod(annotations)
+			r, c := newReconciler(pod)
+			reconcile(r, pod)
+
+			updated := &corev1.Pod{}
+			Expect(c.Get(ctx, client.ObjectKeyFromObject(pod), updated)).To(Succeed())
+			if expected {
+				Expect(updated.Finalizers).To(ConsistOf(netclientCleanupFinalizer))
+			} else {
+				Expect(updated.Finalizers).To(BeEmpty())
+			}
+		},
+		Entry("to pods injected through their template", map[string]string{NetclientInjectedResourcesAnnotation: "{}"}, true),
+		Entry("to pods injected directly", map[string]string{InjectedAnnotation: "{}"}, true),
+		Entry("not to pods that run their own netclient", nil, false),
+	)
+
+	It("deregisters the recorded host once the workload dropped the sidecar", func() {
+		hosts = []models.ApiHost{
+			{ID: "recorded", Name: "web-5d4f-x2k9", Interfaces: podIface},
+			{ID: "same-name", Name: "web-5d4f-x2k9", Interfaces: podIface},
+		}
+		pod := deleting(injectedPod(map[string]string{
+			NetclientInjectedResourcesAnnotation: "{}",
+			NetclientHostIDAnnotation:            "recorded",
+		}))
+		r, c := newReconciler(append(deployment("app"), pod)...)
+		reconcile(r, pod)
+
+		Expect(deleted).To(ConsistOf("recorded"))
+		Expect(recorder.Events).To(Receive(HavePrefix("Normal " + eventReasonNetclientCleanedUp)))
+		err := c.Get(ctx, client.ObjectKeyFromObject(pod), &corev1.Pod{})
+		Expect(errors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("keeps a recorded host that carries another name", func() {
+		hosts = []models.ApiHost{{ID: "recorded", Name: "renamed", Interfaces: podIface}}
+		pod := deleting(injectedPod(map[string]string{
+			NetclientInjectedResourcesAnnotation: "{}",
+			NetclientHostIDAnnotation:            "recorded",
+		}))
+		r, _ := newReconciler(append(deployment("app"), pod)...)
+		reconcile(r, pod)
+
+		Expect(deleted).To(BeEmpty())
+		Expect(recorder.Events).To(Receive(HavePrefix("Warning " + eventReasonNetclientHostKept)))
+	})
+
+	It("keeps a recorded host that doesn't report the pod IP", func() {
+		hosts = []models.ApiHost{{ID: "recorded", Name: "web-5d4f-x2k9", Interfaces: []models.ApiIface{{Name: "eth0", AddressString: "10.244.2.9/24"}}}}
+		pod := deleting(injectedPod(map[string]string{
+			NetclientInjectedResourcesAnnotation: "{}",
+			NetclientHostIDAnnotation:            "recorded",
+		}))
+		r, _ := newReconciler(append(deployment("app"), pod)...)
+		reconcile(r, pod)
+
+		Expect(deleted).To(BeEmpty())
+		Expect(recorder.Events).To(Receive(HavePrefix("Warning " + eventReasonNetclientHostKept)))
+	})
+
+	It("keeps the host of a pod that runs its own netclient image", func() {
+		hosts = []models.ApiHost{{ID: "recorded", Name: "web-5d4f-x2k9", Interfaces: podIface}}
+		pod := deleting(injectedPod(map[string]string{
+			NetclientInjectedResourcesAnnotation: "{}",
+			NetclientHostIDAnnotation:            "recorded",
+		}))
+		pod.Spec.Containers[1].Image = "example.com/netclient:custom"
+		r, _ := newReconciler(append(deployment("app"), pod)...)
+		reconcile(r, pod)
+
+		Expect(deleted).To(BeEmpty())
+		Expect(recorder.Events).To(Receive(HavePrefix("Warning " + eventReasonNetclientHostKept)))
+	})
+
+	It("never deletes hosts by name alone", func() {
+		hosts = []models.ApiHost{{ID: "same-name", Name: "web-5d4f-x2k9", Interfaces: podIface}}
+		pod := deleting(injectedPod(map[string]string{NetclientInjectedResourcesAnnotation: "{}"}))
+		r, _ := newReconciler(append(deployment("app"), pod)...)
+		reconcile(r, pod)
+
+		Expect(deleted).To(BeEmpty())
+		Expect(recorder.Events).To(Receive(HavePrefix("Warning " + eventReasonNetclientHostUnknown)))
+	})
+
+	It("keeps the host while the workload still injects netclient", func() {
+		hosts = []models.ApiHost{{ID: "recorded", Name: "web-5d4f-x2k9", Interfaces: podIface}}
+		pod := deleting(injectedPod(map[string]string{
+			NetclientInjectedResourcesAnnotation: "{}",
+			NetclientHostIDAnnotation:            "recorded",
+		}))
+		r, c := newReconciler(append(deployment("app", "netclient"), pod)...)
+		reconcile(r, pod)
+
+		Expect(deleted).To(BeEmpty())
+		err := c.Get(ctx, types.NamespacedName{Name: pod.Name, Namespace: pod.Namespace}, &corev1.Pod{})
+		Expect(errors.IsNotFound(err)).To(BeTrue())
+	})
+
+	Context("with a configured kind", func() {
+		rolloutKind := schema.GroupVersionKind{Group: "argoproj.io", Version: "v1alpha1", Kind: "Rollout"}
+		rollout := func(containers ...string) client.Object {
+			template, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&corev1.PodTemplateSpec{Spec: podTemplate(containers...).Spec})
+			Expect(err).NotTo(HaveOccurred())
+			object := &unstructured.Unstructured{Object: map[string]interface{}{
+				"metadata": map[string]interface{}{"name": "web", "namespace": "default"},
+				"spec":     map[string]interface{}{"template": template},
+			}}
+			object.SetGroupVersionKind(rolloutKind)
+			return object
+		}
+		rolloutReplicaSet := func() client.Object {
+			controller := true
+			return &appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Name: "web-5d4f", Namespace: "default",
+				OwnerReferences: []metav1.OwnerReference{{APIVersion: "argoproj.io/v1alpha1", Kind: "Rollout", Name: "web", Controller: &controller}}}}
+		}
+		cleanedUp := func(objects ...client.Object) bool {
+			hosts = []models.ApiHost{{ID: "recorded", Name: "web-5d4f-x2k9", Interfaces: podIface}}
+			pod := deleting(injectedPod(map[string]string{
+				NetclientInjectedResourcesAnnotation: "{}",
+				NetclientHostIDAnnotation:            "recorded",
+			}))
+			r, _ := newReconciler(append(objects, pod)...)
+			r.PodTemplateOwners = []PodTemplateOwner{{GroupVersionKind: rolloutKind, Fields: []string{"spec", "template"}}}
+			reconcile(r, pod)
+			return len(deleted) > 0
+		}
+
+		It("follows ReplicaSets to the Rollout template", func() {
+			Expect(cleanedUp(rollout("app"), rolloutReplicaSet())).To(BeTrue())
+		})
+
+		It("keeps the host while the Rollout still injects netclient", func() {
+			Expect(cleanedUp(rollout("app", "netclient"), rolloutReplicaSet())).To(BeFalse())
+		})
+	})
+})
@@ -0,0 +1,360 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+const (
+	// NetclientStatusPortAnnotation is set by the sidecar webhook to the port the netclient sidecar serves its status on
+	NetclientStatusPortAnnotation = "netmaker.io/netclient-status-port"
+	// NetclientHostIDAnnotation records the Netmaker host ID the sidecar reports in its status
+	// The static IP and cleanup controllers find the pod's host by it instead of by host name; only the operator sets it
+	NetclientHostIDAnnotation = "netmaker.io/netclient-host-id"
+	// netclientConnectedCondition is the pod condition (and readiness gate) reporting the sidecar's connection
+	netclientConnectedCondition corev1.PodConditionType = "netmaker.io/netclient-connected"
+
+	// netclientHandshakeTimeout is how old the latest WireGuard handshake of a peer may be for it to count as connected
+	// WireGuard renews sessions every 2 minutes while packets flow, and Netmaker peers send keepalives
+	netclientHandshakeTimeout = 3 * time.Minute
+	// netclientHealthResync is how often the sidecar status is read
+	netclientHealthResync = 30 * time.Second
+	// netclientStatusTimeout bounds a single status request
+	netclientStatusTimeout = 5 * time.Second
+)
+
+var (
+	netclientConnected = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "netmaker_netclient_connected",
+		Help: "Whether the netclient sidecar has an address and a recent handshake with at least one peer",
+	}, []string{"namespace", "pod"})
+	netclientPeers = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "netmaker_netclient_peers",
+		Help: "WireGuard peers of the netclient sidecar",
+	}, []string{"namespace", "pod"})
+	netclientConnectedPeers = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "netmaker_netclient_connected_peers",
+		Help: "WireGuard peers of the netclient sidecar with a recent handshake",
+	}, []string{"namespace", "pod"})
+	netclientHandshakeAge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "netmaker_netclient_last_handshake_age_seconds",
+		Help: "Seconds since the latest WireGuard handshake of the netclient sidecar with any peer",
+	}, []string{"namespace", "pod"})
+	netclientInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "netmaker_netclient_info",
+		Help: "Netmaker host ID and addresses of the netclient sidecar",
+	}, []string{"namespace", "pod", "host_id", "address"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(netclientConnected, netclientPeers, netclientConnectedPeers, netclientHandshakeAge, netclientInfo)
+}
+
+// netclientStatus is what a netclient sidecar reports about its Netmaker connection
+type netclientStatus struct {
+	// Now is when the sidecar wrote the status, handshake ages are relative to it
+	Now        time.Time
+	HostID     string
+	Addresses  []string
+	Handshakes []time.Time
+}
+
+// connectedPeers returns the number of peers with a handshake within netclientHandshakeTimeout,
+// and the age of the latest handshake (-1 without any)
+func (s *netclientStatus) connectedPeers() (int, time.Duration) {
+	connected := 0
+	latest := time.Duration(-1)
+	for _, handshake := range s.Handshakes {
+		if handshake.IsZero() {
+			continue
+		}
+		age := s.Now.Sub(handshake)
+		if age < 0 {
+			age = 0
+		}
+		if age <= netclientHandshakeTimeout {
+			connected++
+		}
+		if latest < 0 || age < latest {
+			latest = age
+		}
+	}
+	return connected, latest
+}
+
+// NetclientHealthReconciler reports the Netmaker connection of injected netclient sidecars
+// The sidecars serve their host ID, addresses and handshake times on the port in netmaker.io/netclient-status-port;
+// the result becomes the netmaker.io/netclient-connected pod condition and Prometheus metrics
+type NetclientHealthReconciler struct {
+	client.Client
+	Scheme     *runtime.Scheme
+	HTTPClient *http.Client
+}
+
+// +kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch;patch
+// +kubebuilder:rbac:groups="",resources=pods/status,verbs=get;patch
+
+// Reconcile reads the sidecar status of a pod and records it
+func (r *NetclientHealthReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	pod := &corev1.Pod{}
+	if err := r.Get(ctx, req.NamespacedName, pod); err != nil {
+		deleteNetclientMetrics(req.Namespace, req.Name)
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	port, err := strconv.Atoi(pod.Annotations[NetclientStatusPortAnnotation])
+	if pod.DeletionTimestamp != nil || err != nil || port < 1 || port > 65535 ||
+		pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+		deleteNetclientMetrics(pod.Namespace, pod.Name)
+		return ctrl.Result{}, nil
+	}
+	if pod.Status.PodIP == "" {
+		// Not scheduled or not started yet, the IP update triggers another reconcile
+		return ctrl.Result{}, nil
+	}
+
+	condition := corev1.PodCondition{Type: netclientConnectedCondition}
+	status, err := r.readStatus(ctx, net.JoinHostPort(pod.Status.PodIP, strconv.Itoa(port)))
+	if err != nil {
+		logger.V(1).Info("Failed to read netclient status", "pod", req.NamespacedName, "error", err.Error())
+		deleteNetclientMetrics(pod.Namespace, pod.Name)
+		netclientConnected.WithLabelValues(pod.Namespace, pod.Name).Set(0)
+		condition.Status = corev1.ConditionFalse
+		condition.Reason = "StatusUnavailable"
+		condition.Message = fmt.Sprintf("netclient status could not be read: %v", err)
+	} else {
+		r.recordMetrics(pod, status)
+		condition.Status, condition.Reason, condition.Message = netclientCondition(status)
+		if err := r.recordHostID(ctx, pod, status.HostID); err != nil {
+			logger.Error(err, "Failed to record netclient host ID", "pod", req.NamespacedName)
+			return ctrl.Result{}, err
+		}
+	}
+
+	if err := r.setCondition(ctx, pod, condition); err != nil {
+		logger.Error(err, "Failed to update netclient condition", "pod", req.NamespacedName)
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{RequeueAfter: netclientHealthResync}, nil
+}
+
+// readStatus fetches and parses the status served by a sidecar
+func (r *NetclientHealthReconciler) readStatus(ctx context.Context, address string) (*netclientStatus, error) {
+	ctx, cancel := context.WithTimeout(ctx, netclientStatusTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+address+"/", nil)
+	if err != nil {
+		return nil, err
+	}
+	httpClient := r.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status server returned %s", resp.Status)
+	}
+	return parseNetclientStatus(io.LimitReader(resp.Body, 64*1024))
+}
+
+// parseNetclientStatus parses the key=value lines served by the sidecar
+// Handshake lines hold a Unix time, 0 when the peer never completed a handshake; sidecars injected
+// by earlier versions put the peer public key in front of it
+func parseNetclientStatus(r io.Reader) (*netclientStatus, error) {
+	status := &netclientStatus{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "now":
+			seconds, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid time %q", value)
+			}
+			status.Now = time.Unix(seconds, 0)
+		case "host_id":
+			status.HostID = value
+		case "address":
+			status.Addresses = append(status.Addresses, value)
+		case "handshake":
+			fields := strings.Fields(value)
+			if len(fields) != 1 && len(fields) != 2 {
+				return nil, fmt.Errorf("invalid handshake %q", value)
+			}
+			seconds, err := strconv.ParseInt(fields[len(fields)-1], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid handshake time %q", fields[len(fields)-1])
+			}
+			handshake := time.Time{}
+			if seconds > 0 {
+				handshake = time.Unix(seconds, 0)
+			}
+			status.Handshakes = append(status.Handshakes, handshake)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if status.Now.IsZero() {
+		return nil, fmt.Errorf("status has no time")
+	}
+	return status, nil
+}
+
+// netclientCondition turns a sidecar status into the condition status, reason and message
+// The message leaves out the handshake age, so the pod is only patched when something changes
+func netclientCondition(status *netclientStatus) (corev1.ConditionStatus, string, string) {
+	connected, _ := status.connectedPeers()
+	host := status.HostID
+	if host == "" {
+		host = "unknown"
+	}
+	switch {
+	case len(status.Addresses) == 0:
+		return corev1.ConditionFalse, "NoAddress", fmt.Sprintf("host %s has no address on the netmaker interface", host)
+	case connected == 0:
+		return corev1.ConditionFalse, "NoHandshake", fmt.Sprintf("host %s (%s) has no handshake with any of %d peers in the last %s",
+			host, strings.Join(status.Addresses, ", "), len(status.Handshakes), netclientHandshakeTimeout)
+	default:
+		return corev1.ConditionTrue, "Connected", fmt.Sprintf("host %s (%s) is connected to %d of %d peers",
+			host, strings.Join(status.Addresses, ", "), connected, len(status.Handshakes))
+	}
+}
+
+// recordMetrics exports a sidecar status as Prometheus metrics
+func (r *NetclientHealthReconciler) recordMetrics(pod *corev1.Pod, status *netclientStatus) {
+	connected, latest := status.connectedPeers()
+	isConnected := 0.0
+	if len(status.Addresses) > 0 && connected > 0 {
+		isConnected = 1
+	}
+	netclientConnected.WithLabelValues(pod.Namespace, pod.Name).Set(isConnected)
+	netclientPeers.WithLabelValues(pod.Namespace, pod.Name).Set(float64(len(status.Handshakes)))
+	netclientConnectedPeers.WithLabelValues(pod.Namespace, pod.Name).Set(float64(connected))
+	if latest >= 0 {
+		netclientHandshakeAge.WithLabelValues(pod.Namespace, pod.Name).Set(latest.Seconds())
+	} else {
+		netclientHandshakeAge.DeleteLabelValues(pod.Namespace, pod.Name)
+	}
+	// The host or addresses may have changed, so drop the previous info series first
+	netclientInfo.DeletePartialMatch(prometheus.Labels{"namespace": pod.Namespace, "pod": pod.Name})
+	netclientInfo.WithLabelValues(pod.Namespace, pod.Name, status.HostID, strings.Join(status.Addresses, ",")).Set(1)
+}
+
+// deleteNetclientMetrics removes the metrics of a pod that is gone or no longer reports its status
+func deleteNetclientMetrics(namespace, name string) {
+	labels := prometheus.Labels{"namespace": namespace, "pod": name}
+	for _, vec := range []*prometheus.GaugeVec{netclientConnected, netclientPeers, netclientConnectedPeers, netclientHandshakeAge, netclientInfo} {
+		vec.DeletePartialMatch(labels)
+	}
+}
+
+// recordHostID stores the host ID from the sidecar status in the pod's netmaker.io/netclient-host-id annotation
+// The status is only trusted from the operator's own netclient image, a pod running another image could report
+// the ID of any host. A sidecar that enrolls again after a restart replaces the recorded ID.
+func (r *NetclientHealthReconciler) recordHostID(ctx context.Context, pod *corev1.Pod, hostID string) error {
+	if hostID == "" || pod.Annotations[NetclientHostIDAnnotation] == hostID || !runsOperatorNetclient(pod) {
+		return nil
+	}
+	patch := client.MergeFrom(pod.DeepCopy())
+	if pod.Annotations == nil {
+		pod.Annotations = map[string]string{}
+	}
+	pod.Annotations[NetclientHostIDAnnotation] = hostID
+	return r.Patch(ctx, pod, patch)
+}
+
+// runsOperatorNetclient checks that the pod's netclient container runs the image the operator injects (NETCLIENT_IMAGE)
+// Workloads can pick another image with netmaker.io/netclient-image, and then serve any status they like
+func runsOperatorNetclient(pod *corev1.Pod) bool {
+	netclient := findNetclientContainer(pod)
+	return netclient != nil && netclient.Image == getEnvOrDefault("NETCLIENT_IMAGE", "gravitl/netclient:v1.4.0")
+}
+
+// setCondition updates the pod condition when its status, reason or message changed
+func (r *NetclientHealthReconciler) setCondition(ctx context.Context, pod *corev1.Pod, condition corev1.PodCondition) error {
+	for _, existing := range pod.Status.Conditions {
+		if existing.Type != condition.Type {
+			continue
+		}
+		if existing.Status == condition.Status && existing.Reason == condition.Reason && existing.Message == condition.Message {
+			return nil
+		}
+		condition.LastTransitionTime = existing.LastTransitionTime
+		if existing.Status != condition.Status {
+			condition.LastTransitionTime = metav1.Now()
+		}
+	}
+	if condition.LastTransitionTime.IsZero() {
+		condition.LastTransitionTime = metav1.Now()
+	}
+
+	// Conditions are merged by type, so the conditions kubelet owns are left alone
+	patch := client.StrategicMergeFrom(pod.DeepCopy())
+	updated := false
+	for i := range pod.Status.Conditions {
+		if pod.Status.Conditions[i].Type == condition.Type {
+			pod.Status.Conditions[i] = condition
+			updated = true
+		}
+	}
+	if !updated {
+		pod.Status.Conditions = append(pod.Status.Conditions, condition)
+	}
+	return r.Status().Patch(ctx, pod, patch)
+}
+
+// hasStatusPortAnnotation checks if a pod's sidecar serves its status
+func hasStatusPortAnnotation(obj client.Object) bool {
+	return obj.GetAnnotations()[NetclientStatusPortAnnotation] != ""
+}
+
+// SetupWithManager sets up the controller with the Manager
+func (r *NetclientHealthReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("netclient-health").
+		For(&corev1.Pod{}, builder.WithPredicates(predicate.NewPredicateFuncs(hasStatusPortAnnotation))).
+		Complete(r)
+}
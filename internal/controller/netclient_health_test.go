@@ -0,0 +1,147 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Netclient health", func() {
+	now := time.Unix(1700000000, 0)
+
+	It("parses the status served by the sidecar", func() {
+		status, err := parseNetclientStatus(strings.NewReader(strings.Join([]string{
+			"now=1700000000",
+			"host_id=3f0c2a",
+			"address=10.101.0.5/24",
+			"handshake=1699999990",
+			"handshake=0",
+			"ignored line",
+		}, "\n")))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status).To(Equal(&netclientStatus{
+			Now:        now,
+			HostID:     "3f0c2a",
+			Addresses:  []string{"10.101.0.5/24"},
+			Handshakes: []time.Time{time.Unix(1699999990, 0), {}},
+		}))
+	})
+
+	It("accepts the handshake lines of sidecars that still serve the peer keys", func() {
+		status, err := parseNetclientStatus(strings.NewReader("now=1700000000\nhandshake=cGVlcg== 1699999990\n"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status.Handshakes).To(Equal([]time.Time{time.Unix(1699999990, 0)}))
+	})
+
+	DescribeTable("rejects malformed status",
+		func(body string) {
+			_, err := parseNetclientStatus(strings.NewReader(body))
+			Expect(err).To(HaveOccurred())
+		},
+		Entry("without a time", "host_id=3f0c2a\n"),
+		Entry("with an invalid time", "now=yesterday\n"),
+		Entry("with an invalid handshake time", "now=1700000000\nhandshake=soon\n"),
+		Entry("with too many handshake fields", "now=1700000000\nhandshake=a b 1699999990\n"),
+	)
+
+	DescribeTable("connectedPeers",
+		func(handshakes []time.Time, expectedConnected int, expectedLatest time.Duration) {
+			status := &netclientStatus{Now: now, Handshakes: handshakes}
+			connected, latest := status.connectedPeers()
+			Expect(connected).To(Equal(expectedConnected))
+			Expect(latest).To(Equal(expectedLatest))
+		},
+		Entry("without peers", nil, 0, time.Duration(-1)),
+		Entry("with peers that never completed a handshake", []time.Time{{}, {}}, 0, time.Duration(-1)),
+		Entry("with a recent and a stale handshake",
+			[]time.Time{now.Add(-10 * time.Minute), now.Add(-30 * time.Second)}, 1, 30*time.Second),
+		Entry("with a handshake exactly at the timeout", []time.Time{now.Add(-netclientHandshakeTimeout)}, 1, netclientHandshakeTimeout),
+		Entry("with a handshake after the status was written", []time.Time{now.Add(time.Second)}, 1, time.Duration(0)),
+	)
+
+	DescribeTable("netclientCondition",
+		func(status *netclientStatus, expectedStatus corev1.ConditionStatus, expectedReason, expectedMessage string) {
+			conditionStatus, reason, message := netclientCondition(status)
+			Expect(conditionStatus).To(Equal(expectedStatus))
+			Expect(reason).To(Equal(expectedReason))
+			Expect(message).To(Equal(expectedMessage))
+		},
+		Entry("without an address",
+			&netclientStatus{Now: now, Handshakes: []time.Time{now}},
+			corev1.ConditionFalse, "NoAddress", "host unknown has no address on the netmaker interface"),
+		Entry("without a recent handshake",
+			&netclientStatus{Now: now, HostID: "3f0c2a", Addresses: []string{"10.101.0.5/24"}, Handshakes: []time.Time{{}, now.Add(-time.Hour)}},
+			corev1.ConditionFalse, "NoHandshake", "host 3f0c2a (10.101.0.5/24) has no handshake with any of 2 peers in the last 3m0s"),
+		Entry("with a recent handshake",
+			&netclientStatus{Now: now, HostID: "3f0c2a", Addresses: []string{"10.101.0.5/24"}, Handshakes: []time.Time{{}, now.Add(-time.Minute)}},
+			corev1.ConditionTrue, "Connected", "host 3f0c2a (10.101.0.5/24) is connected to 1 of 2 peers"),
+	)
+
+	Context("recording the host ID", func() {
+		var pod *corev1.Pod
+
+		BeforeEach(func() {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				_, _ = fmt.Fprintf(w, "now=%d\nhost_id=3f0c2a\naddress=10.101.0.5/24\n", time.Now().Unix())
+			}))
+			DeferCleanup(server.Close)
+			host, port, err := net.SplitHostPort(server.Listener.Addr().String())
+			Expect(err).NotTo(HaveOccurred())
+			pod = &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default",
+					Annotations: map[string]string{NetclientStatusPortAnnotation: port}},
+				Spec:   corev1.PodSpec{Containers: []corev1.Container{{Name: "netclient", Image: "gravitl/netclient:v1.4.0"}}},
+				Status: corev1.PodStatus{Phase: corev1.PodRunning, PodIP: host},
+			}
+		})
+
+		recordedHostID := func() string {
+			c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(pod).WithStatusSubresource(pod).Build()
+			r := &NetclientHealthReconciler{Client: c, Scheme: c.Scheme()}
+			_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(pod)})
+			Expect(err).NotTo(HaveOccurred())
+			updated := &corev1.Pod{}
+			Expect(c.Get(context.Background(), client.ObjectKeyFromObject(pod), updated)).To(Succeed())
+			return updated.Annotations[NetclientHostIDAnnotation]
+		}
+
+		It("records the ID reported by the operator's netclient image", func() {
+			Expect(recordedHostID()).To(Equal("3f0c2a"))
+		})
+
+		It("ignores the ID reported by an overridden image", func() {
+			pod.Spec.Containers[0].Image = "example.com/netclient:custom"
+			Expect(recordedHostID()).To(BeEmpty())
+		})
+	})
+})
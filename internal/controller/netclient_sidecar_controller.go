@@ -0,0 +1,296 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// These annotations are set by the sidecar webhook (internal/webhook) on pods it injected netclient into
+const (
+	// NetclientPVCAnnotation names the claim holding the pod's netclient state
+	NetclientPVCAnnotation = "netmaker.io/netclient-pvc"
+	// TokenSourceAnnotation is the "<namespace>/<name>" secret to mirror as the pod's token secret,
+	// or tokenSourceEnv to fill it from the operator's NETCLIENT_TOKEN
+	TokenSourceAnnotation = "netmaker.io/netclient-token-source"
+	tokenSourceEnv        = "NETCLIENT_TOKEN"
+	// mirroredFromAnnotation records which secret a token secret was copied from
+	mirroredFromAnnotation = "netmaker.io/mirrored-from"
+	// sidecarManagedBy is the managed-by label value for objects created for injected sidecars
+	sidecarManagedBy = "netmaker-k8s-ops-webhook"
+
+	eventReasonTokenSourceRejected = "TokenSourceRejected"
+)
+
+// NetclientSidecarReconciler creates the PVCs and token secrets injected netclient sidecars depend on
+// The webhook only references them, so admission has no side effects and dry-run requests create nothing
+type NetclientSidecarReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+}
+
+// +kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=persistentvolumeclaims,verbs=get;list;watch;create
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+
+// Reconcile ensures the resources referenced by an injected pod exist
+func (r *NetclientSidecarReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	pod := &corev1.Pod{}
+	if err := r.Get(ctx, req.NamespacedName, pod); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if pod.DeletionTimestamp != nil {
+		return ctrl.Result{}, nil
+	}
+
+	if pvcName := pod.Annotations[NetclientPVCAnnotation]; pvcName != "" {
+		if err := r.ensureNetclientPVC(ctx, pvcName, pod.Namespace); err != nil {
+			logger.Error(err, "Failed to ensure netclient PVC", "pod", req.NamespacedName, "pvc", pvcName)
+			return ctrl.Result{}, err
+		}
+	}
+
+	if source := pod.Annotations[TokenSourceAnnotation]; source != "" {
+		// Anyone who can create a pod sets the annotation, so only the configured token secret is copied
+		if err := checkTokenSource(pod, source); err != nil {
+			logger.Info("Rejected netclient token source", "pod", req.NamespacedName, "source", source, "reason", err.Error())
+			r.Recorder.Event(pod, corev1.EventTypeWarning, eventReasonTokenSourceRejected, err.Error())
+			return ctrl.Result{}, nil
+		}
+		if err := r.ensureTokenSecret(ctx, pod, source); err != nil {
+			logger.Error(err, "Failed to ensure netclient token secret", "pod", req.NamespacedName, "source", source)
+			return ctrl.Result{}, err
+		}
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// ensureNetclientPVC creates the claim for a pod's netclient state if it doesn't exist
+func (r *NetclientSidecarReconciler) ensureNetclientPVC(ctx context.Context, pvcName, namespace string) error {
+	logger := log.FromContext(ctx)
+
+	pvc := &corev1.PersistentVolumeClaim{}
+	err := r.Get(ctx, types.NamespacedName{Name: pvcName, Namespace: namespace}, pvc)
+	if err == nil || !errors.IsNotFound(err) {
+		return err
+	}
+
+	// Get PVC configuration from environment variables or use defaults
+	storageSize := getEnvOrDefault("NETCLIENT_PVC_STORAGE_SIZE", "1Gi")
+	storageClass := getEnvOrDefault("NETCLIENT_PVC_STORAGE_CLASS", "") // Empty means use default
+
+	pvc = &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      pvcName,
+			Namespace: namespace,
+			Labels: map[string]string{
+				"app.kubernetes.io/component":  "netclient",
+				"app.kubernetes.io/managed-by": sidecarManagedBy,
+			},
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes: []corev1.PersistentVolumeAccessMode{
+				corev1.ReadWriteOnce,
+			},
+			Resources: corev1.VolumeResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceStorage: resource.MustParse(storageSize),
+				},
+			},
+		},
+	}
+	if storageClass != "" {
+		pvc.Spec.StorageClassName = &storageClass
+	}
+
+	if err := r.Create(ctx, pvc); err != nil && !errors.IsAlreadyExists(err) {
+		return fmt.Errorf("failed to create PVC %s in namespace %s: %w", pvcName, namespace, err)
+	}
+	logger.Info("Created netclient PVC", "pvc", pvcName, "namespace", namespace, "storageSize", storageSize)
+	return nil
+}
+
+// ensureTokenSecret creates or refreshes the token secret the pod's netclient container references
+func (r *NetclientSidecarReconciler) ensureTokenSecret(ctx context.Context, pod *corev1.Pod, source string) error {
+	logger := log.FromContext(ctx)
+
+	ref := findTokenSecretRef(pod)
+	if ref == nil {
+		return fmt.Errorf("netclient container has no TOKEN secret reference")
+	}
+
+	var token []byte
+	if source == tokenSourceEnv {
+		token = []byte(getEnvOrDefault("NETCLIENT_TOKEN", ""))
+		if len(token) == 0 {
+			return fmt.Errorf("NETCLIENT_TOKEN is not set")
+		}
+	} else {
+		namespace, name, _ := strings.Cut(source, "/")
+		sourceSecret := &corev1.Secret{}
+		if err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, sourceSecret); err != nil {
+			return fmt.Errorf("failed to get source secret %s: %w", source, err)
+		}
+		var ok bool
+		if token, ok = sourceSecret.Data[ref.Key]; !ok {
+			return fmt.Errorf("key %s not found in secret %s", ref.Key, source)
+		}
+	}
+
+	secret := &corev1.Secret{}
+	err := r.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: pod.Namespace}, secret)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	if errors.IsNotFound(err) {
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      ref.Name,
+				Namespace: pod.Namespace,
+				Labels: map[string]string{
+					"app.kubernetes.io/component":  "netclient",
+					"app.kubernetes.io/managed-by": sidecarManagedBy,
+				},
+				Annotations: map[string]string{
+					mirroredFromAnnotation: source,
+				},
+			},
+			Type: corev1.SecretTypeOpaque,
+			Data: map[string][]byte{ref.Key: token},
+		}
+		if err := r.Create(ctx, secret); err != nil && !errors.IsAlreadyExists(err) {
+			return fmt.Errorf("failed to create token secret %s/%s: %w", pod.Namespace, ref.Name, err)
+		}
+		logger.Info("Created netclient token secret", "secret", ref.Name, "namespace", pod.Namespace, "source", source)
+		return nil
+	}
+
+	// Never overwrite a secret the operator didn't create
+	if secret.Labels["app.kubernetes.io/managed-by"] != sidecarManagedBy {
+		return fmt.Errorf("secret %s/%s exists and is not managed by the netclient webhook", pod.Namespace, ref.Name)
+	}
+	if bytes.Equal(secret.Data[ref.Key], token) {
+		return nil
+	}
+	if secret.Data == nil {
+		secret.Data = map[string][]byte{}
+	}
+	secret.Data[ref.Key] = token
+	if err := r.Update(ctx, secret); err != nil {
+		return fmt.Errorf("failed to update token secret %s/%s: %w", pod.Namespace, ref.Name, err)
+	}
+	logger.Info("Updated netclient token secret", "secret", ref.Name, "namespace", pod.Namespace, "source", source)
+	return nil
+}
+
+// checkTokenSource checks that a pod's token source names the configured token secret and key
+// Only the operator's NETCLIENT_TOKEN or the NETCLIENT_SECRET_NAME secret of the pod or operator namespace
+// is copied, and only into the secret the webhook references for that source
+func checkTokenSource(pod *corev1.Pod, source string) error {
+	secretName := getEnvOrDefault("NETCLIENT_SECRET_NAME", "netclient-token")
+	secretKey := getEnvOrDefault("NETCLIENT_SECRET_KEY", "token")
+	operatorNamespace := getEnvOrDefault("OPERATOR_NAMESPACE", "netmaker-k8s-ops-system")
+
+	ref := findTokenSecretRef(pod)
+	if ref == nil {
+		return fmt.Errorf("netclient container has no TOKEN secret reference")
+	}
+	if ref.Key != secretKey {
+		return fmt.Errorf("token secret key %s is not the configured key %s", ref.Key, secretKey)
+	}
+	if source == tokenSourceEnv {
+		if ref.Name != secretName && ref.Name != mirroredSecretName(secretName, operatorNamespace) {
+			return fmt.Errorf("token secret %s is not the configured secret %s", ref.Name, secretName)
+		}
+		return nil
+	}
+
+	namespace, name, ok := strings.Cut(source, "/")
+	if !ok {
+		return fmt.Errorf("invalid %s value %q", TokenSourceAnnotation, source)
+	}
+	if name != secretName {
+		return fmt.Errorf("token source %s is not the configured secret %s", source, secretName)
+	}
+	if namespace != pod.Namespace && namespace != operatorNamespace {
+		return fmt.Errorf("token source %s is neither in the pod namespace nor in the operator namespace %s", source, operatorNamespace)
+	}
+	if ref.Name != mirroredSecretName(name, namespace) {
+		return fmt.Errorf("token secret %s is not the copy %s of %s", ref.Name, mirroredSecretName(name, namespace), source)
+	}
+	return nil
+}
+
+// mirroredSecretName returns the name of the copy of a token secret from another namespace, see the webhook
+func mirroredSecretName(secretName, secretNamespace string) string {
+	name := fmt.Sprintf("%s-%s", secretName, secretNamespace)
+	if len(name) > 253 {
+		name = name[:253]
+	}
+	return name
+}
+
+// findTokenSecretRef returns the secret reference of the netclient container's TOKEN variable
+func findTokenSecretRef(pod *corev1.Pod) *corev1.SecretKeySelector {
+	containers := append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...)
+	for _, container := range containers {
+		if container.Name != "netclient" {
+			continue
+		}
+		for _, env := range container.Env {
+			if env.Name == "TOKEN" && env.ValueFrom != nil && env.ValueFrom.SecretKeyRef != nil {
+				return env.ValueFrom.SecretKeyRef
+			}
+		}
+	}
+	return nil
+}
+
+// hasSidecarResourceAnnotations checks if a pod references resources the controller has to create
+func hasSidecarResourceAnnotations(obj client.Object) bool {
+	annotations := obj.GetAnnotations()
+	return annotations[NetclientPVCAnnotation] != "" || annotations[TokenSourceAnnotation] != ""
+}
+
+// SetupWithManager sets up the controller with the Manager
+func (r *NetclientSidecarReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("netclient-sidecar").
+		For(&corev1.Pod{}, builder.WithPredicates(predicate.NewPredicateFuncs(hasSidecarResourceAnnotations))).
+		Complete(r)
+}
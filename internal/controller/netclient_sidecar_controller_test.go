@@ -0,0 +1,108 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Netclient sidecar token secret", func() {
+	const operatorNamespace = "netmaker-k8s-ops-system"
+
+	// injectedPod returns a pod whose netclient reads TOKEN from secretName/key and asks for it to be copied from source
+	injectedPod := func(source, secretName, key string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "app",
+				Namespace:   "default",
+				Annotations: map[string]string{TokenSourceAnnotation: source},
+			},
+			Spec: corev1.PodSpec{Containers: []corev1.Container{
+				{Name: "app", Image: "nginx"},
+				{Name: "netclient", Env: []corev1.EnvVar{{
+					Name: "TOKEN",
+					ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{Name: secretName},
+						Key:                  key,
+					}},
+				}}},
+			}},
+		}
+	}
+	secret := func(namespace, name, key string) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Data:       map[string][]byte{key: []byte("secret-" + name)},
+		}
+	}
+
+	reconcile := func(pod *corev1.Pod) (*NetclientSidecarReconciler, *record.FakeRecorder) {
+		recorder := record.NewFakeRecorder(10)
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+			pod,
+			secret(operatorNamespace, "netclient-token", "token"),
+			secret(operatorNamespace, "webhook-certs", "tls.key"),
+			secret("kube-system", "netclient-token", "token"),
+		).Build()
+		r := &NetclientSidecarReconciler{Client: c, Scheme: scheme.Scheme, Recorder: recorder}
+		_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "app"}})
+		Expect(err).NotTo(HaveOccurred())
+		return r, recorder
+	}
+
+	It("copies the configured token secret from the operator namespace", func() {
+		r, recorder := reconcile(injectedPod(operatorNamespace+"/netclient-token", "netclient-token-"+operatorNamespace, "token"))
+
+		copied := &corev1.Secret{}
+		Expect(r.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "netclient-token-" + operatorNamespace}, copied)).To(Succeed())
+		Expect(copied.Data).To(HaveKeyWithValue("token", []byte("secret-netclient-token")))
+		Expect(copied.Annotations).To(HaveKeyWithValue(mirroredFromAnnotation, operatorNamespace+"/netclient-token"))
+		Expect(recorder.Events).To(BeEmpty())
+	})
+
+	DescribeTable("rejects token sources other than the configured secret and key",
+		func(source, secretName, key string) {
+			r, recorder := reconcile(injectedPod(source, secretName, key))
+
+			err := r.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: secretName}, &corev1.Secret{})
+			Expect(errors.IsNotFound(err)).To(BeTrue())
+			Expect(recorder.Events).To(Receive(HavePrefix("Warning " + eventReasonTokenSourceRejected)))
+		},
+		Entry("another secret in the operator namespace",
+			operatorNamespace+"/webhook-certs", "webhook-certs-"+operatorNamespace, "tls.key"),
+		Entry("another key of the token secret",
+			operatorNamespace+"/netclient-token", "netclient-token-"+operatorNamespace, "tls.key"),
+		Entry("the token secret of another namespace",
+			"kube-system/netclient-token", "netclient-token-kube-system", "token"),
+		Entry("a copy named after another secret",
+			operatorNamespace+"/netclient-token", "app-config", "token"),
+		Entry("a source without namespace",
+			"netclient-token", "netclient-token", "token"),
+	)
+})
@@ -19,44 +19,90 @@ package controller
 import (
 	"context"
 
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 
 	networkv1 "github.com/gravitl/netmaker-k8s-ops/api/v1"
+	"github.com/gravitl/netmaker-k8s-ops/internal/netmakerapi"
 )
 
 // NetmakerOpsReconciler reconciles a NetmakerOps object
 type NetmakerOpsReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+	// Netmaker registers the cluster egress gateways; nil when the API isn't configured
+	Netmaker *netmakerapi.Client
 }
 
 // +kubebuilder:rbac:groups=network.netmaker.io,resources=netmakerops,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=network.netmaker.io,resources=netmakerops/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=network.netmaker.io,resources=netmakerops/finalizers,verbs=update
+// +kubebuilder:rbac:groups=apps,resources=daemonsets,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=nodes,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 
-// Reconcile is part of the main kubernetes reconciliation loop which aims to
-// move the current state of the cluster closer to the desired state.
-// TODO(user): Modify the Reconcile function to compare the state specified by
-// the NetmakerOps object against the actual cluster state, and then
-// perform operations to make the cluster state reflect the state specified by
-// the user.
-//
-// For more details, check Reconcile and its Result here:
-// - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.18.4/pkg/reconcile
+// Reconcile brings the cluster in line with the features a NetmakerOps enables
+// Objects created for a NetmakerOps are owned by it and garbage collected with it
 func (r *NetmakerOpsReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
-	_ = log.FromContext(ctx)
+	logger := log.FromContext(ctx)
 
-	// TODO(user): your logic here
+	ops := &networkv1.NetmakerOps{}
+	if err := r.Get(ctx, req.NamespacedName, ops); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if ops.DeletionTimestamp != nil {
+		return ctrl.Result{}, r.finalizeClusterEgress(ctx, ops)
+	}
+	if err := r.ensureClusterEgressFinalizer(ctx, ops); err != nil {
+		return ctrl.Result{}, err
+	}
+	original := ops.Status.DeepCopy()
 
-	return ctrl.Result{}, nil
+	result, err := r.reconcileNodeNetclient(ctx, ops)
+	if err != nil {
+		logger.Error(err, "Failed to reconcile node-level netclient", "netmakerops", req.NamespacedName)
+		return ctrl.Result{}, err
+	}
+	egressResult, err := r.reconcileClusterEgress(ctx, ops)
+	if err != nil {
+		logger.Error(err, "Failed to reconcile cluster egress", "netmakerops", req.NamespacedName)
+		return ctrl.Result{}, err
+	}
+	if egressResult.RequeueAfter > 0 && (result.RequeueAfter == 0 || egressResult.RequeueAfter < result.RequeueAfter) {
+		result.RequeueAfter = egressResult.RequeueAfter
+	}
+
+	if !equality.Semantic.DeepEqual(original, &ops.Status) {
+		if err := r.Status().Update(ctx, ops); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	return result, nil
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *NetmakerOpsReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&networkv1.NetmakerOps{}).
+		Owns(&appsv1.DaemonSet{}).
+		Owns(&corev1.ConfigMap{}).
+		Watches(&corev1.Pod{}, handler.EnqueueRequestsFromMapFunc(r.mapToNodeNetclientOps),
+			builder.WithPredicates(predicate.NewPredicateFuncs(isNodeRoutedPod))).
+		Watches(&networkv1.NetmakerOps{}, handler.EnqueueRequestsFromMapFunc(r.mapToNodeNetclientOps)).
+		Watches(&corev1.Node{}, handler.EnqueueRequestsFromMapFunc(r.mapToNodeNetclientOps),
+			builder.WithPredicates(nodeReadinessChanged)).
 		Complete(r)
 }
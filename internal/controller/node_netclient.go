@@ -0,0 +1,518 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	networkv1 "github.com/gravitl/netmaker-k8s-ops/api/v1"
+)
+
+const (
+	// netclientModeLabel selects how a pod joins Netmaker; nodeRoutedMode routes it through the node-level netclient
+	// instead of a sidecar ("enabled" and "disabled" are handled by the sidecar webhook)
+	netclientModeLabel = "netmaker.io/netclient"
+	nodeRoutedMode     = "node"
+
+	// NodeNetclientConfigHashAnnotation rolls the DaemonSet only when its pod template changed
+	NodeNetclientConfigHashAnnotation = "netmaker.io/node-netclient-config-hash"
+	// nodeNetclientStateDir keeps each node's netclient identity across pod restarts
+	nodeNetclientStateDir = "/var/lib/netmaker-k8s-ops/netclient"
+	// nodeRoutesDir is where the route agent reads the pod IPs of its node, one file per node name
+	nodeRoutesDir = "/etc/netmaker-routes"
+
+	// conditionNodeNetclientReady reports whether every selected node runs netclient
+	conditionNodeNetclientReady = "NodeNetclientReady"
+
+	// nodeNetclientTokenRetry is how often a missing token secret is checked again
+	nodeNetclientTokenRetry = time.Minute
+)
+
+// nodeNetclientName returns the name of the DaemonSet of a NetmakerOps
+func nodeNetclientName(ops *networkv1.NetmakerOps) string {
+	return ops.Name + "-node-netclient"
+}
+
+// nodeRoutesName returns the name of the ConfigMap listing the routed pod IPs of each node
+func nodeRoutesName(ops *networkv1.NetmakerOps) string {
+	return ops.Name + "-node-routes"
+}
+
+// reconcileNodeNetclient deploys the node-level netclient DaemonSet and the routes of the pods using it
+func (r *NetmakerOpsReconciler) reconcileNodeNetclient(ctx context.Context, ops *networkv1.NetmakerOps) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+	spec := ops.Spec.NodeNetclient
+
+	if spec == nil || !spec.Enabled {
+		if err := r.cleanupNodeNetclient(ctx, ops); err != nil {
+			return ctrl.Result{}, err
+		}
+		ops.Status.NodeNetclient = nil
+		meta.RemoveStatusCondition(&ops.Status.Conditions, conditionNodeNetclientReady)
+		return ctrl.Result{}, nil
+	}
+
+	// A node has one netmaker interface, so only one NetmakerOps can manage node-level netclient
+	owner, err := r.nodeNetclientOwner(ctx)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if owner != nil && (owner.Namespace != ops.Namespace || owner.Name != ops.Name) {
+		if err := r.cleanupNodeNetclient(ctx, ops); err != nil {
+			return ctrl.Result{}, err
+		}
+		ops.Status.NodeNetclient = nil
+		r.setNodeNetclientCondition(ops, metav1.ConditionFalse, "Conflict",
+			fmt.Sprintf("node-level netclient is already managed by NetmakerOps %s/%s", owner.Namespace, owner.Name))
+		return ctrl.Result{}, nil
+	}
+
+	tokenRef := nodeNetclientTokenRef(spec)
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, types.NamespacedName{Name: tokenRef.Name, Namespace: ops.Namespace}, secret); err != nil {
+		if !errors.IsNotFound(err) {
+			return ctrl.Result{}, err
+		}
+		r.setNodeNetclientCondition(ops, metav1.ConditionFalse, "TokenSecretMissing",
+			fmt.Sprintf("token secret %s/%s not found", ops.Namespace, tokenRef.Name))
+		return ctrl.Result{RequeueAfter: nodeNetclientTokenRetry}, nil
+	}
+
+	routes, routedPods, err := r.collectNodeRoutes(ctx)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := r.ensureNodeRoutesConfigMap(ctx, ops, routes); err != nil {
+		return ctrl.Result{}, err
+	}
+	daemonSet, err := r.ensureNodeNetclientDaemonSet(ctx, ops)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	status := &networkv1.NodeNetclientStatus{
+		DesiredNodes: daemonSet.Status.DesiredNumberScheduled,
+		ReadyNodes:   daemonSet.Status.NumberReady,
+		RoutedPods:   routedPods,
+	}
+	ops.Status.NodeNetclient = status
+	if status.DesiredNodes > 0 && status.ReadyNodes == status.DesiredNodes {
+		r.setNodeNetclientCondition(ops, metav1.ConditionTrue, "Ready", fmt.Sprintf("netclient is ready on %d nodes", status.ReadyNodes))
+	} else {
+		r.setNodeNetclientCondition(ops, metav1.ConditionFalse, "Progressing",
+			fmt.Sprintf("netclient is ready on %d of %d nodes", status.ReadyNodes, status.DesiredNodes))
+	}
+	logger.V(1).Info("Reconciled node-level netclient", "netmakerops", client.ObjectKeyFromObject(ops),
+		"desired", status.DesiredNodes, "ready", status.ReadyNodes, "routedPods", routedPods)
+	return ctrl.Result{}, nil
+}
+
+// setNodeNetclientCondition sets the NodeNetclientReady condition
+func (r *NetmakerOpsReconciler) setNodeNetclientCondition(ops *networkv1.NetmakerOps, status metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(&ops.Status.Conditions, metav1.Condition{
+		Type:               conditionNodeNetclientReady,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: ops.Generation,
+	})
+}
+
+// nodeNetclientOwner returns the NetmakerOps that manages node-level netclient: the oldest one enabling it
+func (r *NetmakerOpsReconciler) nodeNetclientOwner(ctx context.Context) (*networkv1.NetmakerOps, error) {
+	list := &networkv1.NetmakerOpsList{}
+	if err := r.List(ctx, list); err != nil {
+		return nil, err
+	}
+	var owner *networkv1.NetmakerOps
+	for i := range list.Items {
+		candidate := &list.Items[i]
+		if candidate.DeletionTimestamp != nil || candidate.Spec.NodeNetclient == nil || !candidate.Spec.NodeNetclient.Enabled {
+			continue
+		}
+		if owner == nil || candidate.CreationTimestamp.Before(&owner.CreationTimestamp) ||
+			(candidate.CreationTimestamp.Equal(&owner.CreationTimestamp) &&
+				candidate.Namespace+"/"+candidate.Name < owner.Namespace+"/"+owner.Name) {
+			owner = candidate
+		}
+	}
+	return owner, nil
+}
+
+// nodeNetclientTokenRef returns the token secret reference, defaulting to the operator-wide secret name and key
+func nodeNetclientTokenRef(spec *networkv1.NodeNetclientSpec) corev1.SecretKeySelector {
+	ref := corev1.SecretKeySelector{
+		LocalObjectReference: corev1.LocalObjectReference{Name: getEnvOrDefault("NETCLIENT_SECRET_NAME", "netclient-token")},
+		Key:                  getEnvOrDefault("NETCLIENT_SECRET_KEY", "token"),
+	}
+	if spec.TokenSecretRef != nil {
+		if spec.TokenSecretRef.Name != "" {
+			ref.Name = spec.TokenSecretRef.Name
+		}
+		if spec.TokenSecretRef.Key != "" {
+			ref.Key = spec.TokenSecretRef.Key
+		}
+	}
+	return ref
+}
+
+// nodeNetclientNetwork returns the network the nodes join, empty when netclient picks it from the token
+func nodeNetclientNetwork(spec *networkv1.NodeNetclientSpec) string {
+	if spec.Network != "" {
+		return spec.Network
+	}
+	return getEnvOrDefault("NETCLIENT_NETWORK", "")
+}
+
+// collectNodeRoutes lists the IPs of running pods labeled netmaker.io/netclient: node, grouped by node
+func (r *NetmakerOpsReconciler) collectNodeRoutes(ctx context.Context) (map[string]string, int32, error) {
+	pods := &corev1.PodList{}
+	if err := r.List(ctx, pods, client.MatchingLabels{netclientModeLabel: nodeRoutedMode}); err != nil {
+		return nil, 0, fmt.Errorf("failed to list routed pods: %w", err)
+	}
+
+	ipsByNode := map[string][]string{}
+	var routedPods int32
+	for _, pod := range pods.Items {
+		// Host network pods already use the node's interfaces
+		if pod.Spec.NodeName == "" || pod.Spec.HostNetwork || pod.Status.Phase != corev1.PodRunning || pod.DeletionTimestamp != nil {
+			continue
+		}
+		added := false
+		for _, podIP := range pod.Status.PodIPs {
+			// Netmaker networks are routed over IPv4
+			if !strings.Contains(podIP.IP, ":") {
+				ipsByNode[pod.Spec.NodeName] = append(ipsByNode[pod.Spec.NodeName], podIP.IP)
+				added = true
+			}
+		}
+		if added {
+			routedPods++
+		}
+	}
+
+	routes := make(map[string]string, len(ipsByNode))
+	for node, ips := range ipsByNode {
+		sort.Strings(ips)
+		routes[node] = strings.Join(ips, "\n") + "\n"
+	}
+	return routes, routedPods, nil
+}
+
+// ensureNodeRoutesConfigMap writes the routed pod IPs of every node; the route agents pick up changes without a restart
+func (r *NetmakerOpsReconciler) ensureNodeRoutesConfigMap(ctx context.Context, ops *networkv1.NetmakerOps, routes map[string]string) error {
+	configMap := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: nodeRoutesName(ops), Namespace: ops.Namespace}}
+	_, err := controllerutil.CreateOrUpdate(ctx, r.Client, configMap, func() error {
+		configMap.Labels = nodeNetclientLabels(ops)
+		configMap.Data = routes
+		return controllerutil.SetControllerReference(ops, configMap, r.Scheme)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update node routes: %w", err)
+	}
+	return nil
+}
+
+// ensureNodeNetclientDaemonSet creates or updates the netclient DaemonSet and returns it with its status
+func (r *NetmakerOpsReconciler) ensureNodeNetclientDaemonSet(ctx context.Context, ops *networkv1.NetmakerOps) (*appsv1.DaemonSet, error) {
+	logger := log.FromContext(ctx)
+	desired, err := r.buildNodeNetclientDaemonSet(ops)
+	if err != nil {
+		return nil, err
+	}
+
+	existing := &appsv1.DaemonSet{}
+	err = r.Get(ctx, client.ObjectKeyFromObject(desired), existing)
+	if errors.IsNotFound(err) {
+		logger.Info("Creating node-level netclient DaemonSet", "daemonset", client.ObjectKeyFromObject(desired))
+		if err := r.Create(ctx, desired); err != nil {
+			return nil, fmt.Errorf("failed to create node-level netclient DaemonSet: %w", err)
+		}
+		return desired, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if existing.Spec.Template.Annotations[NodeNetclientConfigHashAnnotation] == desired.Spec.Template.Annotations[NodeNetclientConfigHashAnnotation] {
+		return existing, nil
+	}
+	logger.Info("Updating node-level netclient DaemonSet", "daemonset", client.ObjectKeyFromObject(desired))
+	existing.Spec.Template = desired.Spec.Template
+	if err := r.Update(ctx, existing); err != nil {
+		return nil, fmt.Errorf("failed to update node-level netclient DaemonSet: %w", err)
+	}
+	return existing, nil
+}
+
+// nodeNetclientLabels returns the labels of the node-level netclient objects of a NetmakerOps
+func nodeNetclientLabels(ops *networkv1.NetmakerOps) map[string]string {
+	return map[string]string{
+		"app":                     "netmaker-node-netclient",
+		"managed-by":              "netmaker-k8s-ops",
+		"netmaker.io/netmakerops": ops.Name,
+	}
+}
+
+// buildNodeNetclientDaemonSet builds the DaemonSet running netclient and the route agent on every selected node
+func (r *NetmakerOpsReconciler) buildNodeNetclientDaemonSet(ops *networkv1.NetmakerOps) (*appsv1.DaemonSet, error) {
+	spec := ops.Spec.NodeNetclient
+	image := spec.Image
+	if image == "" {
+		image = getEnvOrDefault("NETCLIENT_IMAGE", "gravitl/netclient:v1.4.0")
+	}
+	server := spec.Server
+	if server == "" {
+		server = getEnvOrDefault("NETCLIENT_SERVER", "")
+	}
+	network := nodeNetclientNetwork(spec)
+	tokenRef := nodeNetclientTokenRef(spec)
+
+	env := []corev1.EnvVar{
+		{Name: "TOKEN", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &tokenRef}},
+		{Name: "DAEMON", Value: "on"},
+		{Name: "LOG_LEVEL", Value: "info"},
+	}
+	if server != "" {
+		env = append(env, corev1.EnvVar{Name: "SERVER", Value: server})
+	}
+	if network != "" {
+		env = append(env, corev1.EnvVar{Name: "NETWORK", Value: network})
+	}
+
+	hostPathType := corev1.HostPathDirectoryOrCreate
+	labels := nodeNetclientLabels(ops)
+	template := corev1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: labels,
+			Annotations: map[string]string{
+				// Never inject a sidecar into the node-level netclient itself
+				NetclientInjectionKey: "disabled",
+			},
+		},
+		Spec: corev1.PodSpec{
+			HostNetwork:  true,
+			DNSPolicy:    corev1.DNSClusterFirstWithHostNet,
+			NodeSelector: spec.NodeSelector,
+			Tolerations:  spec.Tolerations,
+			Containers: []corev1.Container{
+				{
+					Name:  "netclient",
+					Image: image,
+					Env:   env,
+					VolumeMounts: []corev1.VolumeMount{
+						{Name: "etc-netclient", MountPath: "/etc/netclient"},
+					},
+					SecurityContext: &corev1.SecurityContext{
+						Capabilities: &corev1.Capabilities{
+							Add: []corev1.Capability{"NET_ADMIN", "SYS_MODULE"},
+						},
+					},
+					StartupProbe: &corev1.Probe{
+						ProbeHandler: corev1.ProbeHandler{
+							Exec: &corev1.ExecAction{Command: []string{"/bin/sh", "-c", "ip addr show netmaker | grep -q inet"}},
+						},
+						PeriodSeconds:    5,
+						FailureThreshold: 60,
+					},
+					ReadinessProbe: &corev1.Probe{
+						ProbeHandler: corev1.ProbeHandler{
+							Exec: &corev1.ExecAction{Command: []string{"/bin/sh", "-c", "ip addr show netmaker | grep -q inet"}},
+						},
+						PeriodSeconds: 10,
+					},
+					Resources: corev1.ResourceRequirements{
+						Limits: corev1.ResourceList{
+							corev1.ResourceCPU:    resource.MustParse("200m"),
+							corev1.ResourceMemory: resource.MustParse("128Mi"),
+						},
+						Requests: corev1.ResourceList{
+							corev1.ResourceCPU:    resource.MustParse("50m"),
+							corev1.ResourceMemory: resource.MustParse("64Mi"),
+						},
+					},
+				},
+				// The route agent masquerades the node's routed pods onto the netmaker interface
+				{
+					Name:    "routes",
+					Image:   image,
+					Command: []string{"/bin/sh", "-c", buildNodeRoutesScript()},
+					Env: []corev1.EnvVar{{
+						Name:      "NODE_NAME",
+						ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: "spec.nodeName"}},
+					}},
+					VolumeMounts: []corev1.VolumeMount{
+						{Name: "node-routes", MountPath: nodeRoutesDir, ReadOnly: true},
+					},
+					SecurityContext: &corev1.SecurityContext{
+						Capabilities: &corev1.Capabilities{
+							Add: []corev1.Capability{"NET_ADMIN"},
+						},
+					},
+					Resources: corev1.ResourceRequirements{
+						Limits: corev1.ResourceList{
+							corev1.ResourceCPU:    resource.MustParse("50m"),
+							corev1.ResourceMemory: resource.MustParse("32Mi"),
+						},
+						Requests: corev1.ResourceList{
+							corev1.ResourceCPU:    resource.MustParse("5m"),
+							corev1.ResourceMemory: resource.MustParse("8Mi"),
+						},
+					},
+				},
+			},
+			Volumes: []corev1.Volume{
+				{Name: "etc-netclient", VolumeSource: corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{
+					Path: nodeNetclientStateDir,
+					Type: &hostPathType,
+				}}},
+				{Name: "node-routes", VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{
+					LocalObjectReference: corev1.LocalObjectReference{Name: nodeRoutesName(ops)},
+				}}},
+			},
+		},
+	}
+
+	data, err := json.Marshal(template)
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256(data)
+	template.Annotations[NodeNetclientConfigHashAnnotation] = hex.EncodeToString(hash[:])
+
+	daemonSet := &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      nodeNetclientName(ops),
+			Namespace: ops.Namespace,
+			Labels:    labels,
+		},
+		Spec: appsv1.DaemonSetSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Template: template,
+		},
+	}
+	if err := controllerutil.SetControllerReference(ops, daemonSet, r.Scheme); err != nil {
+		return nil, err
+	}
+	return daemonSet, nil
+}
+
+// buildNodeRoutesScript creates the route agent script
+// netclient routes the Netmaker ranges through the netmaker interface of the node, and pod traffic follows the
+// node's routes once it leaves the pod; peers only know the node's Netmaker address, so the agent masquerades
+// the routed pods of its node behind it and lets the replies back in. Pods not listed never reach the interface.
+func buildNodeRoutesScript() string {
+	return fmt.Sprintf(`nat=NETMAKER-POD-NAT
+fwd=NETMAKER-POD-FWD
+iptables -t nat -N $nat 2>/dev/null
+iptables -N $fwd 2>/dev/null
+iptables -t nat -C POSTROUTING -o netmaker -j $nat 2>/dev/null || iptables -t nat -A POSTROUTING -o netmaker -j $nat
+iptables -C FORWARD -j $fwd 2>/dev/null || iptables -I FORWARD -j $fwd
+cleanup() {
+  iptables -t nat -D POSTROUTING -o netmaker -j $nat
+  iptables -D FORWARD -j $fwd
+  iptables -t nat -F $nat; iptables -t nat -X $nat
+  iptables -F $fwd; iptables -X $fwd
+  exit 0
+}
+trap cleanup TERM INT
+applied=""
+while true; do
+  ips=$(cat "%s/$NODE_NAME" 2>/dev/null)
+  if [ "$ips" != "$applied" ]; then
+    iptables -t nat -F $nat
+    iptables -F $fwd
+    iptables -A $fwd -i netmaker -m conntrack --ctstate RELATED,ESTABLISHED -j ACCEPT
+    for ip in $ips; do
+      iptables -t nat -A $nat -s "$ip" -j MASQUERADE
+      iptables -A $fwd -s "$ip" -o netmaker -j ACCEPT
+    done
+    applied="$ips"
+    echo "Routing $(echo $ips | wc -w) pods through netmaker"
+  fi
+  sleep 5 & wait $!
+done
+`, nodeRoutesDir)
+}
+
+// cleanupNodeNetclient removes the node-level netclient DaemonSet and routes of a NetmakerOps
+func (r *NetmakerOpsReconciler) cleanupNodeNetclient(ctx context.Context, ops *networkv1.NetmakerOps) error {
+	logger := log.FromContext(ctx)
+
+	daemonSet := &appsv1.DaemonSet{}
+	if err := r.Get(ctx, types.NamespacedName{Name: nodeNetclientName(ops), Namespace: ops.Namespace}, daemonSet); err == nil {
+		logger.Info("Deleting node-level netclient DaemonSet", "daemonset", client.ObjectKeyFromObject(daemonSet))
+		if err := r.Delete(ctx, daemonSet); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	} else if !errors.IsNotFound(err) {
+		return err
+	}
+
+	configMap := &corev1.ConfigMap{}
+	if err := r.Get(ctx, types.NamespacedName{Name: nodeRoutesName(ops), Namespace: ops.Namespace}, configMap); err == nil {
+		if err := r.Delete(ctx, configMap); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	} else if !errors.IsNotFound(err) {
+		return err
+	}
+
+	return nil
+}
+
+// mapToNodeNetclientOps enqueues every NetmakerOps that enables node-level netclient
+// Routed pods change the routes, and a removed NetmakerOps may hand node-level netclient to another one
+func (r *NetmakerOpsReconciler) mapToNodeNetclientOps(ctx context.Context, obj client.Object) []reconcile.Request {
+	list := &networkv1.NetmakerOpsList{}
+	if err := r.List(ctx, list); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list NetmakerOps for node-level netclient")
+		return nil
+	}
+	requests := []reconcile.Request{}
+	for _, ops := range list.Items {
+		if ops.Spec.NodeNetclient != nil && ops.Spec.NodeNetclient.Enabled {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&ops)})
+		}
+	}
+	return requests
+}
+
+// isNodeRoutedPod checks if a pod is routed through the node-level netclient
+func isNodeRoutedPod(obj client.Object) bool {
+	return obj.GetLabels()[netclientModeLabel] == nodeRoutedMode
+}
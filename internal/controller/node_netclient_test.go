@@ -0,0 +1,181 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	networkv1 "github.com/gravitl/netmaker-k8s-ops/api/v1"
+)
+
+var _ = Describe("Node-level netclient", func() {
+	var (
+		c client.Client
+		r *NetmakerOpsReconciler
+	)
+
+	newOps := func(name string, created metav1.Time) *networkv1.NetmakerOps {
+		return &networkv1.NetmakerOps{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "netmaker", CreationTimestamp: created, UID: types.UID(name)},
+			Spec:       networkv1.NetmakerOpsSpec{NodeNetclient: &networkv1.NodeNetclientSpec{Enabled: true, Network: "edge"}},
+		}
+	}
+	tokenSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "netclient-token", Namespace: "netmaker"},
+		Data:       map[string][]byte{"token": []byte("enrollment")},
+	}
+	routedPod := func(name, node, ip string, phase corev1.PodPhase) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: map[string]string{netclientModeLabel: nodeRoutedMode}},
+			Spec:       corev1.PodSpec{NodeName: node},
+			Status:     corev1.PodStatus{Phase: phase, PodIPs: []corev1.PodIP{{IP: ip}, {IP: "fd00::" + name[len(name)-1:]}}},
+		}
+	}
+
+	build := func(objects ...client.Object) {
+		c = fake.NewClientBuilder().WithScheme(newOpsScheme()).WithObjects(objects...).Build()
+		r = &NetmakerOpsReconciler{Client: c, Scheme: c.Scheme()}
+	}
+
+	It("only stamps annotations the validating webhook accepts", func() {
+		build()
+		daemonSet, err := r.buildNodeNetclientDaemonSet(newOps("ops", metav1.Now()))
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(daemonSet.Spec.Template.Annotations).To(HaveKey(NodeNetclientConfigHashAnnotation))
+		// Opting out of injection is the only workload annotation the operator sets itself
+		Expect(daemonSet.Spec.Template.Annotations).To(HaveKeyWithValue(NetclientInjectionKey, "disabled"))
+		for _, annotations := range []map[string]string{daemonSet.Annotations, daemonSet.Spec.Template.Annotations} {
+			for key := range annotations {
+				if strings.HasPrefix(key, "netmaker.io/") && key != NetclientInjectionKey {
+					Expect(ManagedAnnotations).To(ContainElement(key))
+				}
+			}
+		}
+		// The DaemonSet pods aren't sidecar pods; the webhook must leave them alone
+		Expect(daemonSet.Spec.Template.Labels).NotTo(HaveKey(netclientModeLabel))
+	})
+
+	It("deploys the DaemonSet and the routes of running routed pods", func() {
+		ops := newOps("ops", metav1.Now())
+		build(ops, tokenSecret,
+			routedPod("web-1", "node-a", "10.244.0.11", corev1.PodRunning),
+			routedPod("web-2", "node-a", "10.244.0.10", corev1.PodRunning),
+			routedPod("web-3", "node-b", "10.244.1.10", corev1.PodRunning),
+			routedPod("web-4", "node-b", "10.244.1.11", corev1.PodPending),
+		)
+
+		_, err := r.reconcileNodeNetclient(context.Background(), ops)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(c.Get(context.Background(), types.NamespacedName{Namespace: "netmaker", Name: "ops-node-netclient"}, &appsv1.DaemonSet{})).To(Succeed())
+		routes := &corev1.ConfigMap{}
+		Expect(c.Get(context.Background(), types.NamespacedName{Namespace: "netmaker", Name: "ops-node-routes"}, routes)).To(Succeed())
+		Expect(routes.Data).To(Equal(map[string]string{
+			"node-a": "10.244.0.10\n10.244.0.11\n",
+			"node-b": "10.244.1.10\n",
+		}))
+		Expect(ops.Status.NodeNetclient.RoutedPods).To(Equal(int32(3)))
+		Expect(meta.FindStatusCondition(ops.Status.Conditions, conditionNodeNetclientReady).Reason).To(Equal("Progressing"))
+	})
+
+	It("only rolls the DaemonSet when its pod template changes", func() {
+		ops := newOps("ops", metav1.Now())
+		build(ops)
+		_, err := r.ensureNodeNetclientDaemonSet(context.Background(), ops)
+		Expect(err).NotTo(HaveOccurred())
+		key := types.NamespacedName{Namespace: "netmaker", Name: "ops-node-netclient"}
+		created := &appsv1.DaemonSet{}
+		Expect(c.Get(context.Background(), key, created)).To(Succeed())
+
+		_, err = r.ensureNodeNetclientDaemonSet(context.Background(), ops)
+		Expect(err).NotTo(HaveOccurred())
+		unchanged := &appsv1.DaemonSet{}
+		Expect(c.Get(context.Background(), key, unchanged)).To(Succeed())
+		Expect(unchanged.ResourceVersion).To(Equal(created.ResourceVersion))
+
+		ops.Spec.NodeNetclient.Network = "prod"
+		_, err = r.ensureNodeNetclientDaemonSet(context.Background(), ops)
+		Expect(err).NotTo(HaveOccurred())
+		updated := &appsv1.DaemonSet{}
+		Expect(c.Get(context.Background(), key, updated)).To(Succeed())
+		Expect(updated.Spec.Template.Annotations[NodeNetclientConfigHashAnnotation]).
+			NotTo(Equal(created.Spec.Template.Annotations[NodeNetclientConfigHashAnnotation]))
+	})
+
+	It("waits for the token secret", func() {
+		ops := newOps("ops", metav1.Now())
+		build(ops)
+
+		result, err := r.reconcileNodeNetclient(context.Background(), ops)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(Equal(nodeNetclientTokenRetry))
+		Expect(meta.FindStatusCondition(ops.Status.Conditions, conditionNodeNetclientReady).Reason).To(Equal("TokenSecretMissing"))
+	})
+
+	It("leaves node-level netclient to the oldest NetmakerOps", func() {
+		older := newOps("older", metav1.NewTime(metav1.Now().Add(-60e9)))
+		newer := newOps("newer", metav1.Now())
+		build(older, newer, tokenSecret)
+
+		_, err := r.reconcileNodeNetclient(context.Background(), newer)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(meta.FindStatusCondition(newer.Status.Conditions, conditionNodeNetclientReady).Reason).To(Equal("Conflict"))
+		err = c.Get(context.Background(), types.NamespacedName{Namespace: "netmaker", Name: "newer-node-netclient"}, &appsv1.DaemonSet{})
+		Expect(errors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("removes the DaemonSet and routes when disabled", func() {
+		ops := newOps("ops", metav1.Now())
+		build(ops, tokenSecret)
+		_, err := r.reconcileNodeNetclient(context.Background(), ops)
+		Expect(err).NotTo(HaveOccurred())
+
+		ops.Spec.NodeNetclient.Enabled = false
+		_, err = r.reconcileNodeNetclient(context.Background(), ops)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ops.Status.NodeNetclient).To(BeNil())
+		Expect(meta.FindStatusCondition(ops.Status.Conditions, conditionNodeNetclientReady)).To(BeNil())
+		err = c.Get(context.Background(), types.NamespacedName{Namespace: "netmaker", Name: "ops-node-netclient"}, &appsv1.DaemonSet{})
+		Expect(errors.IsNotFound(err)).To(BeTrue())
+		err = c.Get(context.Background(), types.NamespacedName{Namespace: "netmaker", Name: "ops-node-routes"}, &corev1.ConfigMap{})
+		Expect(errors.IsNotFound(err)).To(BeTrue())
+	})
+})
+
+// newOpsScheme returns a scheme with the built-in types and NetmakerOps for fake clients
+func newOpsScheme() *runtime.Scheme {
+	s := runtime.NewScheme()
+	Expect(clientgoscheme.AddToScheme(s)).To(Succeed())
+	Expect(networkv1.AddToScheme(s)).To(Succeed())
+	return s
+}
@@ -0,0 +1,54 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"regexp"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// proxyNetworkAnnotation selects the Netmaker network a Service's proxy pod joins and binds to
+// The token in netmaker.io/secret-name must be valid for it. Without it the token decides the network.
+const proxyNetworkAnnotation = "netmaker.io/network"
+
+// proxyNetworkPattern matches Netmaker network names
+var proxyNetworkPattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,32}$`)
+
+// proxyNetwork returns the network the proxy pod of a Service joins, empty when the token decides
+func proxyNetwork(service *corev1.Service) string {
+	return service.Annotations[proxyNetworkAnnotation]
+}
+
+// withProxyNetwork adds the Service's network to the proxy netclient environment
+func withProxyNetwork(envVars []corev1.EnvVar, service *corev1.Service) []corev1.EnvVar {
+	if network := proxyNetwork(service); network != "" {
+		envVars = append(envVars, corev1.EnvVar{Name: "NETWORK", Value: network})
+	}
+	return envVars
+}
+
+// proxyNetworkChanged checks if the proxy pod joined another network than the Service asks for
+// netclient only joins on start, so the pod has to be recreated
+func proxyNetworkChanged(pod *corev1.Pod, service *corev1.Service) bool {
+	for _, container := range pod.Spec.Containers {
+		if container.Name == "netclient" {
+			return netclientNetwork(&container) != proxyNetwork(service)
+		}
+	}
+	return false
+}
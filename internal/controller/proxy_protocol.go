@@ -0,0 +1,95 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// proxyProtocolAnnotation enables PROXY protocol on a Service's ingress or egress proxy
+	proxyProtocolAnnotation = "netmaker.io/proxy-protocol"
+	// haproxyConfigFile is where the proxy container writes its generated HAProxy config
+	haproxyConfigFile = "/tmp/haproxy.cfg"
+)
+
+// haproxyListener is a single TCP frontend/backend pair in the generated HAProxy config
+type haproxyListener struct {
+	// Bind is the listen address, e.g. "$WG_IP:443" or ":8080"; shell variables are expanded at runtime
+	Bind   string
+	Target string
+}
+
+// getProxyProtocol returns the PROXY protocol version configured for the Service ("", "v1" or "v2")
+func getProxyProtocol(service *corev1.Service) (string, error) {
+	value := strings.ToLower(strings.TrimSpace(service.Annotations[proxyProtocolAnnotation]))
+	switch value {
+	case "", "disabled":
+		return "", nil
+	case "v1", "v2":
+		return value, nil
+	default:
+		return "", fmt.Errorf("invalid %s value %q, expected v1 or v2", proxyProtocolAnnotation, value)
+	}
+}
+
+// getProxyImage returns the proxy container image for a Service
+// socat can't speak PROXY protocol, so HAProxy is used when it is enabled
+func getProxyImage(service *corev1.Service, imageEnv string) string {
+	if version, _ := getProxyProtocol(service); version != "" {
+		return getEnvOrDefault("HAPROXY_IMAGE", "haproxy:2.9-alpine")
+	}
+	return getEnvOrDefault(imageEnv, "alpine/socat:latest")
+}
+
+// buildHAProxyScript creates the shell snippet that writes the HAProxy config and runs HAProxy in the foreground
+// acceptProxy expects a PROXY protocol header from clients; version selects the header sent to the target
+func buildHAProxyScript(listeners []haproxyListener, acceptProxy bool, version string) string {
+	sendProxy := "send-proxy"
+	if version == "v2" {
+		sendProxy = "send-proxy-v2"
+	}
+	bindOptions := ""
+	if acceptProxy {
+		bindOptions = " accept-proxy"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "cat > %s <<EOF\n", haproxyConfigFile)
+	b.WriteString(`global
+  log stdout format raw local0
+defaults
+  mode tcp
+  log global
+  option tcplog
+  timeout connect 5s
+  timeout client 1h
+  timeout server 1h
+  default-server init-addr last,libc,none
+`)
+	for i, listener := range listeners {
+		fmt.Fprintf(&b, "frontend listener_%d\n  bind %s%s\n  default_backend target_%d\n", i, listener.Bind, bindOptions, i)
+		fmt.Fprintf(&b, "backend target_%d\n  server target %s %s\n", i, listener.Target, sendProxy)
+	}
+	b.WriteString("EOF\n")
+	fmt.Fprintf(&b, "echo \"Starting HAProxy with PROXY protocol %s\"\n", version)
+	fmt.Fprintf(&b, "exec haproxy -db -f %s\n", haproxyConfigFile)
+	return b.String()
+}
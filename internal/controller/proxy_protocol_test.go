@@ -0,0 +1,138 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+var _ = Describe("PROXY protocol", func() {
+	serviceWithProxyProtocol := func(value string) *corev1.Service {
+		service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "default", Annotations: map[string]string{}}}
+		if value != "" {
+			service.Annotations[proxyProtocolAnnotation] = value
+		}
+		return service
+	}
+
+	DescribeTable("getProxyProtocol",
+		func(value, expected string, expectErr bool) {
+			version, err := getProxyProtocol(serviceWithProxyProtocol(value))
+			if expectErr {
+				Expect(err).To(HaveOccurred())
+				return
+			}
+			Expect(err).NotTo(HaveOccurred())
+			Expect(version).To(Equal(expected))
+		},
+		Entry("not set", "", "", false),
+		Entry("disabled", "disabled", "", false),
+		Entry("v1", "v1", "v1", false),
+		Entry("v2 in upper case", " V2 ", "v2", false),
+		Entry("unknown version", "v3", "", true),
+	)
+
+	It("uses HAProxy only when PROXY protocol is enabled", func() {
+		Expect(getProxyImage(serviceWithProxyProtocol(""), "EGRESS_PROXY_IMAGE")).To(Equal("alpine/socat:latest"))
+		Expect(getProxyImage(serviceWithProxyProtocol("v1"), "EGRESS_PROXY_IMAGE")).To(Equal("haproxy:2.9-alpine"))
+	})
+
+	DescribeTable("buildHAProxyScript",
+		func(acceptProxy bool, version string, expected []string, unexpected []string) {
+			script := buildHAProxyScript([]haproxyListener{
+				{Bind: ":5432", Target: "10.101.0.5:5432"},
+				{Bind: "$WG_IP:443", Target: "10.96.0.10:443"},
+			}, acceptProxy, version)
+			Expect(script).To(HavePrefix("cat > " + haproxyConfigFile + " <<EOF\n"))
+			Expect(script).To(HaveSuffix("exec haproxy -db -f " + haproxyConfigFile + "\n"))
+			for _, line := range expected {
+				Expect(script).To(ContainSubstring(line))
+			}
+			for _, line := range unexpected {
+				Expect(script).NotTo(ContainSubstring(line))
+			}
+		},
+		Entry("v1 accepting the header from clients", true, "v1",
+			[]string{
+				"frontend listener_0\n  bind :5432 accept-proxy\n  default_backend target_0\n",
+				"backend target_0\n  server target 10.101.0.5:5432 send-proxy\n",
+				"frontend listener_1\n  bind $WG_IP:443 accept-proxy\n  default_backend target_1\n",
+				"backend target_1\n  server target 10.96.0.10:443 send-proxy\n",
+			},
+			[]string{"send-proxy-v2"}),
+		Entry("v2 adding the header itself", false, "v2",
+			[]string{
+				"frontend listener_0\n  bind :5432\n  default_backend target_0\n",
+				"backend target_0\n  server target 10.101.0.5:5432 send-proxy-v2\n",
+			},
+			[]string{"accept-proxy"}),
+	)
+
+	Context("egress proxy", func() {
+		newService := func(proxyProtocol string, targetPort int32) *corev1.Service {
+			service := serviceWithProxyProtocol(proxyProtocol)
+			service.Spec.Ports = []corev1.ServicePort{{Name: "db", Port: 5432, TargetPort: intstr.FromInt32(targetPort)}}
+			return service
+		}
+		proxyPod := func(service *corev1.Service, targetIP string) *corev1.Pod {
+			return &corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{
+				{Name: "netclient"},
+				{
+					Name:    "proxy",
+					Image:   getProxyImage(service, "EGRESS_PROXY_IMAGE"),
+					Command: buildEgressProxyCommand(service, targetIP, ""),
+				},
+			}}}
+		}
+
+		It("runs HAProxy as root only for privileged target ports", func() {
+			Expect(egressProxySecurityContext(newService("", 80))).To(BeNil())
+			Expect(egressProxySecurityContext(newService("v1", 5432))).To(BeNil())
+			securityContext := egressProxySecurityContext(newService("v1", 80))
+			Expect(securityContext).NotTo(BeNil())
+			Expect(*securityContext.RunAsUser).To(BeZero())
+		})
+
+		It("recreates the proxy pod when the image or command changes", func() {
+			service := newService("", 5432)
+			pod := proxyPod(service, "10.101.0.5")
+			Expect(needsUpdate(pod, service, "10.101.0.5", "")).To(BeFalse())
+			Expect(needsUpdate(pod, service, "10.101.0.6", "")).To(BeTrue())
+			Expect(needsUpdate(pod, newService("", 5433), "10.101.0.5", "")).To(BeTrue())
+			Expect(needsUpdate(pod, newService("v2", 5432), "10.101.0.5", "")).To(BeTrue())
+		})
+
+		It("warns that PROXY protocol is ignored by the shared egress gateway", func() {
+			service := newService("v1", 5432)
+			service.Annotations["netmaker.io/egress"] = "enabled"
+			service.Annotations["netmaker.io/egress-target-ip"] = "10.101.0.5"
+
+			_, warnings := ValidateServiceAnnotations(service)
+			Expect(warnings).To(BeEmpty())
+
+			GinkgoT().Setenv("EGRESS_GATEWAY_MODE", egressGatewayModeNamespace)
+			problems, warnings := ValidateServiceAnnotations(service)
+			Expect(problems).To(BeEmpty())
+			Expect(warnings).To(ConsistOf(ContainSubstring(proxyProtocolAnnotation + " is ignored")))
+		})
+	})
+})
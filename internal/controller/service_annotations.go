@@ -0,0 +1,162 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// serviceAnnotationKeys are the netmaker.io annotations the egress and ingress proxy controllers read from Services
+var serviceAnnotationKeys = map[string]bool{
+	"netmaker.io/egress":               true,
+	"netmaker.io/egress-target-ip":     true,
+	"netmaker.io/egress-target-dns":    true,
+	"netmaker.io/ingress":              true,
+	"netmaker.io/ingress-bind-ip":      true,
+	IngressDNSNameAnnotation:           true,
+	"netmaker.io/ingress-listen-ports": true,
+	proxyProtocolAnnotation:            true,
+	"netmaker.io/secret-name":          true,
+	"netmaker.io/secret-key":           true,
+	staticIPAnnotation:                 true,
+	proxyNetworkAnnotation:             true,
+}
+
+// deprecatedServiceAnnotations are accepted with a warning; the value explains what to use instead
+var deprecatedServiceAnnotations = map[string]string{
+	"netmaker.io/egress-target-port":  "target ports come from the Service port targetPort",
+	"netmaker.io/egress-proxy-image":  "set EGRESS_PROXY_IMAGE on the operator",
+	"netmaker.io/ingress-proxy-image": "set INGRESS_PROXY_IMAGE on the operator",
+	"netmaker.io/secret-namespace":    "token secrets are read from the Service namespace, then the operator namespace",
+}
+
+// ValidateServiceAnnotations checks the netmaker.io annotations of a Service the way the proxy controllers read them
+// problems describe annotations the controllers would ignore or fail on, warnings describe deprecated ones
+func ValidateServiceAnnotations(service *corev1.Service) (problems []string, warnings []string) {
+	annotations := service.Annotations
+
+	keys := make([]string, 0, len(annotations))
+	for key := range annotations {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if !strings.HasPrefix(key, "netmaker.io/") || serviceAnnotationKeys[key] {
+			continue
+		}
+		if hint, deprecated := deprecatedServiceAnnotations[key]; deprecated {
+			warnings = append(warnings, fmt.Sprintf("%s is deprecated and ignored: %s", key, hint))
+			continue
+		}
+		problems = append(problems, fmt.Sprintf("unknown Service annotation %s", key))
+	}
+
+	for _, key := range []string{"netmaker.io/egress", "netmaker.io/ingress"} {
+		if value, ok := annotations[key]; ok && value != "enabled" && value != "disabled" {
+			problems = append(problems, fmt.Sprintf("%s %q must be enabled or disabled", key, value))
+		}
+	}
+	egress := annotations["netmaker.io/egress"] == "enabled"
+	ingress := annotations["netmaker.io/ingress"] == "enabled"
+	if egress && ingress {
+		problems = append(problems, "netmaker.io/egress and netmaker.io/ingress can't both be enabled on one Service")
+	}
+
+	targetIP, targetDNS := getEgressTarget(service)
+	if targetIP != "" && targetDNS != "" {
+		problems = append(problems, "set only one of netmaker.io/egress-target-ip and netmaker.io/egress-target-dns")
+	}
+	if egress && targetIP == "" && targetDNS == "" {
+		problems = append(problems, "netmaker.io/egress is enabled but neither netmaker.io/egress-target-ip nor netmaker.io/egress-target-dns is set")
+	}
+	if _, ok := annotations["netmaker.io/egress-target-ip"]; ok && net.ParseIP(targetIP) == nil {
+		problems = append(problems, fmt.Sprintf("netmaker.io/egress-target-ip %q is not an IP address", targetIP))
+	}
+	if _, ok := annotations["netmaker.io/egress-target-dns"]; ok {
+		problems = append(problems, validateHostname("netmaker.io/egress-target-dns", targetDNS)...)
+	}
+
+	bindIP, dnsName := getIngressConfig(service)
+	if _, ok := annotations["netmaker.io/ingress-bind-ip"]; ok && net.ParseIP(bindIP) == nil {
+		problems = append(problems, fmt.Sprintf("netmaker.io/ingress-bind-ip %q is not an IP address", bindIP))
+	}
+	if _, ok := annotations[IngressDNSNameAnnotation]; ok {
+		problems = append(problems, validateHostname(IngressDNSNameAnnotation, dnsName)...)
+	}
+	if _, err := getIngressListenPorts(service); err != nil {
+		problems = append(problems, fmt.Sprintf("netmaker.io/ingress-listen-ports: %v", err))
+	}
+	if version, err := getProxyProtocol(service); err != nil {
+		problems = append(problems, err.Error())
+	} else if version != "" && egress && getEgressGatewayMode() != "" {
+		warnings = append(warnings, fmt.Sprintf("%s is ignored for Services served by the shared egress gateway", proxyProtocolAnnotation))
+	}
+
+	if value, ok := annotations[staticIPAnnotation]; ok {
+		if addresses, err := ParseStaticIPs(value); err != nil {
+			problems = append(problems, err.Error())
+		} else if len(addresses) > 1 {
+			problems = append(problems, fmt.Sprintf("%s on a Service takes one address for its proxy pod", staticIPAnnotation))
+		}
+		switch {
+		case !egress && !ingress:
+			warnings = append(warnings, fmt.Sprintf("%s has no effect without netmaker.io/egress or netmaker.io/ingress", staticIPAnnotation))
+		case egress && getEgressGatewayMode() != "":
+			warnings = append(warnings, fmt.Sprintf("%s is ignored for Services served by the shared egress gateway", staticIPAnnotation))
+		}
+	}
+
+	if value, ok := annotations[proxyNetworkAnnotation]; ok {
+		if !proxyNetworkPattern.MatchString(value) {
+			problems = append(problems, fmt.Sprintf("%s %q must be 1-32 letters, digits, '-' or '_'", proxyNetworkAnnotation, value))
+		}
+		switch {
+		case !egress && !ingress:
+			warnings = append(warnings, fmt.Sprintf("%s has no effect without netmaker.io/egress or netmaker.io/ingress", proxyNetworkAnnotation))
+		case egress && getEgressGatewayMode() != "":
+			warnings = append(warnings, fmt.Sprintf("%s is ignored for Services served by the shared egress gateway", proxyNetworkAnnotation))
+		}
+	}
+
+	if value, ok := annotations["netmaker.io/secret-name"]; ok {
+		for _, msg := range validation.IsDNS1123Subdomain(value) {
+			problems = append(problems, fmt.Sprintf("netmaker.io/secret-name %q: %s", value, msg))
+		}
+	}
+	if value, ok := annotations["netmaker.io/secret-key"]; ok {
+		for _, msg := range validation.IsConfigMapKey(value) {
+			problems = append(problems, fmt.Sprintf("netmaker.io/secret-key %q: %s", value, msg))
+		}
+	}
+
+	return problems, warnings
+}
+
+// validateHostname checks that an annotation holds a DNS name
+func validateHostname(key, value string) []string {
+	var problems []string
+	for _, msg := range validation.IsDNS1123Subdomain(strings.TrimSuffix(value, ".")) {
+		problems = append(problems, fmt.Sprintf("%s %q: %s", key, value, msg))
+	}
+	return problems
+}
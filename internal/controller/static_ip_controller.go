@@ -0,0 +1,401 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gravitl/netmaker/models"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	"github.com/gravitl/netmaker-k8s-ops/internal/netmakerapi"
+)
+
+const (
+	// staticIPAnnotation is the Netmaker address a pod's netclient host should have
+	// StatefulSet pod templates may list one address per ordinal, separated by commas
+	staticIPAnnotation = "netmaker.io/static-ip"
+
+	// staticIPEnrollRetry is how often to look for the host while netclient is still enrolling
+	staticIPEnrollRetry = 15 * time.Second
+	// staticIPResync re-checks assigned addresses, and retries taken ones
+	staticIPResync = 5 * time.Minute
+
+	eventReasonStaticIPAssigned     = "StaticIPAssigned"
+	eventReasonStaticIPConflict     = "StaticIPConflict"
+	eventReasonStaticIPInvalid      = "StaticIPInvalid"
+	eventReasonStaticIPHostRejected = "StaticIPHostRejected"
+)
+
+var (
+	// errHostUnknown is returned while the operator hasn't recorded the pod's Netmaker host
+	errHostUnknown = errors.New("the pod's Netmaker host is not recorded")
+	// errHostNotOwned is returned when the recorded host can't be tied to the pod
+	errHostNotOwned = errors.New("the recorded Netmaker host doesn't belong to the pod")
+)
+
+// StaticIPReconciler assigns the addresses requested with netmaker.io/static-ip through the Netmaker API
+// netclient enrolls with whatever address the server hands out, so the node is updated once its host shows up
+type StaticIPReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+	Netmaker *netmakerapi.Client
+}
+
+// +kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+
+// Reconcile moves the pod's Netmaker node to its static address
+func (r *StaticIPReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	pod := &corev1.Pod{}
+	if err := r.Get(ctx, req.NamespacedName, pod); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if pod.DeletionTimestamp != nil {
+		return ctrl.Result{}, nil
+	}
+
+	ip, err := staticIPForPod(pod)
+	if err != nil {
+		r.Recorder.Event(pod, corev1.EventTypeWarning, eventReasonStaticIPInvalid, err.Error())
+		return ctrl.Result{}, nil
+	}
+	netclient := findNetclientContainer(pod)
+	if ip == nil || netclient == nil {
+		return ctrl.Result{}, nil
+	}
+	if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+		return ctrl.Result{}, nil
+	}
+
+	if err := checkNetclientHostName(pod); err != nil {
+		r.Recorder.Event(pod, corev1.EventTypeWarning, eventReasonStaticIPHostRejected, err.Error())
+		return ctrl.Result{}, nil
+	}
+	network := netclientNetwork(netclient)
+	if joinsExtraNetworks(netclient) {
+		// The address's network range picks the node
+		network = ""
+	}
+	node, err := r.findNode(ctx, pod, network, ip)
+	if errors.Is(err, errHostUnknown) {
+		logger.Info("Waiting for the operator to record the pod's Netmaker host", "pod", req.NamespacedName)
+		return ctrl.Result{RequeueAfter: staticIPEnrollRetry}, nil
+	}
+	if errors.Is(err, errHostNotOwned) {
+		// The host may not have reported the pod's current IP yet
+		r.Recorder.Eventf(pod, corev1.EventTypeWarning, eventReasonStaticIPHostRejected, "%v, not changing it", err)
+		return ctrl.Result{RequeueAfter: staticIPEnrollRetry}, nil
+	}
+	if err != nil {
+		logger.Error(err, "Failed to look up Netmaker node", "pod", req.NamespacedName)
+		return ctrl.Result{}, err
+	}
+	if node == nil {
+		logger.Info("Waiting for netclient to connect before assigning static IP", "pod", req.NamespacedName)
+		return ctrl.Result{RequeueAfter: staticIPEnrollRetry}, nil
+	}
+
+	current, _, _ := net.ParseCIDR(node.Address)
+	if current.Equal(ip) {
+		return ctrl.Result{RequeueAfter: staticIPResync}, nil
+	}
+
+	_, networkRange, err := net.ParseCIDR(node.NetworkRange)
+	if err != nil || !networkRange.Contains(ip) {
+		r.Recorder.Eventf(pod, corev1.EventTypeWarning, eventReasonStaticIPInvalid,
+			"Static IP %s is outside the range %s of network %s", ip, node.NetworkRange, node.Network)
+		return ctrl.Result{}, nil
+	}
+
+	// The server checks uniqueness too, but compares the whole CIDR against plain addresses, so check here first
+	owner, err := r.findAddressOwner(ctx, node, ip)
+	if err != nil {
+		logger.Error(err, "Failed to check static IP", "pod", req.NamespacedName, "ip", ip)
+		return ctrl.Result{}, err
+	}
+	if owner != "" {
+		r.Recorder.Eventf(pod, corev1.EventTypeWarning, eventReasonStaticIPConflict,
+			"Static IP %s is already used by %s in network %s", ip, owner, node.Network)
+		return ctrl.Result{RequeueAfter: staticIPResync}, nil
+	}
+
+	prefix, _ := networkRange.Mask.Size()
+	previous := node.Address
+	node.Address = fmt.Sprintf("%s/%d", ip, prefix)
+	if _, err := r.Netmaker.UpdateNode(ctx, node); err != nil {
+		if apiErr, ok := err.(*netmakerapi.APIError); ok && strings.Contains(apiErr.Message, "already allocated") {
+			r.Recorder.Eventf(pod, corev1.EventTypeWarning, eventReasonStaticIPConflict,
+				"Static IP %s is already allocated in network %s", ip, node.Network)
+			return ctrl.Result{RequeueAfter: staticIPResync}, nil
+		}
+		logger.Error(err, "Failed to assign static IP", "pod", req.NamespacedName, "ip", ip)
+		return ctrl.Result{}, err
+	}
+	r.Recorder.Eventf(pod, corev1.EventTypeNormal, eventReasonStaticIPAssigned,
+		"Assigned Netmaker address %s in network %s (was %s)", node.Address, node.Network, previous)
+	logger.Info("Assigned static IP", "pod", req.NamespacedName, "address", node.Address, "previous", previous, "network", node.Network)
+	return ctrl.Result{RequeueAfter: staticIPResync}, nil
+}
+
+// findNode returns the connected Netmaker node of the pod's host, or nil if it isn't connected yet
+// The host is the one the operator recorded in the pod's netmaker.io/netclient-host-id annotation, and it must
+// belong to the pod, see netclientHostOwnedBy; host names alone are never trusted, pods choose them.
+// Without a known network, the node whose network range contains ip is picked.
+func (r *StaticIPReconciler) findNode(ctx context.Context, pod *corev1.Pod, network string, ip net.IP) (*models.ApiNode, error) {
+	hostID := pod.Annotations[NetclientHostIDAnnotation]
+	if hostID == "" {
+		return nil, errHostUnknown
+	}
+	hosts, err := r.Netmaker.ListHosts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var host *models.ApiHost
+	for i := range hosts {
+		if hosts[i].ID == hostID {
+			host = &hosts[i]
+		}
+	}
+	if host == nil {
+		return nil, nil
+	}
+	if !netclientHostOwnedBy(host, pod) {
+		return nil, fmt.Errorf("%w: host %s is named %q and reports no interface with the pod IP", errHostNotOwned, host.ID, host.Name)
+	}
+
+	nodes, err := r.Netmaker.ListNodes(ctx, network)
+	if err != nil {
+		return nil, err
+	}
+	var match *models.ApiNode
+	for i := range nodes {
+		node := &nodes[i]
+		if node.HostID != hostID || !node.Connected {
+			continue
+		}
+		if network == "" {
+			if _, networkRange, err := net.ParseCIDR(node.NetworkRange); err != nil || !networkRange.Contains(ip) {
+				continue
+			}
+		}
+		if match != nil {
+			return nil, fmt.Errorf("host %s has several nodes whose range contains %s", hostID, ip)
+		}
+		match = node
+	}
+	return match, nil
+}
+
+// checkNetclientHostName checks that netclient registers the pod under the pod's own name
+// A custom spec.hostname could name any host, and host network pods share the node's name and IP.
+// StatefulSet pods get their own name as hostname.
+func checkNetclientHostName(pod *corev1.Pod) error {
+	if pod.Spec.HostNetwork {
+		return fmt.Errorf("pod %s uses the host network, so its Netmaker host can't be told apart from the node's", pod.Name)
+	}
+	if pod.Spec.Hostname != "" && pod.Spec.Hostname != pod.Name {
+		return fmt.Errorf("pod %s sets hostname %s, its Netmaker host must be named like the pod", pod.Name, pod.Spec.Hostname)
+	}
+	return nil
+}
+
+// netclientHostOwnedBy checks that a Netmaker host is the netclient of pod: it is named like the pod and reports
+// one of the pod's IPs as an interface address. The cluster assigns pod IPs, so the pod can't claim another host.
+func netclientHostOwnedBy(host *models.ApiHost, pod *corev1.Pod) bool {
+	if checkNetclientHostName(pod) != nil || host.Name != pod.Name {
+		return false
+	}
+	podIPs := map[string]bool{}
+	for _, podIP := range pod.Status.PodIPs {
+		podIPs[podIP.IP] = true
+	}
+	for _, iface := range host.Interfaces {
+		address, _, err := net.ParseCIDR(iface.AddressString)
+		if err != nil {
+			address = net.ParseIP(iface.AddressString)
+		}
+		if address != nil && podIPs[address.String()] {
+			return true
+		}
+	}
+	return false
+}
+
+// findAddressOwner returns the node or external client in node's network that holds ip, if any
+func (r *StaticIPReconciler) findAddressOwner(ctx context.Context, node *models.ApiNode, ip net.IP) (string, error) {
+	nodes, err := r.Netmaker.ListNodes(ctx, node.Network)
+	if err != nil {
+		return "", err
+	}
+	for _, other := range nodes {
+		if other.ID == node.ID {
+			continue
+		}
+		if address, _, err := net.ParseCIDR(other.Address); err == nil && address.Equal(ip) {
+			return "node " + other.ID, nil
+		}
+	}
+
+	extClients, err := r.Netmaker.ListExtClients(ctx, node.Network)
+	if err != nil {
+		return "", err
+	}
+	for _, extClient := range extClients {
+		if net.ParseIP(extClient.Address).Equal(ip) {
+			return "external client " + extClient.ClientID, nil
+		}
+	}
+	return "", nil
+}
+
+// staticIPForPod returns the static IP requested for a pod, nil if none
+// A list holds one address per StatefulSet ordinal; pods past the end of the list keep their assigned address
+func staticIPForPod(pod *corev1.Pod) (net.IP, error) {
+	value := pod.Annotations[staticIPAnnotation]
+	if value == "" {
+		return nil, nil
+	}
+	addresses, err := ParseStaticIPs(value)
+	if err != nil {
+		return nil, err
+	}
+	if len(addresses) == 1 {
+		return addresses[0], nil
+	}
+
+	ordinal := -1
+	if index := strings.LastIndex(pod.Name, "-"); index >= 0 && isOwnedByKind(pod, "StatefulSet") {
+		ordinal, _ = strconv.Atoi(pod.Name[index+1:])
+	}
+	if ordinal < 0 {
+		return nil, fmt.Errorf("%s lists several addresses but pod %s is not a StatefulSet replica", staticIPAnnotation, pod.Name)
+	}
+	if ordinal >= len(addresses) {
+		return nil, nil
+	}
+	return addresses[ordinal], nil
+}
+
+// ParseStaticIPs parses a netmaker.io/static-ip value: comma separated IPv4 addresses, no duplicates
+func ParseStaticIPs(value string) ([]net.IP, error) {
+	var addresses []net.IP
+	seen := map[string]bool{}
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		ip := net.ParseIP(part)
+		if ip == nil || ip.To4() == nil {
+			return nil, fmt.Errorf("%s %q is not an IPv4 address", staticIPAnnotation, part)
+		}
+		if seen[ip.String()] {
+			return nil, fmt.Errorf("%s lists %s twice", staticIPAnnotation, part)
+		}
+		seen[ip.String()] = true
+		addresses = append(addresses, ip)
+	}
+	return addresses, nil
+}
+
+// isOwnedByKind checks if a controller of kind owns obj
+func isOwnedByKind(obj client.Object, kind string) bool {
+	for _, owner := range obj.GetOwnerReferences() {
+		if owner.Kind == kind && owner.Controller != nil && *owner.Controller {
+			return true
+		}
+	}
+	return false
+}
+
+// findNetclientContainer returns the pod's netclient container, nil if it has none
+func findNetclientContainer(pod *corev1.Pod) *corev1.Container {
+	for _, containers := range [][]corev1.Container{pod.Spec.InitContainers, pod.Spec.Containers} {
+		for i := range containers {
+			if containers[i].Name == "netclient" {
+				return &containers[i]
+			}
+		}
+	}
+	return nil
+}
+
+// netclientNetwork returns the network netclient joins, if it is set explicitly
+func netclientNetwork(netclient *corev1.Container) string {
+	for _, env := range netclient.Env {
+		if env.Name == "NETWORK" {
+			return env.Value
+		}
+	}
+	return ""
+}
+
+// joinsExtraNetworks checks if netclient joins more networks than NETWORK (netmaker.io/networks)
+func joinsExtraNetworks(netclient *corev1.Container) bool {
+	for _, env := range netclient.Env {
+		if env.Name == "NETWORK_1" {
+			return true
+		}
+	}
+	return false
+}
+
+// syncProxyStaticIP copies the Service's static IP annotation onto its existing proxy pod
+// Pod annotations are mutable, so a changed address is reassigned without recreating the pod
+func syncProxyStaticIP(ctx context.Context, c client.Client, pod *corev1.Pod, service *corev1.Service) error {
+	desired := service.Annotations[staticIPAnnotation]
+	if pod.Annotations[staticIPAnnotation] == desired {
+		return nil
+	}
+	patch := client.MergeFrom(pod.DeepCopy())
+	if desired == "" {
+		delete(pod.Annotations, staticIPAnnotation)
+	} else {
+		if pod.Annotations == nil {
+			pod.Annotations = map[string]string{}
+		}
+		pod.Annotations[staticIPAnnotation] = desired
+	}
+	return c.Patch(ctx, pod, patch)
+}
+
+// hasStaticIPAnnotation checks if a pod requests a static IP
+func hasStaticIPAnnotation(obj client.Object) bool {
+	return obj.GetAnnotations()[staticIPAnnotation] != ""
+}
+
+// SetupWithManager sets up the controller with the Manager
+func (r *StaticIPReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("static-ip").
+		For(&corev1.Pod{}, builder.WithPredicates(predicate.NewPredicateFuncs(hasStaticIPAnnotation))).
+		Complete(r)
+}
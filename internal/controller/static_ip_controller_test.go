@@ -0,0 +1,259 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/gravitl/netmaker/models"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/gravitl/netmaker-k8s-ops/internal/netmakerapi"
+)
+
+var _ = Describe("Static IP", func() {
+	DescribeTable("ParseStaticIPs",
+		func(value string, expected []string, expectErr bool) {
+			addresses, err := ParseStaticIPs(value)
+			if expectErr {
+				Expect(err).To(HaveOccurred())
+				return
+			}
+			Expect(err).NotTo(HaveOccurred())
+			parsed := []string{}
+			for _, address := range addresses {
+				parsed = append(parsed, address.String())
+			}
+			Expect(parsed).To(Equal(expected))
+		},
+		Entry("one address", "10.101.0.20", []string{"10.101.0.20"}, false),
+		Entry("a list with spaces", "10.101.0.20, 10.101.0.21", []string{"10.101.0.20", "10.101.0.21"}, false),
+		Entry("empty", "", nil, true),
+		Entry("an empty entry", "10.101.0.20,", nil, true),
+		Entry("a host name", "db.edge", nil, true),
+		Entry("a CIDR", "10.101.0.20/24", nil, true),
+		Entry("IPv6", "fd00::20", nil, true),
+		Entry("a duplicate", "10.101.0.20,10.101.0.20", nil, true),
+	)
+
+	statefulSetPod := func(name, value string) *corev1.Pod {
+		return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name:            name,
+			Namespace:       "default",
+			Annotations:     map[string]string{staticIPAnnotation: value},
+			OwnerReferences: []metav1.OwnerReference{{Kind: "StatefulSet", Name: "db", Controller: &[]bool{true}[0]}},
+		}}
+	}
+
+	DescribeTable("staticIPForPod",
+		func(pod *corev1.Pod, expected string, expectErr bool) {
+			ip, err := staticIPForPod(pod)
+			if expectErr {
+				Expect(err).To(HaveOccurred())
+				return
+			}
+			Expect(err).NotTo(HaveOccurred())
+			if expected == "" {
+				Expect(ip).To(BeNil())
+				return
+			}
+			Expect(ip.String()).To(Equal(expected))
+		},
+		Entry("no annotation", &corev1.Pod{}, "", false),
+		Entry("one address", statefulSetPod("db-3", "10.101.0.20"), "10.101.0.20", false),
+		Entry("the address of the ordinal", statefulSetPod("db-1", "10.101.0.20,10.101.0.21"), "10.101.0.21", false),
+		Entry("an ordinal past the list", statefulSetPod("db-2", "10.101.0.20,10.101.0.21"), "", false),
+		Entry("a list on a pod without StatefulSet",
+			&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "db-1", Annotations: map[string]string{staticIPAnnotation: "10.101.0.20,10.101.0.21"}}},
+			"", true),
+		Entry("an invalid address", statefulSetPod("db-0", "10.101.0.300"), "", true),
+	)
+
+	Context("with the Netmaker API", func() {
+		var (
+			hosts   []models.ApiHost
+			nodes   []models.ApiNode
+			updates []models.ApiNode
+			api     *netmakerapi.Client
+		)
+
+		BeforeEach(func() {
+			hosts, nodes, updates = nil, nil, nil
+			mux := http.NewServeMux()
+			mux.HandleFunc("GET /api/hosts", func(w http.ResponseWriter, _ *http.Request) {
+				_ = json.NewEncoder(w).Encode(hosts)
+			})
+			mux.HandleFunc("GET /api/nodes/{network}", func(w http.ResponseWriter, req *http.Request) {
+				inNetwork := []models.ApiNode{}
+				for _, node := range nodes {
+					if node.Network == req.PathValue("network") {
+						inNetwork = append(inNetwork, node)
+					}
+				}
+				_ = json.NewEncoder(w).Encode(inNetwork)
+			})
+			mux.HandleFunc("GET /api/nodes", func(w http.ResponseWriter, _ *http.Request) {
+				_ = json.NewEncoder(w).Encode(nodes)
+			})
+			mux.HandleFunc("GET /api/extclients/{network}", func(w http.ResponseWriter, _ *http.Request) {
+				_, _ = w.Write([]byte("[]"))
+			})
+			mux.HandleFunc("PUT /api/nodes/{network}/{id}", func(w http.ResponseWriter, req *http.Request) {
+				node := models.ApiNode{}
+				Expect(json.NewDecoder(req.Body).Decode(&node)).To(Succeed())
+				updates = append(updates, node)
+				_ = json.NewEncoder(w).Encode(node)
+			})
+			server := httptest.NewServer(mux)
+			DeferCleanup(server.Close)
+			api = netmakerapi.NewClient(server.URL, "master-key", false)
+		})
+
+		node := func(id, hostID, address string, connected bool) models.ApiNode {
+			return models.ApiNode{ID: id, HostID: hostID, Network: "edge", Address: address, NetworkRange: "10.101.0.0/24", Connected: connected}
+		}
+
+		podIface := []models.ApiIface{{Name: "eth0", AddressString: "10.244.1.5/24"}}
+		runningPod := func(name, hostID string) *corev1.Pod {
+			pod := statefulSetPod(name, "10.101.0.20")
+			pod.Annotations[NetclientHostIDAnnotation] = hostID
+			pod.Status.PodIPs = []corev1.PodIP{{IP: "10.244.1.5"}}
+			return pod
+		}
+
+		DescribeTable("findNode",
+			func(pod *corev1.Pod, network, expected string, expectErr error) {
+				hosts = []models.ApiHost{
+					{ID: "stale", Name: "db-0", Interfaces: podIface},
+					{ID: "current", Name: "db-0", Interfaces: podIface},
+					{ID: "same-name", Name: "db-0", Interfaces: []models.ApiIface{{Name: "eth0", AddressString: "10.244.2.9/24"}}},
+					{ID: "other", Name: "db-1", Interfaces: podIface},
+				}
+				nodes = []models.ApiNode{
+					node("stale-node", "stale", "10.101.0.5/24", false),
+					node("current-node", "current", "10.101.0.6/24", true),
+					node("same-name-node", "same-name", "10.101.0.7/24", true),
+					node("other-node", "other", "10.101.0.8/24", true),
+				}
+				r := &StaticIPReconciler{Netmaker: api}
+
+				found, err := r.findNode(context.Background(), pod, network, net.ParseIP("10.101.0.20"))
+				if expectErr != nil {
+					Expect(err).To(MatchError(expectErr))
+					return
+				}
+				Expect(err).NotTo(HaveOccurred())
+				if expected == "" {
+					Expect(found).To(BeNil())
+					return
+				}
+				Expect(found.ID).To(Equal(expected))
+			},
+			Entry("uses the recorded host", runningPod("db-0", "current"), "edge", "current-node", nil),
+			Entry("picks the network by range", runningPod("db-0", "current"), "", "current-node", nil),
+			Entry("waits for the recorded host to connect", runningPod("db-0", "stale"), "edge", "", nil),
+			Entry("waits for a recorded host that hasn't enrolled", runningPod("db-0", "missing"), "edge", "", nil),
+			Entry("waits for the host to be recorded", runningPod("db-0", ""), "edge", "", errHostUnknown),
+			Entry("rejects a host of another pod", runningPod("db-0", "other"), "edge", "", errHostNotOwned),
+			Entry("rejects a host without the pod IP", runningPod("db-0", "same-name"), "edge", "", errHostNotOwned),
+		)
+
+		DescribeTable("checkNetclientHostName",
+			func(mutate func(*corev1.Pod), expectErr bool) {
+				pod := runningPod("db-0", "current")
+				mutate(pod)
+				if expectErr {
+					Expect(checkNetclientHostName(pod)).To(HaveOccurred())
+				} else {
+					Expect(checkNetclientHostName(pod)).To(Succeed())
+				}
+			},
+			Entry("accepts the pod name", func(*corev1.Pod) {}, false),
+			Entry("accepts the StatefulSet hostname", func(pod *corev1.Pod) { pod.Spec.Hostname = "db-0" }, false),
+			Entry("rejects a custom hostname", func(pod *corev1.Pod) { pod.Spec.Hostname = "db-1" }, true),
+			Entry("rejects host network pods", func(pod *corev1.Pod) { pod.Spec.HostNetwork = true }, true),
+		)
+
+		reconcilePod := func(pod *corev1.Pod) (*record.FakeRecorder, ctrl.Result) {
+			pod.Spec.Containers = []corev1.Container{{Name: "netclient", Env: []corev1.EnvVar{{Name: "NETWORK", Value: "edge"}}}}
+			pod.Status.Phase = corev1.PodRunning
+			recorder := record.NewFakeRecorder(10)
+			r := &StaticIPReconciler{
+				Client:   fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(pod).Build(),
+				Scheme:   scheme.Scheme,
+				Recorder: recorder,
+				Netmaker: api,
+			}
+			result, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: pod.Name}})
+			Expect(err).NotTo(HaveOccurred())
+			return recorder, result
+		}
+
+		It("moves the node of the recorded host to the static address", func() {
+			hosts = []models.ApiHost{{ID: "stale", Name: "db-0", Interfaces: podIface}, {ID: "current", Name: "db-0", Interfaces: podIface}}
+			nodes = []models.ApiNode{node("stale-node", "stale", "10.101.0.5/24", true), node("current-node", "current", "10.101.0.6/24", true)}
+
+			recorder, _ := reconcilePod(runningPod("db-0", "current"))
+			Expect(updates).To(HaveLen(1))
+			Expect(updates[0].ID).To(Equal("current-node"))
+			Expect(updates[0].Address).To(Equal("10.101.0.20/24"))
+			Expect(recorder.Events).To(Receive(HavePrefix("Normal " + eventReasonStaticIPAssigned)))
+		})
+
+		It("never picks a host by name", func() {
+			hosts = []models.ApiHost{{ID: "current", Name: "db-0", Interfaces: podIface}}
+			nodes = []models.ApiNode{node("current-node", "current", "10.101.0.6/24", true)}
+
+			_, result := reconcilePod(runningPod("db-0", ""))
+			Expect(updates).To(BeEmpty())
+			Expect(result.RequeueAfter).To(Equal(staticIPEnrollRetry))
+		})
+
+		It("changes nothing when the recorded host belongs to another pod", func() {
+			hosts = []models.ApiHost{{ID: "victim", Name: "db-7", Interfaces: []models.ApiIface{{Name: "eth0", AddressString: "10.244.3.7/24"}}}}
+			nodes = []models.ApiNode{node("victim-node", "victim", "10.101.0.9/24", true)}
+
+			recorder, _ := reconcilePod(runningPod("db-0", "victim"))
+			Expect(updates).To(BeEmpty())
+			Expect(recorder.Events).To(Receive(HavePrefix("Warning " + eventReasonStaticIPHostRejected)))
+		})
+
+		It("refuses pods with a custom hostname", func() {
+			hosts = []models.ApiHost{{ID: "current", Name: "db-0", Interfaces: podIface}}
+			nodes = []models.ApiNode{node("current-node", "current", "10.101.0.6/24", true)}
+			pod := runningPod("db-0", "current")
+			pod.Spec.Hostname = "db-7"
+
+			recorder, _ := reconcilePod(pod)
+			Expect(updates).To(BeEmpty())
+			Expect(recorder.Events).To(Receive(HavePrefix("Warning " + eventReasonStaticIPHostRejected)))
+		})
+	})
+})
@@ -0,0 +1,231 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package netmakerapi is a small client for the Netmaker server REST API used by the controllers
+package netmakerapi
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gravitl/netmaker/models"
+)
+
+// Client calls the Netmaker API with a master key or user API token
+type Client struct {
+	// BaseURL is the API server URL, e.g. https://api.netmaker.example.com
+	BaseURL string
+	// Token is sent as a Bearer token
+	Token      string
+	HTTPClient *http.Client
+}
+
+// NewClientFromEnv creates a client from API_SERVER_DOMAIN and API_TOKEN, the settings the proxy uses
+// It returns nil when the API isn't configured
+func NewClientFromEnv() *Client {
+	domain := os.Getenv("API_SERVER_DOMAIN")
+	token := os.Getenv("API_TOKEN")
+	if domain == "" || token == "" {
+		return nil
+	}
+	return NewClient(domain, token, os.Getenv("PROXY_SKIP_TLS_VERIFY") == "true")
+}
+
+// NewClient creates a client for server, a host name or a URL; a host name is reached over https
+func NewClient(server, token string, skipTLSVerify bool) *Client {
+	baseURL := server
+	if !strings.HasPrefix(baseURL, "http://") && !strings.HasPrefix(baseURL, "https://") {
+		baseURL = "https://" + baseURL
+	}
+	return &Client{
+		BaseURL: strings.TrimSuffix(baseURL, "/"),
+		Token:   token,
+		HTTPClient: &http.Client{
+			Timeout: 30 * time.Second,
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{
+					InsecureSkipVerify: skipTLSVerify,
+				},
+			},
+		},
+	}
+}
+
+// APIError is returned for non-2xx responses
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("netmaker API returned %d: %s", e.StatusCode, e.Message)
+}
+
+// ListHosts returns all hosts registered with the server
+func (c *Client) ListHosts(ctx context.Context) ([]models.ApiHost, error) {
+	var hosts []models.ApiHost
+	if err := c.do(ctx, http.MethodGet, "/api/hosts", nil, &hosts); err != nil {
+		return nil, err
+	}
+	return hosts, nil
+}
+
+// DeleteHost removes a host and its nodes from every network; force skips waiting for netclient to confirm
+func (c *Client) DeleteHost(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/api/hosts/"+url.PathEscape(id)+"?force=true", nil, nil)
+}
+
+// ListNodes returns the nodes of a network, or of all networks when network is empty
+func (c *Client) ListNodes(ctx context.Context, network string) ([]models.ApiNode, error) {
+	path := "/api/nodes"
+	if network != "" {
+		path += "/" + url.PathEscape(network)
+	}
+	var nodes []models.ApiNode
+	if err := c.do(ctx, http.MethodGet, path, nil, &nodes); err != nil {
+		return nil, err
+	}
+	return nodes, nil
+}
+
+// ListExtClients returns the external clients of a network
+func (c *Client) ListExtClients(ctx context.Context, network string) ([]models.ExtClient, error) {
+	var clients []models.ExtClient
+	if err := c.do(ctx, http.MethodGet, "/api/extclients/"+url.PathEscape(network), nil, &clients); err != nil {
+		return nil, err
+	}
+	return clients, nil
+}
+
+// UpdateNode saves node; the server rejects addresses that are already allocated in the network
+func (c *Client) UpdateNode(ctx context.Context, node *models.ApiNode) (*models.ApiNode, error) {
+	path := fmt.Sprintf("/api/nodes/%s/%s", url.PathEscape(node.Network), url.PathEscape(node.ID))
+	updated := &models.ApiNode{}
+	if err := c.do(ctx, http.MethodPut, path, node, updated); err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// Egress is an egress resource: a range routed through the nodes in Nodes, keyed by node ID with the route
+// metric as value; peers prefer the node with the lowest metric
+type Egress struct {
+	ID          string         `json:"id"`
+	Name        string         `json:"name"`
+	Network     string         `json:"network"`
+	Description string         `json:"description"`
+	Nodes       map[string]int `json:"nodes"`
+	Range       string         `json:"range"`
+	Nat         bool           `json:"nat"`
+	Status      bool           `json:"status"`
+}
+
+// ListEgress returns the egress resources of a network
+func (c *Client) ListEgress(ctx context.Context, network string) ([]Egress, error) {
+	var egress []Egress
+	if err := c.doWrapped(ctx, http.MethodGet, "/api/v1/egress?network="+url.QueryEscape(network), nil, &egress); err != nil {
+		return nil, err
+	}
+	return egress, nil
+}
+
+// CreateEgress creates an egress resource; the server assigns its ID
+func (c *Client) CreateEgress(ctx context.Context, egress *Egress) (*Egress, error) {
+	created := &Egress{}
+	if err := c.doWrapped(ctx, http.MethodPost, "/api/v1/egress", egress, created); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// UpdateEgress saves an egress resource, matched by ID
+func (c *Client) UpdateEgress(ctx context.Context, egress *Egress) error {
+	return c.doWrapped(ctx, http.MethodPut, "/api/v1/egress", egress, nil)
+}
+
+// DeleteEgress deletes an egress resource
+func (c *Client) DeleteEgress(ctx context.Context, id string) error {
+	return c.doWrapped(ctx, http.MethodDelete, "/api/v1/egress?id="+url.QueryEscape(id), nil, nil)
+}
+
+// doWrapped calls an endpoint that wraps its result in {"Code":200,"Message":"...","Response":...}
+func (c *Client) doWrapped(ctx context.Context, method, path string, in, out interface{}) error {
+	var resp struct {
+		Response json.RawMessage
+	}
+	if err := c.do(ctx, method, path, in, &resp); err != nil {
+		return err
+	}
+	if out == nil || len(resp.Response) == 0 || string(resp.Response) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(resp.Response, out); err != nil {
+		return fmt.Errorf("failed to decode %s %s response: %w", method, path, err)
+	}
+	return nil
+}
+
+// do sends a request and decodes the JSON response into out
+func (c *Client) do(ctx context.Context, method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call %s %s: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		data, _ := io.ReadAll(resp.Body)
+		// Errors come back as {"Code":400,"Message":"..."}
+		apiErr := &APIError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(data))}
+		errResp := models.ErrorResponse{}
+		if json.Unmarshal(data, &errResp) == nil && errResp.Message != "" {
+			apiErr.Message = errResp.Message
+		}
+		return apiErr
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode %s %s response: %w", method, path, err)
+	}
+	return nil
+}
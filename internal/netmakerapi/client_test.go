@@ -0,0 +1,153 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package netmakerapi
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/gravitl/netmaker/models"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// recordedRequest is what the test server saw of a request
+type recordedRequest struct {
+	Method        string
+	URI           string
+	Authorization string
+	Body          string
+}
+
+var _ = Describe("Client", func() {
+	var (
+		requests []recordedRequest
+		status   int
+		response string
+		c        *Client
+	)
+
+	BeforeEach(func() {
+		requests = nil
+		status = http.StatusOK
+		response = "null"
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			body, _ := io.ReadAll(req.Body)
+			requests = append(requests, recordedRequest{
+				Method:        req.Method,
+				URI:           req.URL.RequestURI(),
+				Authorization: req.Header.Get("Authorization"),
+				Body:          string(body),
+			})
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			_, _ = io.WriteString(w, response)
+		}))
+		DeferCleanup(server.Close)
+		c = NewClient(server.URL+"/", "master-key", false)
+	})
+
+	It("reaches host names over https", func() {
+		Expect(NewClient("api.netmaker.example.com", "key", false).BaseURL).To(Equal("https://api.netmaker.example.com"))
+		Expect(NewClient("http://localhost:8081/", "key", false).BaseURL).To(Equal("http://localhost:8081"))
+	})
+
+	It("lists hosts with the token", func() {
+		response = `[{"id":"host-1","name":"web-0"},{"id":"host-2","name":"web-1"}]`
+
+		hosts, err := c.ListHosts(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(hosts).To(HaveLen(2))
+		Expect(hosts[1].ID).To(Equal("host-2"))
+		Expect(hosts[1].Name).To(Equal("web-1"))
+		Expect(requests).To(Equal([]recordedRequest{{Method: http.MethodGet, URI: "/api/hosts", Authorization: "Bearer master-key"}}))
+	})
+
+	DescribeTable("lists nodes",
+		func(network, uri string) {
+			response = `[{"id":"node-1","hostid":"host-1","network":"edge","connected":true}]`
+
+			nodes, err := c.ListNodes(context.Background(), network)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(nodes).To(HaveLen(1))
+			Expect(nodes[0].HostID).To(Equal("host-1"))
+			Expect(nodes[0].Connected).To(BeTrue())
+			Expect(requests[0].URI).To(Equal(uri))
+		},
+		Entry("of all networks", "", "/api/nodes"),
+		Entry("of one network", "edge", "/api/nodes/edge"),
+		Entry("escaping the network", "a/b", "/api/nodes/a%2Fb"),
+	)
+
+	It("updates a node in its network", func() {
+		response = `{"id":"node-1","network":"edge","address":"10.101.0.20/24"}`
+
+		updated, err := c.UpdateNode(context.Background(), &models.ApiNode{ID: "node-1", Network: "edge", Address: "10.101.0.20/24"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(updated.Address).To(Equal("10.101.0.20/24"))
+		Expect(requests[0].Method).To(Equal(http.MethodPut))
+		Expect(requests[0].URI).To(Equal("/api/nodes/edge/node-1"))
+
+		sent := models.ApiNode{}
+		Expect(json.Unmarshal([]byte(requests[0].Body), &sent)).To(Succeed())
+		Expect(sent.Address).To(Equal("10.101.0.20/24"))
+	})
+
+	It("force deletes hosts", func() {
+		Expect(c.DeleteHost(context.Background(), "host-1")).To(Succeed())
+		Expect(requests[0].Method).To(Equal(http.MethodDelete))
+		Expect(requests[0].URI).To(Equal("/api/hosts/host-1?force=true"))
+	})
+
+	It("unwraps egress responses", func() {
+		response = `{"Code":200,"Message":"fetched egress","Response":[{"id":"egress-1","network":"edge","range":"10.0.0.0/16","nodes":{"node-1":100}}]}`
+
+		egress, err := c.ListEgress(context.Background(), "edge")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(egress).To(Equal([]Egress{{ID: "egress-1", Network: "edge", Range: "10.0.0.0/16", Nodes: map[string]int{"node-1": 100}}}))
+		Expect(requests[0].URI).To(Equal("/api/v1/egress?network=edge"))
+
+		response = `{"Code":200,"Message":"deleted egress","Response":null}`
+		Expect(c.DeleteEgress(context.Background(), "egress-1")).To(Succeed())
+		Expect(requests[1].URI).To(Equal("/api/v1/egress?id=egress-1"))
+	})
+
+	DescribeTable("returns API errors",
+		func(body, message string) {
+			status = http.StatusBadRequest
+			response = body
+
+			_, err := c.ListHosts(context.Background())
+			apiErr, ok := err.(*APIError)
+			Expect(ok).To(BeTrue())
+			Expect(apiErr.StatusCode).To(Equal(http.StatusBadRequest))
+			Expect(apiErr.Message).To(Equal(message))
+		},
+		Entry("with the server message", `{"Code":400,"Message":"address 10.101.0.20 is already allocated"}`, "address 10.101.0.20 is already allocated"),
+		Entry("with a plain body", "bad request\n", "bad request"),
+	)
+
+	It("fails on responses it can't decode", func() {
+		response = `{"id":`
+
+		_, err := c.ListHosts(context.Background())
+		Expect(err).To(MatchError(ContainSubstring("failed to decode GET /api/hosts response")))
+	})
+})
@@ -0,0 +1,107 @@
+package webhook
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// lifecycleVolumeName is the shared volume app containers write their completion sentinels to
+	lifecycleVolumeName = "netclient-lifecycle"
+	// lifecycleMountPath is where the lifecycle volume is mounted in every container
+	lifecycleMountPath = "/var/run/netclient-lifecycle"
+	// doneFileEnv tells app containers which sentinel file to create when they finish
+	doneFileEnv = "NETCLIENT_DONE_FILE"
+)
+
+// isBatchPodSpec checks if the pod runs to completion (Job, CronJob or a bare pod that isn't restarted)
+func isBatchPodSpec(podSpec *corev1.PodSpec) bool {
+	return podSpec.RestartPolicy == corev1.RestartPolicyNever || podSpec.RestartPolicy == corev1.RestartPolicyOnFailure
+}
+
+// addCompletionSentinel makes netclient exit once every app container has finished
+// Each app container gets a sentinel file on a shared emptyDir. Containers with an explicit command are wrapped
+// in /bin/sh -c so the sentinel is written automatically, which fails for images without a shell such as
+// distroless ones; containers relying on the image entrypoint must create $NETCLIENT_DONE_FILE themselves.
+// netclient runs its normal entrypoint in the background and stops once all sentinels exist. This is only
+// needed without native sidecars, which kubelet stops by itself.
+// startScript starts the entrypoint, see buildNetclientStartScript.
+// Returns a warning for every container that has to write its sentinel itself.
+func addCompletionSentinel(podSpec *corev1.PodSpec, netclient *corev1.Container, startScript string) []string {
+	// With OnFailure the app container is restarted after a failure, so only a successful run may stop netclient
+	onlyOnSuccess := podSpec.RestartPolicy == corev1.RestartPolicyOnFailure
+
+	var doneFiles, warnings []string
+	for i := range podSpec.Containers {
+		container := &podSpec.Containers[i]
+		doneFile := fmt.Sprintf("%s/%s.done", lifecycleMountPath, container.Name)
+		doneFiles = append(doneFiles, doneFile)
+
+		container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+			Name:      lifecycleVolumeName,
+			MountPath: lifecycleMountPath,
+		})
+		container.Env = append(container.Env, corev1.EnvVar{Name: doneFileEnv, Value: doneFile})
+
+		if len(container.Command) == 0 {
+			warnings = append(warnings, fmt.Sprintf("container %s has no command, so it can't be wrapped: it must create "+
+				"$%s when it finishes, or netclient keeps the pod from completing. Set a command or enable native sidecars",
+				container.Name, doneFileEnv))
+			continue
+		}
+		container.Command = append([]string{"/bin/sh", "-c", buildCompletionWrapper(onlyOnSuccess), "netclient-wrapper"}, container.Command...)
+	}
+
+	netclient.VolumeMounts = append(netclient.VolumeMounts, corev1.VolumeMount{
+		Name:      lifecycleVolumeName,
+		MountPath: lifecycleMountPath,
+	})
+	netclient.Command = []string{"/bin/sh", "-c", buildNetclientCompletionCommand(doneFiles, startScript)}
+
+	for _, volume := range podSpec.Volumes {
+		if volume.Name == lifecycleVolumeName {
+			return warnings
+		}
+	}
+	podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+		Name:         lifecycleVolumeName,
+		VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+	})
+	return warnings
+}
+
+// buildCompletionWrapper creates the shell wrapper that runs the original command and writes the sentinel
+// The original command and args are passed as positional parameters so no quoting is needed
+func buildCompletionWrapper(onlyOnSuccess bool) string {
+	touch := `touch "$NETCLIENT_DONE_FILE"`
+	if onlyOnSuccess {
+		touch = `[ "$rc" -eq 0 ] && ` + touch
+	}
+	return fmt.Sprintf(`"$@"
+rc=$?
+%s
+exit $rc`, touch)
+}
+
+// buildNetclientCompletionCommand creates the netclient command that stops the daemon once all sentinels exist
+func buildNetclientCompletionCommand(doneFiles []string, startScript string) string {
+	return fmt.Sprintf(`%swhile true; do
+  finished=true
+  for f in %s; do
+    [ -f "$f" ] || finished=false
+  done
+  if [ "$finished" = true ]; then
+    echo "[netclient] app containers finished, stopping"
+    kill -TERM $pid
+    wait $pid
+    exit 0
+  fi
+  if ! kill -0 $pid 2>/dev/null; then
+    wait $pid
+    exit $?
+  fi
+  sleep 2
+done`, startScript, strings.Join(doneFiles, " "))
+}
@@ -0,0 +1,343 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// certValidity is how long generated certificates are valid
+	certValidity = 365 * 24 * time.Hour
+	// certRenewBefore is how long before expiry certificates are rotated
+	certRenewBefore = 30 * 24 * time.Hour
+	// certCheckInterval is how often the certificates and caBundle are checked
+	certCheckInterval = time.Hour
+
+	secretCACert   = "ca.crt"
+	secretCAKey    = "ca.key"
+	secretCABundle = "ca-bundle.crt"
+	secretTLSCert  = "tls.crt"
+	secretTLSKey   = "tls.key"
+)
+
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update
+// +kubebuilder:rbac:groups=admissionregistration.k8s.io,resources=mutatingwebhookconfigurations,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=admissionregistration.k8s.io,resources=validatingwebhookconfigurations,verbs=get;list;watch;update;patch
+
+// CertManager generates and rotates the webhook serving certificate without cert-manager
+// The CA and serving certificate are stored in a Secret so all operator replicas serve the same certificate,
+// written to CertDir for the webhook server, and the CA is patched into the webhook configurations' caBundle
+type CertManager struct {
+	Client client.Client
+	// CertDir is the directory the webhook server reads tls.crt and tls.key from
+	CertDir string
+	// SecretName is the Secret holding the generated CA and serving certificate
+	SecretName string
+	// Namespace is the namespace of the webhook Service and the Secret
+	Namespace string
+	// ServiceName is the webhook Service the certificate is issued for
+	ServiceName string
+	// WebhookConfigName is the MutatingWebhookConfiguration whose caBundle is kept up to date
+	WebhookConfigName string
+	// ValidatingWebhookConfigName is the ValidatingWebhookConfiguration whose caBundle is kept up to date, if set
+	ValidatingWebhookConfigName string
+}
+
+// EnsureCerts makes sure a valid certificate exists, is written to CertDir and is trusted by the API server
+// It must be called before the webhook server starts, since the server needs the certificate files
+func (m *CertManager) EnsureCerts(ctx context.Context) error {
+	secret, err := m.ensureSecret(ctx)
+	if err != nil {
+		return err
+	}
+	if err := m.writeCertFiles(secret); err != nil {
+		return err
+	}
+	if err := m.patchCABundle(ctx, secret.Data[secretCABundle]); err != nil {
+		return err
+	}
+	return m.patchValidatingCABundle(ctx, secret.Data[secretCABundle])
+}
+
+// Start periodically rotates the certificate and refreshes the files and caBundle
+func (m *CertManager) Start(ctx context.Context) error {
+	ticker := time.NewTicker(certCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := m.EnsureCerts(ctx); err != nil {
+				klog.Error(err, "Failed to refresh webhook certificates")
+			}
+		}
+	}
+}
+
+// NeedLeaderElection returns false so every replica keeps its certificate files up to date
+func (m *CertManager) NeedLeaderElection() bool {
+	return false
+}
+
+// ensureSecret returns the certificate Secret, creating or rotating it when needed
+func (m *CertManager) ensureSecret(ctx context.Context) (*corev1.Secret, error) {
+	secret := &corev1.Secret{}
+	err := m.Client.Get(ctx, types.NamespacedName{Name: m.SecretName, Namespace: m.Namespace}, secret)
+	if errors.IsNotFound(err) {
+		klog.Info("Generating webhook certificates", "secret", m.SecretName, "namespace", m.Namespace)
+		data, err := m.generateCerts(nil)
+		if err != nil {
+			return nil, err
+		}
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      m.SecretName,
+				Namespace: m.Namespace,
+				Labels: map[string]string{
+					"app.kubernetes.io/component":  "webhook",
+					"app.kubernetes.io/managed-by": "netmaker-k8s-ops",
+				},
+			},
+			Type: corev1.SecretTypeOpaque,
+			Data: data,
+		}
+		if err := m.Client.Create(ctx, secret); err != nil {
+			if errors.IsAlreadyExists(err) {
+				// Another replica created it first
+				return m.ensureSecret(ctx)
+			}
+			return nil, fmt.Errorf("failed to create webhook certificate secret: %w", err)
+		}
+		return secret, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook certificate secret: %w", err)
+	}
+
+	if !m.needsRotation(secret) {
+		return secret, nil
+	}
+
+	klog.Info("Rotating webhook certificates", "secret", m.SecretName, "namespace", m.Namespace)
+	data, err := m.generateCerts(secret.Data[secretCACert])
+	if err != nil {
+		return nil, err
+	}
+	secret.Data = data
+	// Update uses the resourceVersion, so only one replica wins a concurrent rotation
+	if err := m.Client.Update(ctx, secret); err != nil {
+		if errors.IsConflict(err) {
+			return m.ensureSecret(ctx)
+		}
+		return nil, fmt.Errorf("failed to update webhook certificate secret: %w", err)
+	}
+	return secret, nil
+}
+
+// needsRotation checks if the stored serving certificate is missing, invalid, close to expiry or issued for another Service
+func (m *CertManager) needsRotation(secret *corev1.Secret) bool {
+	block, _ := pem.Decode(secret.Data[secretTLSCert])
+	if block == nil || len(secret.Data[secretTLSKey]) == 0 || len(secret.Data[secretCABundle]) == 0 {
+		return true
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return true
+	}
+	if time.Until(cert.NotAfter) < certRenewBefore {
+		return true
+	}
+	return cert.VerifyHostname(m.serviceHost()) != nil
+}
+
+// generateCerts creates a new CA and serving certificate
+// previousCA is kept in the caBundle so clients trusting the old CA keep working while replicas pick up the new certificate
+func (m *CertManager) generateCerts(previousCA []byte) (map[string][]byte, error) {
+	now := time.Now()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate CA key: %w", err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          randomSerial(),
+		Subject:               pkix.Name{CommonName: "netmaker-k8s-ops-webhook-ca"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(certValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CA certificate: %w", err)
+	}
+	caCert, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		return nil, err
+	}
+
+	servingKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate serving key: %w", err)
+	}
+	servingTemplate := &x509.Certificate{
+		SerialNumber: randomSerial(),
+		Subject:      pkix.Name{CommonName: m.serviceHost()},
+		DNSNames: []string{
+			m.ServiceName,
+			fmt.Sprintf("%s.%s", m.ServiceName, m.Namespace),
+			m.serviceHost(),
+			fmt.Sprintf("%s.%s.svc.cluster.local", m.ServiceName, m.Namespace),
+		},
+		NotBefore:   now.Add(-time.Hour),
+		NotAfter:    now.Add(certValidity),
+		KeyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	servingDER, err := x509.CreateCertificate(rand.Reader, servingTemplate, caCert, &servingKey.PublicKey, caKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create serving certificate: %w", err)
+	}
+
+	caKeyDER, err := x509.MarshalECPrivateKey(caKey)
+	if err != nil {
+		return nil, err
+	}
+	servingKeyDER, err := x509.MarshalECPrivateKey(servingKey)
+	if err != nil {
+		return nil, err
+	}
+
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER})
+	caBundle := append([]byte{}, caPEM...)
+	if len(previousCA) > 0 {
+		caBundle = append(caBundle, previousCA...)
+	}
+
+	return map[string][]byte{
+		secretCACert:   caPEM,
+		secretCAKey:    pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: caKeyDER}),
+		secretCABundle: caBundle,
+		secretTLSCert:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: servingDER}),
+		secretTLSKey:   pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: servingKeyDER}),
+	}, nil
+}
+
+// writeCertFiles writes the serving certificate to CertDir when it changed
+// The webhook server watches these files and reloads them on change
+func (m *CertManager) writeCertFiles(secret *corev1.Secret) error {
+	if err := os.MkdirAll(m.CertDir, 0o700); err != nil {
+		return fmt.Errorf("failed to create certificate directory: %w", err)
+	}
+	// Write the key first so the watcher never pairs a new certificate with an old key for long
+	for _, name := range []string{secretTLSKey, secretTLSCert} {
+		path := filepath.Join(m.CertDir, name)
+		if existing, err := os.ReadFile(path); err == nil && bytes.Equal(existing, secret.Data[name]) {
+			continue
+		}
+		if err := os.WriteFile(path, secret.Data[name], 0o600); err != nil {
+			return fmt.Errorf("failed to write %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// patchCABundle sets the caBundle of every webhook in the MutatingWebhookConfiguration
+func (m *CertManager) patchCABundle(ctx context.Context, caBundle []byte) error {
+	config := &admissionregistrationv1.MutatingWebhookConfiguration{}
+	if err := m.Client.Get(ctx, types.NamespacedName{Name: m.WebhookConfigName}, config); err != nil {
+		if errors.IsNotFound(err) {
+			// The configuration may be installed after the operator; it is patched on the next check
+			klog.Warning("MutatingWebhookConfiguration not found, skipping caBundle injection", "name", m.WebhookConfigName)
+			return nil
+		}
+		return fmt.Errorf("failed to get MutatingWebhookConfiguration: %w", err)
+	}
+
+	patch := client.MergeFrom(config.DeepCopy())
+	changed := false
+	for i := range config.Webhooks {
+		if !bytes.Equal(config.Webhooks[i].ClientConfig.CABundle, caBundle) {
+			config.Webhooks[i].ClientConfig.CABundle = caBundle
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+
+	klog.Info("Patching webhook caBundle", "name", m.WebhookConfigName)
+	if err := m.Client.Patch(ctx, config, patch); err != nil {
+		return fmt.Errorf("failed to patch MutatingWebhookConfiguration caBundle: %w", err)
+	}
+	return nil
+}
+
+// patchValidatingCABundle sets the caBundle of every webhook in the ValidatingWebhookConfiguration
+func (m *CertManager) patchValidatingCABundle(ctx context.Context, caBundle []byte) error {
+	if m.ValidatingWebhookConfigName == "" {
+		return nil
+	}
+	config := &admissionregistrationv1.ValidatingWebhookConfiguration{}
+	if err := m.Client.Get(ctx, types.NamespacedName{Name: m.ValidatingWebhookConfigName}, config); err != nil {
+		if errors.IsNotFound(err) {
+			klog.Warning("ValidatingWebhookConfiguration not found, skipping caBundle injection", "name", m.ValidatingWebhookConfigName)
+			return nil
+		}
+		return fmt.Errorf("failed to get ValidatingWebhookConfiguration: %w", err)
+	}
+
+	patch := client.MergeFrom(config.DeepCopy())
+	changed := false
+	for i := range config.Webhooks {
+		if !bytes.Equal(config.Webhooks[i].ClientConfig.CABundle, caBundle) {
+			config.Webhooks[i].ClientConfig.CABundle = caBundle
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+
+	klog.Info("Patching validating webhook caBundle", "name", m.ValidatingWebhookConfigName)
+	if err := m.Client.Patch(ctx, config, patch); err != nil {
+		return fmt.Errorf("failed to patch ValidatingWebhookConfiguration caBundle: %w", err)
+	}
+	return nil
+}
+
+// serviceHost returns the in-cluster DNS name the API server uses to reach the webhook
+func (m *CertManager) serviceHost() string {
+	return fmt.Sprintf("%s.%s.svc", m.ServiceName, m.Namespace)
+}
+
+// randomSerial returns a random certificate serial number
+func randomSerial() *big.Int {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return big.NewInt(time.Now().UnixNano())
+	}
+	return serial
+}
@@ -0,0 +1,227 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("CertManager", func() {
+	newCertManager := func() *CertManager {
+		return &CertManager{
+			CertDir:           GinkgoT().TempDir(),
+			SecretName:        "netmaker-webhook-certs",
+			Namespace:         "netmaker-k8s-ops-system",
+			ServiceName:       "netmaker-webhook",
+			WebhookConfigName: "netclient-sidecar-webhook",
+		}
+	}
+
+	// parseCerts decodes every certificate in a PEM bundle
+	parseCerts := func(data []byte) []*x509.Certificate {
+		var certs []*x509.Certificate
+		for {
+			var block *pem.Block
+			block, data = pem.Decode(data)
+			if block == nil {
+				return certs
+			}
+			cert, err := x509.ParseCertificate(block.Bytes)
+			Expect(err).NotTo(HaveOccurred())
+			certs = append(certs, cert)
+		}
+	}
+
+	// verifyServingCert checks the serving certificate against the CAs in caBundle for the webhook Service host
+	verifyServingCert := func(m *CertManager, data map[string][]byte, caBundle []byte) error {
+		pool := x509.NewCertPool()
+		Expect(pool.AppendCertsFromPEM(caBundle)).To(BeTrue())
+		serving := parseCerts(data[secretTLSCert])
+		Expect(serving).To(HaveLen(1))
+		_, err := serving[0].Verify(x509.VerifyOptions{
+			DNSName:   m.serviceHost(),
+			Roots:     pool,
+			KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		})
+		return err
+	}
+
+	// servingCertExpiringIn returns a self-signed serving certificate for the webhook Service that expires after validity
+	servingCertExpiringIn := func(m *CertManager, validity time.Duration) []byte {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).NotTo(HaveOccurred())
+		template := &x509.Certificate{
+			SerialNumber: randomSerial(),
+			Subject:      pkix.Name{CommonName: m.serviceHost()},
+			DNSNames:     []string{m.serviceHost()},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(validity),
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+		Expect(err).NotTo(HaveOccurred())
+		return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	}
+
+	Context("generateCerts", func() {
+		It("issues a serving certificate for the webhook Service signed by the new CA", func() {
+			m := newCertManager()
+			data, err := m.generateCerts(nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(data).To(HaveKey(secretCAKey))
+			Expect(data).To(HaveKey(secretTLSKey))
+			Expect(data[secretCABundle]).To(Equal(data[secretCACert]))
+
+			ca := parseCerts(data[secretCACert])
+			Expect(ca).To(HaveLen(1))
+			Expect(ca[0].IsCA).To(BeTrue())
+
+			serving := parseCerts(data[secretTLSCert])[0]
+			Expect(serving.DNSNames).To(ConsistOf(
+				"netmaker-webhook",
+				"netmaker-webhook.netmaker-k8s-ops-system",
+				"netmaker-webhook.netmaker-k8s-ops-system.svc",
+				"netmaker-webhook.netmaker-k8s-ops-system.svc.cluster.local",
+			))
+			Expect(serving.NotAfter).To(BeTemporally("~", time.Now().Add(certValidity), time.Minute))
+			Expect(verifyServingCert(m, data, data[secretCABundle])).To(Succeed())
+		})
+
+		It("keeps the previous CA in the bundle", func() {
+			m := newCertManager()
+			previous, err := m.generateCerts(nil)
+			Expect(err).NotTo(HaveOccurred())
+
+			rotated, err := m.generateCerts(previous[secretCACert])
+			Expect(err).NotTo(HaveOccurred())
+
+			bundle := parseCerts(rotated[secretCABundle])
+			Expect(bundle).To(HaveLen(2))
+			Expect(bundle[0].Equal(parseCerts(rotated[secretCACert])[0])).To(BeTrue())
+			Expect(bundle[1].Equal(parseCerts(previous[secretCACert])[0])).To(BeTrue())
+
+			// The new and the old serving certificate are both trusted while replicas pick up the new one
+			Expect(verifyServingCert(m, rotated, rotated[secretCABundle])).To(Succeed())
+			Expect(verifyServingCert(m, previous, rotated[secretCABundle])).To(Succeed())
+			Expect(verifyServingCert(m, rotated, previous[secretCABundle])).NotTo(Succeed())
+		})
+	})
+
+	Context("needsRotation", func() {
+		It("keeps a fresh certificate", func() {
+			m := newCertManager()
+			data, err := m.generateCerts(nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(m.needsRotation(&corev1.Secret{Data: data})).To(BeFalse())
+		})
+
+		It("rotates incomplete secrets", func() {
+			m := newCertManager()
+			data, err := m.generateCerts(nil)
+			Expect(err).NotTo(HaveOccurred())
+			for _, key := range []string{secretTLSCert, secretTLSKey, secretCABundle} {
+				incomplete := map[string][]byte{}
+				for k, v := range data {
+					if k != key {
+						incomplete[k] = v
+					}
+				}
+				Expect(m.needsRotation(&corev1.Secret{Data: incomplete})).To(BeTrue(), "without %s", key)
+			}
+			Expect(m.needsRotation(&corev1.Secret{Data: map[string][]byte{
+				secretTLSCert:  []byte("-----BEGIN CERTIFICATE-----\naW52YWxpZA==\n-----END CERTIFICATE-----\n"),
+				secretTLSKey:   data[secretTLSKey],
+				secretCABundle: data[secretCABundle],
+			}})).To(BeTrue())
+		})
+
+		DescribeTable("rotates within 30 days of expiry",
+			func(validity time.Duration, expected bool) {
+				m := newCertManager()
+				data, err := m.generateCerts(nil)
+				Expect(err).NotTo(HaveOccurred())
+				data[secretTLSCert] = servingCertExpiringIn(m, validity)
+				Expect(m.needsRotation(&corev1.Secret{Data: data})).To(Equal(expected))
+			},
+			Entry("expired", -time.Hour, true),
+			Entry("expires in 29 days", 29*24*time.Hour, true),
+			Entry("expires in 31 days", 31*24*time.Hour, false),
+		)
+
+		It("rotates a certificate issued for another Service", func() {
+			m := newCertManager()
+			data, err := m.generateCerts(nil)
+			Expect(err).NotTo(HaveOccurred())
+			m.ServiceName = "other-webhook"
+			Expect(m.needsRotation(&corev1.Secret{Data: data})).To(BeTrue())
+		})
+	})
+
+	It("rotates the stored certificate, writes the files and patches the caBundle", func() {
+		ctx := context.Background()
+		m := newCertManager()
+		previous, err := m.generateCerts(nil)
+		Expect(err).NotTo(HaveOccurred())
+		previous[secretTLSCert] = servingCertExpiringIn(m, 24*time.Hour)
+
+		m.Client = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+			&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: m.SecretName, Namespace: m.Namespace},
+				Data:       previous,
+			},
+			&admissionregistrationv1.MutatingWebhookConfiguration{
+				ObjectMeta: metav1.ObjectMeta{Name: m.WebhookConfigName},
+				Webhooks:   []admissionregistrationv1.MutatingWebhook{{Name: "netclient-sidecar.netmaker.io"}},
+			},
+		).Build()
+
+		Expect(m.EnsureCerts(ctx)).To(Succeed())
+
+		secret := &corev1.Secret{}
+		Expect(m.Client.Get(ctx, types.NamespacedName{Name: m.SecretName, Namespace: m.Namespace}, secret)).To(Succeed())
+		Expect(m.needsRotation(secret)).To(BeFalse())
+		Expect(parseCerts(secret.Data[secretCABundle])).To(HaveLen(2))
+
+		for _, name := range []string{secretTLSCert, secretTLSKey} {
+			written, err := os.ReadFile(filepath.Join(m.CertDir, name))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(written).To(Equal(secret.Data[name]))
+		}
+
+		config := &admissionregistrationv1.MutatingWebhookConfiguration{}
+		Expect(m.Client.Get(ctx, types.NamespacedName{Name: m.WebhookConfigName}, config)).To(Succeed())
+		Expect(config.Webhooks[0].ClientConfig.CABundle).To(Equal(secret.Data[secretCABundle]))
+	})
+})
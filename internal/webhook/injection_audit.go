@@ -0,0 +1,219 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/gravitl/netmaker-k8s-ops/internal/controller"
+)
+
+const (
+	// injectedAnnotation summarizes on the admitted object what the webhook injected
+	injectedAnnotation = controller.InjectedAnnotation
+
+	// removedMessagePrefix starts the message of responses removing the sidecar again
+	removedMessagePrefix = "netclient sidecar removed"
+
+	eventReasonNetclientInjected        = "NetclientInjected"
+	eventReasonNetclientRemoved         = "NetclientRemoved"
+	eventReasonNetclientInjectionFailed = "NetclientInjectionFailed"
+
+	injectionOutcomeInjected = "injected"
+	injectionOutcomeRemoved  = "removed"
+	injectionOutcomeSkipped  = "skipped"
+	injectionOutcomeRejected = "rejected"
+	injectionOutcomeFailed   = "failed"
+)
+
+// Version is the operator version recorded in the netmaker.io/injected annotation, set at build time with
+// -ldflags "-X github.com/gravitl/netmaker-k8s-ops/internal/webhook.Version=<version>"
+var Version = "dev"
+
+var injectionsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "netmaker_webhook_injections_total",
+	Help: "Admission requests handled by the netclient sidecar webhook, by outcome",
+}, []string{"namespace", "kind", "outcome"})
+
+func init() {
+	metrics.Registry.MustRegister(injectionsTotal)
+}
+
+// injectionSummary is the value of the netmaker.io/injected annotation
+type injectionSummary struct {
+	Version       string            `json:"version"`
+	Image         string            `json:"image"`
+	Networks      []string          `json:"networks,omitempty"`
+	TokenSecret   *tokenSecretRef   `json:"tokenSecret,omitempty"`
+	Volumes       map[string]string `json:"volumes,omitempty"`
+	NativeSidecar bool              `json:"nativeSidecar,omitempty"`
+}
+
+// tokenSecretRef is the secret key the injected netclient reads its token from
+// Source is the secret the controller copies it from, if it doesn't exist yet
+type tokenSecretRef struct {
+	Name   string `json:"name"`
+	Key    string `json:"key"`
+	Source string `json:"source,omitempty"`
+}
+
+// recordInjectionSummary stamps the netmaker.io/injected annotation on the admitted object
+func recordInjectionSummary(target *podTarget) error {
+	netclient := findContainer(target.spec, "netclient")
+	if netclient == nil {
+		return nil
+	}
+	summary := injectionSummary{
+		Version:       Version,
+		Image:         netclient.Image,
+		NativeSidecar: netclient.RestartPolicy != nil,
+	}
+	for _, env := range netclient.Env {
+		switch {
+		case env.Name == "NETWORK" || strings.HasPrefix(env.Name, "NETWORK_"):
+			summary.Networks = append(summary.Networks, env.Value)
+		case env.Name == "TOKEN" && env.ValueFrom != nil && env.ValueFrom.SecretKeyRef != nil:
+			summary.TokenSecret = &tokenSecretRef{
+				Name:   env.ValueFrom.SecretKeyRef.Name,
+				Key:    env.ValueFrom.SecretKeyRef.Key,
+				Source: target.meta.Annotations[tokenSourceAnnotation],
+			}
+		}
+	}
+	for _, mount := range netclient.VolumeMounts {
+		if description := describeVolume(target, mount.Name); description != "" {
+			if summary.Volumes == nil {
+				summary.Volumes = map[string]string{}
+			}
+			summary.Volumes[mount.Name] = description
+		}
+	}
+
+	data, err := json.Marshal(summary)
+	if err != nil {
+		return fmt.Errorf("failed to record injection summary: %w", err)
+	}
+	if target.workload.Annotations == nil {
+		target.workload.Annotations = map[string]string{}
+	}
+	target.workload.Annotations[injectedAnnotation] = string(data)
+	return nil
+}
+
+// describeVolume returns where the netclient volume called name is stored, empty if it isn't found
+func describeVolume(target *podTarget, name string) string {
+	for _, volume := range target.spec.Volumes {
+		if volume.Name != name {
+			continue
+		}
+		switch {
+		case volume.PersistentVolumeClaim != nil:
+			return "persistentVolumeClaim/" + volume.PersistentVolumeClaim.ClaimName
+		case volume.EmptyDir != nil && volume.EmptyDir.Medium == corev1.StorageMediumMemory:
+			return "emptyDir/Memory"
+		case volume.EmptyDir != nil:
+			return "emptyDir"
+		default:
+			return "volume"
+		}
+	}
+	if target.claimTemplates != nil {
+		for _, claim := range *target.claimTemplates {
+			if claim.Name == name {
+				return "volumeClaimTemplate/" + name
+			}
+		}
+	}
+	return ""
+}
+
+// injectionOutcome classifies an admission response of the sidecar webhook
+func injectionOutcome(resp admission.Response) string {
+	switch {
+	case !resp.Allowed && resp.Result != nil && resp.Result.Code == http.StatusBadRequest:
+		return injectionOutcomeRejected
+	case !resp.Allowed:
+		return injectionOutcomeFailed
+	case len(resp.Patches) == 0:
+		return injectionOutcomeSkipped
+	case resp.Result != nil && strings.HasPrefix(resp.Result.Message, removedMessagePrefix):
+		return injectionOutcomeRemoved
+	default:
+		return injectionOutcomeInjected
+	}
+}
+
+// SetEventRecorder reports injections as Events on the admitted objects
+func (w *NetclientSidecarWebhook) SetEventRecorder(recorder record.EventRecorder) {
+	w.recorder = recorder
+}
+
+// recordInjection counts the outcome of a request and reports it as an Event on the admitted object
+// Dry-run requests are left out, so the webhook only has side effects for requests that are persisted
+func (w *NetclientSidecarWebhook) recordInjection(req admission.Request, resp admission.Response) {
+	if req.DryRun != nil && *req.DryRun {
+		return
+	}
+	outcome := injectionOutcome(resp)
+	injectionsTotal.WithLabelValues(req.Namespace, req.Kind.Kind, outcome).Inc()
+	if w.recorder == nil || outcome == injectionOutcomeSkipped {
+		return
+	}
+
+	ref := admittedObjectReference(req)
+	if ref.Name == "" {
+		// Pods named by their controller have no name yet; their workload got the event
+		return
+	}
+	message := ""
+	if resp.Result != nil {
+		message = resp.Result.Message
+	}
+	switch outcome {
+	case injectionOutcomeInjected:
+		w.recorder.Event(ref, corev1.EventTypeNormal, eventReasonNetclientInjected, message)
+	case injectionOutcomeRemoved:
+		w.recorder.Event(ref, corev1.EventTypeNormal, eventReasonNetclientRemoved, message)
+	default:
+		w.recorder.Event(ref, corev1.EventTypeWarning, eventReasonNetclientInjectionFailed, message)
+	}
+}
+
+// admittedObjectReference returns a reference to the object of an admission request
+// Objects being created have no UID yet, so their events are matched by kind and name
+func admittedObjectReference(req admission.Request) *corev1.ObjectReference {
+	apiVersion := req.Kind.Version
+	if req.Kind.Group != "" {
+		apiVersion = req.Kind.Group + "/" + req.Kind.Version
+	}
+	ref := &corev1.ObjectReference{
+		APIVersion: apiVersion,
+		Kind:       req.Kind.Kind,
+		Namespace:  req.Namespace,
+		Name:       req.Name,
+	}
+	var object struct {
+		Metadata struct {
+			Name string `json:"name"`
+			UID  string `json:"uid"`
+		} `json:"metadata"`
+	}
+	if err := json.Unmarshal(req.Object.Raw, &object); err != nil {
+		klog.V(2).Info("Failed to read the admitted object metadata", "kind", req.Kind.Kind, "err", err)
+		return ref
+	}
+	if ref.Name == "" {
+		ref.Name = object.Metadata.Name
+	}
+	ref.UID = types.UID(object.Metadata.UID)
+	return ref
+}
@@ -0,0 +1,79 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+
+	"github.com/gravitl/netmaker-k8s-ops/internal/controller"
+)
+
+const (
+	// netclientLabel enables (or with "disabled", prevents) injection on a workload or pod template
+	// With "node" the pod gets no sidecar and is routed through the node-level netclient instead
+	netclientLabel = "netmaker.io/netclient"
+	// injectionKey is the Namespace label that enables injection for every workload in the namespace,
+	// and the workload annotation that opts a single workload out with "disabled"
+	injectionKey = controller.NetclientInjectionKey
+	// defaultDeniedNamespaces never get sidecars, whatever their labels say
+	defaultDeniedNamespaces = "kube-system,kube-public,kube-node-lease"
+)
+
+// shouldInject decides whether the netclient sidecar is injected into a workload and why
+// The global deny-list wins, then an explicit opt-out on the workload, then the netmaker.io/netclient
+// label on the workload or its pod template, then the namespace label
+func (w *NetclientSidecarWebhook) shouldInject(ctx context.Context, namespace string, annotations map[string]string, labelSets ...map[string]string) (bool, string) {
+	if isDeniedNamespace(namespace) {
+		return false, fmt.Sprintf("namespace %s is excluded from netclient injection", namespace)
+	}
+
+	if annotations[injectionKey] == "disabled" {
+		return false, fmt.Sprintf("netclient injection disabled by %s annotation", injectionKey)
+	}
+	for _, labels := range labelSets {
+		if labels[netclientLabel] == "disabled" {
+			return false, fmt.Sprintf("netclient injection disabled by %s label", netclientLabel)
+		}
+		if labels[netclientLabel] == "node" {
+			return false, fmt.Sprintf("routed through the node-level netclient by %s label", netclientLabel)
+		}
+	}
+
+	for _, labels := range labelSets {
+		if hasNetclientLabel(labels) {
+			return true, ""
+		}
+	}
+
+	if w.namespaceInjectionEnabled(ctx, namespace) {
+		return true, ""
+	}
+	return false, "no netclient label"
+}
+
+// namespaceInjectionEnabled checks if the Namespace has injection enabled by label
+func (w *NetclientSidecarWebhook) namespaceInjectionEnabled(ctx context.Context, namespace string) bool {
+	if w.client == nil || namespace == "" {
+		return false
+	}
+	ns := &corev1.Namespace{}
+	if err := w.client.Get(ctx, types.NamespacedName{Name: namespace}, ns); err != nil {
+		klog.Warning("Failed to get namespace for netclient injection", "namespace", namespace, "error", err)
+		return false
+	}
+	return ns.Labels[injectionKey] == "enabled"
+}
+
+// isDeniedNamespace checks the namespace against NETCLIENT_INJECTION_DENY_NAMESPACES
+func isDeniedNamespace(namespace string) bool {
+	for _, denied := range strings.Split(getEnvOrDefault("NETCLIENT_INJECTION_DENY_NAMESPACES", defaultDeniedNamespaces), ",") {
+		if strings.TrimSpace(denied) == namespace {
+			return true
+		}
+	}
+	return false
+}
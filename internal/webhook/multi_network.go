@@ -0,0 +1,118 @@
+package webhook
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	// networksAnnotation lists every Netmaker network a workload joins with the token secret of each, as
+	// "<network>=<secret>[:<key>]" separated by commas. The first network is the primary one.
+	networksAnnotation = "netmaker.io/networks"
+)
+
+// networkMembership is a network the sidecar joins and the secret key in the pod namespace holding its token
+type networkMembership struct {
+	Network    string
+	SecretName string
+	SecretKey  string
+}
+
+// parseNetworkMemberships parses a netmaker.io/networks value; keys default to NETCLIENT_SECRET_KEY
+func parseNetworkMemberships(value string) ([]networkMembership, []string) {
+	var memberships []networkMembership
+	var problems []string
+	seen := map[string]bool{}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		network, secret, ok := strings.Cut(entry, "=")
+		if !ok || network == "" || secret == "" {
+			problems = append(problems, fmt.Sprintf("%s entry %q must be <network>=<secret>[:<key>]", networksAnnotation, entry))
+			continue
+		}
+		membership := networkMembership{Network: network, SecretName: secret, SecretKey: getEnvOrDefault("NETCLIENT_SECRET_KEY", "token")}
+		if name, key, hasKey := strings.Cut(secret, ":"); hasKey {
+			membership.SecretName, membership.SecretKey = name, key
+		}
+
+		if !networkPattern.MatchString(network) {
+			problems = append(problems, fmt.Sprintf("%s network %q must be 1-32 letters, digits, '-' or '_'", networksAnnotation, network))
+		}
+		for _, msg := range validation.IsDNS1123Subdomain(membership.SecretName) {
+			problems = append(problems, fmt.Sprintf("%s secret %q: %s", networksAnnotation, membership.SecretName, msg))
+		}
+		for _, msg := range validation.IsConfigMapKey(membership.SecretKey) {
+			problems = append(problems, fmt.Sprintf("%s secret key %q: %s", networksAnnotation, membership.SecretKey, msg))
+		}
+		if seen[network] {
+			problems = append(problems, fmt.Sprintf("%s lists network %s twice", networksAnnotation, network))
+		}
+		seen[network] = true
+		memberships = append(memberships, membership)
+	}
+	return memberships, problems
+}
+
+// networkNames returns the names of the networks in order
+func networkNames(memberships []networkMembership) []string {
+	names := make([]string, 0, len(memberships))
+	for _, membership := range memberships {
+		names = append(names, membership.Network)
+	}
+	return names
+}
+
+// tokenSelector returns the secret key selector of a membership's token
+func (m networkMembership) tokenSelector() *corev1.SecretKeySelector {
+	return &corev1.SecretKeySelector{
+		LocalObjectReference: corev1.LocalObjectReference{Name: m.SecretName},
+		Key:                  m.SecretKey,
+	}
+}
+
+// addExtraNetworks passes the networks after the primary one to netclient
+// The netclient entrypoint only joins $TOKEN, so each extra network gets NETWORK_<n> and TOKEN_<n> and the
+// entrypoint is wrapped to run "netclient join" for them once the primary network is up, see
+// buildNetclientStartScript. Networks the host already joined, for example with persistent state, are skipped.
+func addExtraNetworks(netclient *corev1.Container, extra []networkMembership) {
+	for i, membership := range extra {
+		netclient.Env = append(netclient.Env,
+			corev1.EnvVar{Name: fmt.Sprintf("NETWORK_%d", i+1), Value: membership.Network},
+			corev1.EnvVar{Name: fmt.Sprintf("TOKEN_%d", i+1), ValueFrom: &corev1.EnvVarSource{SecretKeyRef: membership.tokenSelector()}},
+		)
+	}
+}
+
+// buildNetclientStartScript starts the netclient entrypoint in the background with its PID in $pid,
+// joins the extraNetworks networks passed in NETWORK_<n> and TOKEN_<n> once the primary network is up,
+// and serves the sidecar status on statusPort unless it is 0
+func buildNetclientStartScript(extraNetworks int, statusPort int32) string {
+	entrypoint := getEnvOrDefault("NETCLIENT_ENTRYPOINT", "/bin/bash ./netclient.sh")
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s &\npid=$!\n", entrypoint)
+	if statusPort > 0 {
+		b.WriteString(buildStatusServerScript(statusPort))
+	}
+	if extraNetworks == 0 {
+		return b.String()
+	}
+	fmt.Fprintf(&b, `(
+  until ip addr show netmaker 2>/dev/null | grep -q inet; do sleep 2; done
+  for i in $(seq 1 %d); do
+    eval network=\$NETWORK_$i token=\$TOKEN_$i
+    if netclient list 2>/dev/null | grep -qw "$network"; then
+      continue
+    fi
+    until netclient join -t "$token"; do
+      echo "[netclient] failed to join network $network, retrying" >&2
+      sleep 5
+    done
+    echo "[netclient] joined network $network"
+  done
+) &
+`, extraNetworks)
+	return b.String()
+}
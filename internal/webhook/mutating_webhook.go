@@ -2,16 +2,20 @@ package webhook
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
 	"os"
+	"reflect"
 
 	"gomodules.xyz/jsonpatch/v2"
+	admissionv1 "k8s.io/api/admission/v1"
 	appsv1 "k8s.io/api/apps/v1"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/klog/v2"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
@@ -21,6 +25,12 @@ import (
 type NetclientSidecarWebhook struct {
 	decoder admission.Decoder
 	client  client.Client
+	// nativeSidecars injects netclient as a restartable init container instead of a regular container
+	nativeSidecars bool
+	// recorder reports injections as Events, nil disables them
+	recorder record.EventRecorder
+	// podTemplateKinds are the other kinds with a pod template to inject into
+	podTemplateKinds []PodTemplateKind
 }
 
 // NewNetclientSidecarWebhook creates a new webhook
@@ -41,7 +51,23 @@ func (w *NetclientSidecarWebhook) Handle(ctx context.Context, req admission.Requ
 		return admission.Errored(500, fmt.Errorf("decoder not initialized"))
 	}
 
-	// Route to appropriate handler based on resource type
+	// Injection only patches the admitted object; PVCs and token secrets are created by the controller
+	// once pods exist, and Events and metrics are only recorded for persisted requests
+	if req.DryRun != nil && *req.DryRun {
+		klog.V(2).Info("Handling dry-run request", "kind", req.Kind.Kind, "name", req.Name, "namespace", req.Namespace)
+	}
+
+	resp := w.handleKind(ctx, req)
+	w.recordInjection(req, resp)
+	return resp
+}
+
+// handleKind routes a request to the handler for its resource type
+func (w *NetclientSidecarWebhook) handleKind(ctx context.Context, req admission.Request) admission.Response {
+	if kind := w.podTemplateKindFor(req.Kind); kind != nil {
+		return w.handlePodTemplateKind(ctx, req, kind)
+	}
+
 	switch req.Kind.Kind {
 	case "Pod":
 		return w.handlePod(ctx, req)
@@ -53,6 +79,8 @@ func (w *NetclientSidecarWebhook) Handle(ctx context.Context, req admission.Requ
 		return w.handleDaemonSet(ctx, req)
 	case "Job":
 		return w.handleJob(ctx, req)
+	case "CronJob":
+		return w.handleCronJob(ctx, req)
 	case "ReplicaSet":
 		return w.handleReplicaSet(ctx, req)
 	default:
@@ -68,26 +96,27 @@ func (w *NetclientSidecarWebhook) handlePod(ctx context.Context, req admission.R
 		return admission.Errored(400, err)
 	}
 
-	// Check if pod has the netclient label
-	if !hasNetclientLabel(pod.Labels) {
-		return admission.Allowed("no netclient label")
+	// Check if injection is enabled for the pod
+	if inject, reason := w.shouldInject(ctx, req.Namespace, pod.Annotations, pod.Labels); !inject {
+		return admission.Allowed(reason)
 	}
 
 	// Check if netclient sidecar already exists
-	if hasNetclientSidecar(pod.Spec.Containers) {
+	if hasNetclientSidecar(&pod.Spec) {
 		return admission.Allowed("netclient sidecar already exists")
 	}
 
 	// Add netclient sidecar
 	modifiedPod := pod.DeepCopy()
-	w.addNetclientSidecar(modifiedPod, pod.Labels, pod.Annotations, req.Namespace)
+	warnings, err := w.addNetclientSidecar(modifiedPod, pod.Labels, pod.Annotations, req.Namespace)
+	if err != nil {
+		return injectionErrorResponse(err)
+	}
 
 	// Return the modified pod
-	return admission.Patched("netclient sidecar added", jsonpatch.Operation{
-		Operation: "replace",
-		Path:      "/spec",
-		Value:     modifiedPod.Spec,
-	})
+	resp := patchResponse("netclient sidecar added", req.Object.Raw, &pod, modifiedPod)
+	resp.Warnings = append(resp.Warnings, warnings...)
+	return resp
 }
 
 // handleDeployment handles Deployment webhook requests
@@ -97,13 +126,15 @@ func (w *NetclientSidecarWebhook) handleDeployment(ctx context.Context, req admi
 		return admission.Errored(400, err)
 	}
 
-	// Check if deployment has the netclient label
-	if !hasNetclientLabel(deployment.Labels) && !hasNetclientLabel(deployment.Spec.Template.Labels) {
-		return admission.Allowed("no netclient label")
+	// Check if injection is enabled for the deployment
+	if inject, reason := w.shouldInject(ctx, req.Namespace, mergeAnnotations(deployment.Annotations, deployment.Spec.Template.Annotations), deployment.Labels, deployment.Spec.Template.Labels); !inject {
+		// Remove a sidecar injected before the workload dropped the label
+		modifiedDeployment := deployment.DeepCopy()
+		return uninjectResponse(req, reason, &deployment, modifiedDeployment, &modifiedDeployment.Spec.Template)
 	}
 
 	// Check if netclient sidecar already exists
-	if hasNetclientSidecar(deployment.Spec.Template.Spec.Containers) {
+	if hasNetclientSidecar(&deployment.Spec.Template.Spec) {
 		return admission.Allowed("netclient sidecar already exists")
 	}
 
@@ -118,13 +149,14 @@ func (w *NetclientSidecarWebhook) handleDeployment(ctx context.Context, req admi
 		"deploymentAnnotations", deployment.Annotations,
 		"podTemplateAnnotations", deployment.Spec.Template.Annotations,
 		"mergedAnnotations", mergedAnnotations)
-	w.addNetclientSidecarToPodTemplate(&modifiedDeployment.Spec.Template.Spec, mergedLabels, mergedAnnotations, req.Namespace)
+	target := newPodTarget("Deployment", &modifiedDeployment.ObjectMeta, &modifiedDeployment.Spec.Template)
+	if err := w.addNetclientSidecarToPodTemplate(target, mergedLabels, mergedAnnotations, req.Namespace); err != nil {
+		return injectionErrorResponse(err)
+	}
 
-	return admission.Patched("netclient sidecar added to deployment", jsonpatch.Operation{
-		Operation: "replace",
-		Path:      "/spec",
-		Value:     modifiedDeployment.Spec,
-	})
+	resp := patchResponse("netclient sidecar added to deployment", req.Object.Raw, &deployment, modifiedDeployment)
+	resp.Warnings = append(resp.Warnings, target.warnings...)
+	return resp
 }
 
 // handleStatefulSet handles StatefulSet webhook requests
@@ -134,13 +166,15 @@ func (w *NetclientSidecarWebhook) handleStatefulSet(ctx context.Context, req adm
 		return admission.Errored(400, err)
 	}
 
-	// Check if statefulset has the netclient label
-	if !hasNetclientLabel(statefulSet.Labels) && !hasNetclientLabel(statefulSet.Spec.Template.Labels) {
-		return admission.Allowed("no netclient label")
+	// Check if injection is enabled for the statefulset
+	if inject, reason := w.shouldInject(ctx, req.Namespace, mergeAnnotations(statefulSet.Annotations, statefulSet.Spec.Template.Annotations), statefulSet.Labels, statefulSet.Spec.Template.Labels); !inject {
+		// Remove a sidecar injected before the workload dropped the label
+		modifiedStatefulSet := statefulSet.DeepCopy()
+		return uninjectResponse(req, reason, &statefulSet, modifiedStatefulSet, &modifiedStatefulSet.Spec.Template)
 	}
 
 	// Check if netclient sidecar already exists
-	if hasNetclientSidecar(statefulSet.Spec.Template.Spec.Containers) {
+	if hasNetclientSidecar(&statefulSet.Spec.Template.Spec) {
 		return admission.Allowed("netclient sidecar already exists")
 	}
 
@@ -149,13 +183,19 @@ func (w *NetclientSidecarWebhook) handleStatefulSet(ctx context.Context, req adm
 	// Merge annotations: pod template annotations take priority over statefulset annotations
 	mergedAnnotations := mergeAnnotations(statefulSet.Annotations, statefulSet.Spec.Template.Annotations)
 	mergedLabels := mergeLabels(statefulSet.Labels, statefulSet.Spec.Template.Labels)
-	w.addNetclientSidecarToPodTemplate(&modifiedStatefulSet.Spec.Template.Spec, mergedLabels, mergedAnnotations, req.Namespace)
+	target := newPodTarget("StatefulSet", &modifiedStatefulSet.ObjectMeta, &modifiedStatefulSet.Spec.Template)
+	// StatefulSets keep netclient state per ordinal through volumeClaimTemplates,
+	// which are immutable and can only be added when the StatefulSet is created
+	if req.Operation == admissionv1.Create {
+		target.claimTemplates = &modifiedStatefulSet.Spec.VolumeClaimTemplates
+	}
+	if err := w.addNetclientSidecarToPodTemplate(target, mergedLabels, mergedAnnotations, req.Namespace); err != nil {
+		return injectionErrorResponse(err)
+	}
 
-	return admission.Patched("netclient sidecar added to statefulset", jsonpatch.Operation{
-		Operation: "replace",
-		Path:      "/spec",
-		Value:     modifiedStatefulSet.Spec,
-	})
+	resp := patchResponse("netclient sidecar added to statefulset", req.Object.Raw, &statefulSet, modifiedStatefulSet)
+	resp.Warnings = append(resp.Warnings, target.warnings...)
+	return resp
 }
 
 // handleDaemonSet handles DaemonSet webhook requests
@@ -165,13 +205,15 @@ func (w *NetclientSidecarWebhook) handleDaemonSet(ctx context.Context, req admis
 		return admission.Errored(400, err)
 	}
 
-	// Check if daemonset has the netclient label
-	if !hasNetclientLabel(daemonSet.Labels) && !hasNetclientLabel(daemonSet.Spec.Template.Labels) {
-		return admission.Allowed("no netclient label")
+	// Check if injection is enabled for the daemonset
+	if inject, reason := w.shouldInject(ctx, req.Namespace, mergeAnnotations(daemonSet.Annotations, daemonSet.Spec.Template.Annotations), daemonSet.Labels, daemonSet.Spec.Template.Labels); !inject {
+		// Remove a sidecar injected before the workload dropped the label
+		modifiedDaemonSet := daemonSet.DeepCopy()
+		return uninjectResponse(req, reason, &daemonSet, modifiedDaemonSet, &modifiedDaemonSet.Spec.Template)
 	}
 
 	// Check if netclient sidecar already exists
-	if hasNetclientSidecar(daemonSet.Spec.Template.Spec.Containers) {
+	if hasNetclientSidecar(&daemonSet.Spec.Template.Spec) {
 		return admission.Allowed("netclient sidecar already exists")
 	}
 
@@ -180,13 +222,14 @@ func (w *NetclientSidecarWebhook) handleDaemonSet(ctx context.Context, req admis
 	// Merge annotations: pod template annotations take priority over daemonset annotations
 	mergedAnnotations := mergeAnnotations(daemonSet.Annotations, daemonSet.Spec.Template.Annotations)
 	mergedLabels := mergeLabels(daemonSet.Labels, daemonSet.Spec.Template.Labels)
-	w.addNetclientSidecarToPodTemplate(&modifiedDaemonSet.Spec.Template.Spec, mergedLabels, mergedAnnotations, req.Namespace)
+	target := newPodTarget("DaemonSet", &modifiedDaemonSet.ObjectMeta, &modifiedDaemonSet.Spec.Template)
+	if err := w.addNetclientSidecarToPodTemplate(target, mergedLabels, mergedAnnotations, req.Namespace); err != nil {
+		return injectionErrorResponse(err)
+	}
 
-	return admission.Patched("netclient sidecar added to daemonset", jsonpatch.Operation{
-		Operation: "replace",
-		Path:      "/spec",
-		Value:     modifiedDaemonSet.Spec,
-	})
+	resp := patchResponse("netclient sidecar added to daemonset", req.Object.Raw, &daemonSet, modifiedDaemonSet)
+	resp.Warnings = append(resp.Warnings, target.warnings...)
+	return resp
 }
 
 // handleJob handles Job webhook requests
@@ -196,13 +239,14 @@ func (w *NetclientSidecarWebhook) handleJob(ctx context.Context, req admission.R
 		return admission.Errored(400, err)
 	}
 
-	// Check if job has the netclient label
-	if !hasNetclientLabel(job.Labels) && !hasNetclientLabel(job.Spec.Template.Labels) {
-		return admission.Allowed("no netclient label")
+	// Check if injection is enabled for the job
+	if inject, reason := w.shouldInject(ctx, req.Namespace, mergeAnnotations(job.Annotations, job.Spec.Template.Annotations), job.Labels, job.Spec.Template.Labels); !inject {
+		// Job templates are immutable, so an injected Job keeps its sidecar until it is replaced
+		return admission.Allowed(reason)
 	}
 
 	// Check if netclient sidecar already exists
-	if hasNetclientSidecar(job.Spec.Template.Spec.Containers) {
+	if hasNetclientSidecar(&job.Spec.Template.Spec) {
 		return admission.Allowed("netclient sidecar already exists")
 	}
 
@@ -211,13 +255,50 @@ func (w *NetclientSidecarWebhook) handleJob(ctx context.Context, req admission.R
 	// Merge annotations: pod template annotations take priority over job annotations
 	mergedAnnotations := mergeAnnotations(job.Annotations, job.Spec.Template.Annotations)
 	mergedLabels := mergeLabels(job.Labels, job.Spec.Template.Labels)
-	w.addNetclientSidecarToPodTemplate(&modifiedJob.Spec.Template.Spec, mergedLabels, mergedAnnotations, req.Namespace)
+	target := newPodTarget("Job", &modifiedJob.ObjectMeta, &modifiedJob.Spec.Template)
+	if err := w.addNetclientSidecarToPodTemplate(target, mergedLabels, mergedAnnotations, req.Namespace); err != nil {
+		return injectionErrorResponse(err)
+	}
+
+	resp := patchResponse("netclient sidecar added to job", req.Object.Raw, &job, modifiedJob)
+	resp.Warnings = append(resp.Warnings, target.warnings...)
+	return resp
+}
+
+// handleCronJob handles CronJob webhook requests
+func (w *NetclientSidecarWebhook) handleCronJob(ctx context.Context, req admission.Request) admission.Response {
+	var cronJob batchv1.CronJob
+	if err := w.decoder.Decode(req, &cronJob); err != nil {
+		return admission.Errored(400, err)
+	}
+
+	podTemplate := &cronJob.Spec.JobTemplate.Spec.Template
+
+	// Check if injection is enabled for the cronjob
+	if inject, reason := w.shouldInject(ctx, req.Namespace, mergeAnnotations(cronJob.Annotations, podTemplate.Annotations), cronJob.Labels, podTemplate.Labels); !inject {
+		// Remove a sidecar injected before the workload dropped the label
+		modifiedCronJob := cronJob.DeepCopy()
+		return uninjectResponse(req, reason, &cronJob, modifiedCronJob, &modifiedCronJob.Spec.JobTemplate.Spec.Template)
+	}
+
+	// Check if netclient sidecar already exists
+	if hasNetclientSidecar(&podTemplate.Spec) {
+		return admission.Allowed("netclient sidecar already exists")
+	}
 
-	return admission.Patched("netclient sidecar added to job", jsonpatch.Operation{
-		Operation: "replace",
-		Path:      "/spec",
-		Value:     modifiedJob.Spec,
-	})
+	// Add netclient sidecar to the job's pod template
+	modifiedCronJob := cronJob.DeepCopy()
+	// Merge annotations: pod template annotations take priority over cronjob annotations
+	mergedAnnotations := mergeAnnotations(cronJob.Annotations, podTemplate.Annotations)
+	mergedLabels := mergeLabels(cronJob.Labels, podTemplate.Labels)
+	target := newPodTarget("CronJob", &modifiedCronJob.ObjectMeta, &modifiedCronJob.Spec.JobTemplate.Spec.Template)
+	if err := w.addNetclientSidecarToPodTemplate(target, mergedLabels, mergedAnnotations, req.Namespace); err != nil {
+		return injectionErrorResponse(err)
+	}
+
+	resp := patchResponse("netclient sidecar added to cronjob", req.Object.Raw, &cronJob, modifiedCronJob)
+	resp.Warnings = append(resp.Warnings, target.warnings...)
+	return resp
 }
 
 // handleReplicaSet handles ReplicaSet webhook requests
@@ -227,13 +308,15 @@ func (w *NetclientSidecarWebhook) handleReplicaSet(ctx context.Context, req admi
 		return admission.Errored(400, err)
 	}
 
-	// Check if replicaset has the netclient label
-	if !hasNetclientLabel(replicaSet.Labels) && !hasNetclientLabel(replicaSet.Spec.Template.Labels) {
-		return admission.Allowed("no netclient label")
+	// Check if injection is enabled for the replicaset
+	if inject, reason := w.shouldInject(ctx, req.Namespace, mergeAnnotations(replicaSet.Annotations, replicaSet.Spec.Template.Annotations), replicaSet.Labels, replicaSet.Spec.Template.Labels); !inject {
+		// Remove a sidecar injected before the workload dropped the label
+		modifiedReplicaSet := replicaSet.DeepCopy()
+		return uninjectResponse(req, reason, &replicaSet, modifiedReplicaSet, &modifiedReplicaSet.Spec.Template)
 	}
 
 	// Check if netclient sidecar already exists
-	if hasNetclientSidecar(replicaSet.Spec.Template.Spec.Containers) {
+	if hasNetclientSidecar(&replicaSet.Spec.Template.Spec) {
 		return admission.Allowed("netclient sidecar already exists")
 	}
 
@@ -242,13 +325,67 @@ func (w *NetclientSidecarWebhook) handleReplicaSet(ctx context.Context, req admi
 	// Merge annotations: pod template annotations take priority over replicaset annotations
 	mergedAnnotations := mergeAnnotations(replicaSet.Annotations, replicaSet.Spec.Template.Annotations)
 	mergedLabels := mergeLabels(replicaSet.Labels, replicaSet.Spec.Template.Labels)
-	w.addNetclientSidecarToPodTemplate(&modifiedReplicaSet.Spec.Template.Spec, mergedLabels, mergedAnnotations, req.Namespace)
+	target := newPodTarget("ReplicaSet", &modifiedReplicaSet.ObjectMeta, &modifiedReplicaSet.Spec.Template)
+	if err := w.addNetclientSidecarToPodTemplate(target, mergedLabels, mergedAnnotations, req.Namespace); err != nil {
+		return injectionErrorResponse(err)
+	}
+
+	resp := patchResponse("netclient sidecar added to replicaset", req.Object.Raw, &replicaSet, modifiedReplicaSet)
+	resp.Warnings = append(resp.Warnings, target.warnings...)
+	return resp
+}
+
+// patchResponse returns a response patching the admitted object into modified with a minimal JSON patch
+// Diffing the raw request against the re-encoded typed object would also "add" every field the typed
+// structs serialize differently (e.g. creationTimestamp: null), so operations that already appear in the
+// diff against the unmodified typed object are dropped and only the injected changes remain
+func patchResponse(message string, raw []byte, original, modified interface{}) admission.Response {
+	originalJSON, err := json.Marshal(original)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	modifiedJSON, err := json.Marshal(modified)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+
+	noise, err := jsonpatch.CreatePatch(raw, originalJSON)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	resp := admission.PatchResponseFromRaw(raw, modifiedJSON)
+	if !resp.Allowed {
+		return resp
+	}
+
+	patches := resp.Patches[:0]
+	for _, patch := range resp.Patches {
+		if !containsPatch(noise, patch) {
+			patches = append(patches, patch)
+		}
+	}
+	resp.Patches = patches
+	if len(patches) == 0 {
+		resp.PatchType = nil
+	}
+	resp.Result = &metav1.Status{Code: http.StatusOK, Message: message}
+	return resp
+}
+
+// containsPatch checks if patches contains an identical operation
+func containsPatch(patches []jsonpatch.JsonPatchOperation, patch jsonpatch.JsonPatchOperation) bool {
+	for _, p := range patches {
+		if p.Operation == patch.Operation && p.Path == patch.Path && reflect.DeepEqual(p.Value, patch.Value) {
+			return true
+		}
+	}
+	return false
+}
 
-	return admission.Patched("netclient sidecar added to replicaset", jsonpatch.Operation{
-		Operation: "replace",
-		Path:      "/spec",
-		Value:     modifiedReplicaSet.Spec,
-	})
+// SetNativeSidecars enables injecting netclient as a native sidecar (restartable init container)
+// Only enable this when the API server supports SidecarContainers, see NativeSidecarsSupported
+func (w *NetclientSidecarWebhook) SetNativeSidecars(enabled bool) {
+	w.nativeSidecars = enabled
 }
 
 // InjectClient injects the client
@@ -264,13 +401,18 @@ func hasNetclientLabel(labels map[string]string) bool {
 	}
 
 	// Check for netclient label
-	value, exists := labels["netmaker.io/netclient"]
+	value, exists := labels[netclientLabel]
 	return exists && value == "enabled"
 }
 
-// hasNetclientSidecar checks if the pod already has a netclient sidecar
-func hasNetclientSidecar(containers []corev1.Container) bool {
-	for _, container := range containers {
+// hasNetclientSidecar checks if the pod already has a netclient sidecar, either as a container or a native sidecar
+func hasNetclientSidecar(podSpec *corev1.PodSpec) bool {
+	for _, container := range podSpec.Containers {
+		if container.Name == "netclient" {
+			return true
+		}
+	}
+	for _, container := range podSpec.InitContainers {
 		if container.Name == "netclient" {
 			return true
 		}
@@ -278,20 +420,99 @@ func hasNetclientSidecar(containers []corev1.Container) bool {
 	return false
 }
 
+// podTarget is the pod or pod template the netclient sidecar is injected into
+type podTarget struct {
+	// kind is the kind of the admitted workload
+	kind string
+	// workload is the metadata of the admitted object, the pod itself for Pods
+	workload *metav1.ObjectMeta
+	// meta is the pod (template) metadata, used for annotations the controller acts on
+	meta *metav1.ObjectMeta
+	spec *corev1.PodSpec
+	// claimTemplates points at the StatefulSet volumeClaimTemplates, nil for other kinds and StatefulSet updates
+	claimTemplates *[]corev1.PersistentVolumeClaim
+	// warnings are returned to the client with the admission response
+	warnings []string
+}
+
+// newPodTarget returns the injection target for a workload's pod template
+func newPodTarget(kind string, workload *metav1.ObjectMeta, template *corev1.PodTemplateSpec) *podTarget {
+	return &podTarget{kind: kind, workload: workload, meta: &template.ObjectMeta, spec: &template.Spec}
+}
+
+// setAnnotation sets an annotation on the pod (template)
+func (t *podTarget) setAnnotation(key, value string) {
+	if t.meta.Annotations == nil {
+		t.meta.Annotations = map[string]string{}
+	}
+	t.meta.Annotations[key] = value
+}
+
 // addNetclientSidecar adds the netclient sidecar to the pod
-func (w *NetclientSidecarWebhook) addNetclientSidecar(pod *corev1.Pod, labels map[string]string, annotations map[string]string, namespace string) {
-	w.addNetclientSidecarToPodTemplate(&pod.Spec, labels, annotations, namespace)
+// Returns the warnings for the admission response
+func (w *NetclientSidecarWebhook) addNetclientSidecar(pod *corev1.Pod, labels map[string]string, annotations map[string]string, namespace string) ([]string, error) {
+	target := &podTarget{kind: "Pod", workload: &pod.ObjectMeta, meta: &pod.ObjectMeta, spec: &pod.Spec}
+	if err := w.addNetclientSidecarToPodTemplate(target, labels, annotations, namespace); err != nil {
+		return nil, err
+	}
+	return target.warnings, nil
 }
 
 // addNetclientSidecarToPodTemplate adds the netclient sidecar to a pod template spec
-func (w *NetclientSidecarWebhook) addNetclientSidecarToPodTemplate(podSpec *corev1.PodSpec, labels map[string]string, annotations map[string]string, namespace string) {
+// The admitted object is annotated with a summary of the injection, and workload templates record what was
+// added, so the sidecar can be removed again when the label goes away
+func (w *NetclientSidecarWebhook) addNetclientSidecarToPodTemplate(target *podTarget, labels map[string]string, annotations map[string]string, namespace string) error {
+	before := &corev1.PodTemplateSpec{ObjectMeta: *target.meta.DeepCopy(), Spec: *target.spec.DeepCopy()}
+	if err := w.injectNetclientSidecar(target, labels, annotations, namespace); err != nil {
+		return err
+	}
+	if err := recordInjectionSummary(target); err != nil {
+		return err
+	}
+	if target.kind == "Pod" {
+		// Containers can't be removed from a pod, so there is nothing to record
+		return nil
+	}
+	return recordInjectedResources(target, before)
+}
+
+// injectNetclientSidecar adds the netclient container, its volumes and the per-workload settings to target
+func (w *NetclientSidecarWebhook) injectNetclientSidecar(target *podTarget, labels map[string]string, annotations map[string]string, namespace string) error {
+	podSpec := target.spec
+
 	// Get netclient configuration from environment variables or use defaults
 	netclientImage := getEnvOrDefault("NETCLIENT_IMAGE", "gravitl/netclient:v1.4.0")
 	netclientServer := getEnvOrDefault("NETCLIENT_SERVER", "")
 	netclientNetwork := getEnvOrDefault("NETCLIENT_NETWORK", "")
+	netclientLogLevel := "info"
+
+	// Per-workload annotations take priority over the operator-wide defaults
+	overrides, err := parseNetclientOverrides(annotations)
+	if err != nil {
+		return err
+	}
+	if err := checkStaticIPTarget(target, annotations, overrides); err != nil {
+		return err
+	}
+	if len(overrides.StaticIPs) > 0 {
+		// The static IP controller reads the pods, which only inherit the template annotations
+		target.setAnnotation(staticIPAnnotation, annotations[staticIPAnnotation])
+	}
+	if overrides.Image != "" {
+		netclientImage = overrides.Image
+	}
+	if overrides.Server != "" {
+		netclientServer = overrides.Server
+	}
+	if overrides.Network != "" {
+		netclientNetwork = overrides.Network
+	}
+	if overrides.LogLevel != "" {
+		netclientLogLevel = overrides.LogLevel
+	}
 
-	// Get netclient token from secret (create a temporary pod object for secret lookup)
-	// We'll use labels and annotations directly in the getNetclientTokenFromSecret call
+	// Resolve the secret holding the netclient token (create a temporary pod object for secret lookup)
+	// We'll use labels and annotations directly in the tokenSecretRef call
 	// by creating a minimal pod structure
 	tempPod := &corev1.Pod{}
 	tempPod.Namespace = namespace
@@ -301,22 +522,34 @@ func (w *NetclientSidecarWebhook) addNetclientSidecarToPodTemplate(podSpec *core
 	if annotations != nil {
 		tempPod.Annotations = annotations
 	}
-	netclientToken, err := w.getNetclientTokenFromSecret(tempPod)
-	if err != nil {
-		klog.Warning("Failed to get netclient token from secret", "error", err)
-		// Fallback to environment variable
-		netclientToken = getEnvOrDefault("NETCLIENT_TOKEN", "")
-	}
-
-	if netclientToken == "" {
-		klog.Warning("NETCLIENT_TOKEN not found in secret or environment, netclient sidecar may not work properly")
+	// The token is referenced from a Secret so it never ends up in the workload spec
+	var tokenRef *corev1.SecretKeySelector
+	if len(overrides.Networks) > 0 {
+		// Every network brings its own token secret; the first one is joined by the netclient entrypoint
+		if err := w.checkNetworkTokens(namespace, overrides.Networks); err != nil {
+			return err
+		}
+		tokenRef = overrides.Networks[0].tokenSelector()
+		netclientNetwork = overrides.Networks[0].Network
+	} else {
+		var tokenSource string
+		tokenRef, tokenSource, err = w.tokenSecretRef(tempPod)
+		if err != nil {
+			return fmt.Errorf("failed to provide netclient token: %w", err)
+		}
+		if tokenSource != "" {
+			// The secret is created by the controller once pods exist, keeping admission free of side effects
+			target.setAnnotation(tokenSourceAnnotation, tokenSource)
+		}
 	}
 
 	// Build environment variables
 	envVars := []corev1.EnvVar{
 		{
-			Name:  "TOKEN",
-			Value: netclientToken,
+			Name: "TOKEN",
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: tokenRef,
+			},
 		},
 		{
 			Name:  "DAEMON",
@@ -324,7 +557,7 @@ func (w *NetclientSidecarWebhook) addNetclientSidecarToPodTemplate(podSpec *core
 		},
 		{
 			Name:  "LOG_LEVEL",
-			Value: "info",
+			Value: netclientLogLevel,
 		},
 	}
 
@@ -393,18 +626,82 @@ func (w *NetclientSidecarWebhook) addNetclientSidecarToPodTemplate(podSpec *core
 		},
 	}
 
-	// Add netclient container to pod spec
-	podSpec.Containers = append(podSpec.Containers, netclientContainer)
+	if err := applyResourceOverrides(&netclientContainer.Resources, overrides.Resources); err != nil {
+		return err
+	}
+	applyReadinessProbeOverride(netclientContainer.ReadinessProbe, overrides.ReadinessProbe)
+	extraNetworks := 0
+	if len(overrides.Networks) > 1 {
+		extraNetworks = len(overrides.Networks) - 1
+		addExtraNetworks(&netclientContainer, overrides.Networks[1:])
+	}
+	statusPort := netclientStatusPort()
+	if statusPort > 0 {
+		addStatusReporting(target, &netclientContainer, statusPort)
+	}
+	startScript := buildNetclientStartScript(extraNetworks, statusPort)
+	if extraNetworks > 0 || statusPort > 0 {
+		// Wrap the entrypoint to join the other networks and serve the status next to the daemon
+		netclientContainer.Command = []string{"/bin/sh", "-c", startScript + "wait $pid\n"}
+	}
+	if overrides.WaitForNetwork {
+		applyWaitForNetwork(&netclientContainer, w.nativeSidecars, overrides)
+	}
+
+	if w.nativeSidecars {
+		// Run netclient as a native sidecar: an init container with restartPolicy Always is started
+		// before the app containers, which only start once the startup probe sees the WireGuard
+		// interface, and it doesn't keep Jobs from completing
+		restartPolicy := corev1.ContainerRestartPolicyAlways
+		netclientContainer.RestartPolicy = &restartPolicy
+		if netclientContainer.StartupProbe == nil {
+			netclientContainer.StartupProbe = &corev1.Probe{
+				ProbeHandler:     netclientContainer.ReadinessProbe.ProbeHandler,
+				PeriodSeconds:    2,
+				TimeoutSeconds:   3,
+				FailureThreshold: 90,
+			}
+		}
+		// Put it first so other init containers can use the Netmaker network too
+		podSpec.InitContainers = append([]corev1.Container{netclientContainer}, podSpec.InitContainers...)
+	} else {
+		if isBatchPodSpec(podSpec) {
+			// A regular netclient container never exits on its own, so let it stop once the app containers are done
+			target.warnings = append(target.warnings, addCompletionSentinel(podSpec, &netclientContainer, startScript)...)
+		}
+		if overrides.WaitForNetwork {
+			// Containers start in order, so the app containers wait for the netclient postStart hook
+			podSpec.Containers = append([]corev1.Container{netclientContainer}, podSpec.Containers...)
+		} else {
+			// Add netclient container to pod spec
+			podSpec.Containers = append(podSpec.Containers, netclientContainer)
+		}
+	}
 
 	// Add required volumes if they don't exist
-	w.addNetclientVolumesToPodSpec(podSpec, namespace, labels, annotations)
+	if err := w.addNetclientVolumesToPodSpec(target, namespace, labels, annotations); err != nil {
+		return err
+	}
+
+	dnsNetworks := networkNames(overrides.Networks)
+	if len(dnsNetworks) == 0 && netclientNetwork != "" {
+		dnsNetworks = []string{netclientNetwork}
+	}
+	if err := w.applyNetmakerDNS(target, namespace, dnsNetworks, overrides); err != nil {
+		return err
+	}
 
 	// Note: hostNetwork is not required since containers in a pod share the network namespace.
 	// The WireGuard interface created by netclient will be accessible to all containers in the pod.
+	return nil
 }
 
 // addNetclientVolumesToPodSpec adds the required volumes for netclient to a pod spec
-func (w *NetclientSidecarWebhook) addNetclientVolumesToPodSpec(podSpec *corev1.PodSpec, namespace string, labels map[string]string, annotations map[string]string) {
+// PVCs are never created here: StatefulSets get a volumeClaimTemplate, and pods referencing a claim are
+// annotated so the controller creates it. Sharing one claim between the pods of other workloads is refused.
+func (w *NetclientSidecarWebhook) addNetclientVolumesToPodSpec(target *podTarget, namespace string, labels map[string]string, annotations map[string]string) error {
+	podSpec := target.spec
+
 	// Check if volumes already exist
 	hasEtcNetclient := false
 	hasLogNetclient := false
@@ -417,6 +714,13 @@ func (w *NetclientSidecarWebhook) addNetclientVolumesToPodSpec(podSpec *corev1.P
 			hasLogNetclient = true
 		}
 	}
+	if target.claimTemplates != nil {
+		for _, claim := range *target.claimTemplates {
+			if claim.Name == "etc-netclient" {
+				hasEtcNetclient = true
+			}
+		}
+	}
 
 	// Get PVC name from pod annotation, environment variable, or use EmptyDir
 	pvcName := getPVCNameFromPod(annotations, namespace)
@@ -428,44 +732,58 @@ func (w *NetclientSidecarWebhook) addNetclientVolumesToPodSpec(podSpec *corev1.P
 		klog.Info("No annotations found for netclient PVC configuration", "namespace", namespace)
 	}
 
-	// If PVC is specified, ensure it exists (create if it doesn't)
-	if pvcName != "" && w.client != nil {
-		if err := w.ensurePVCExists(pvcName, namespace); err != nil {
-			klog.Error(err, "Failed to ensure PVC exists, falling back to EmptyDir", "pvc", pvcName, "namespace", namespace)
-			pvcName = "" // Fall back to EmptyDir if PVC creation fails
-		}
-	}
-
 	// Add etc-netclient volume
-	// Use PersistentVolumeClaim if configured, otherwise use EmptyDir for backward compatibility
+	// Use persistent storage if configured, otherwise use EmptyDir for backward compatibility
 	// EmptyDir ensures each pod gets its own isolated configuration directory when PVC is not used.
-	if !hasEtcNetclient {
-		var etcVolume corev1.Volume
-		if pvcName != "" {
-			// Use PersistentVolumeClaim for persistent storage
-			etcVolume = corev1.Volume{
-				Name: "etc-netclient",
-				VolumeSource: corev1.VolumeSource{
-					PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
-						ClaimName: pvcName,
-						ReadOnly:  false,
-					},
-				},
-			}
-			klog.Info("Using PersistentVolumeClaim for netclient", "pvc", pvcName, "namespace", namespace)
-		} else {
-			// Fallback to EmptyDir for backward compatibility
-			etcVolume = corev1.Volume{
+	switch {
+	case hasEtcNetclient:
+		klog.Info("etc-netclient volume already exists, skipping", "namespace", namespace)
+	case target.kind == "StatefulSet" && annotations[netclientStateAnnotation] != netclientStateEphemeral:
+		if target.claimTemplates == nil {
+			target.warnings = append(target.warnings, "netclient state is not persistent: volumeClaimTemplates can't be added to an "+
+				"existing StatefulSet, recreate it to keep a stable Netmaker identity per pod")
+			podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
 				Name: "etc-netclient",
 				VolumeSource: corev1.VolumeSource{
 					EmptyDir: &corev1.EmptyDirVolumeSource{},
 				},
+			})
+			break
+		}
+		// Every StatefulSet pod gets its own claim (etc-netclient-<statefulset>-<ordinal>), so each ordinal
+		// keeps its netclient host ID and Netmaker IP across restarts and rescheduling
+		*target.claimTemplates = append(*target.claimTemplates, netclientClaimTemplate())
+		klog.Info("Using volumeClaimTemplate for netclient", "namespace", namespace)
+	case pvcName != "" && target.kind == "Pod":
+		podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+			Name: "etc-netclient",
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+					ClaimName: pvcName,
+					ReadOnly:  false,
+				},
+			},
+		})
+		target.setAnnotation(netclientPVCAnnotation, pvcName)
+		klog.Info("Using PersistentVolumeClaim for netclient", "pvc", pvcName, "namespace", namespace)
+	default:
+		if pvcName != "" {
+			// A single ReadWriteOnce claim can't be shared by the pods of a Deployment, DaemonSet, Job or ReplicaSet
+			if hasPVCAnnotation(annotations, namespace) {
+				return &invalidAnnotationsError{problems: []string{fmt.Sprintf(
+					"netmaker.io/pvc-name can't be shared by the pods of a %s; use a StatefulSet for persistent netclient state or remove the annotation",
+					target.kind)}}
 			}
-			klog.Info("Using EmptyDir for netclient (no PVC configured)", "namespace", namespace)
+			klog.Warning("Ignoring NETCLIENT_PVC_NAME, a shared claim is only used for single pods", "kind", target.kind, "namespace", namespace)
 		}
-		podSpec.Volumes = append(podSpec.Volumes, etcVolume)
-	} else {
-		klog.Info("etc-netclient volume already exists, skipping", "namespace", namespace)
+		// Fallback to EmptyDir for backward compatibility
+		podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+			Name: "etc-netclient",
+			VolumeSource: corev1.VolumeSource{
+				EmptyDir: &corev1.EmptyDirVolumeSource{},
+			},
+		})
+		klog.Info("Using EmptyDir for netclient (no PVC configured)", "namespace", namespace)
 	}
 
 	// Add log-netclient volume (always use EmptyDir with Memory medium for logs)
@@ -480,75 +798,44 @@ func (w *NetclientSidecarWebhook) addNetclientVolumesToPodSpec(podSpec *corev1.P
 		}
 		podSpec.Volumes = append(podSpec.Volumes, logVolume)
 	}
+	return nil
 }
 
-// ensurePVCExists ensures that the PVC exists, creating it if it doesn't
-func (w *NetclientSidecarWebhook) ensurePVCExists(pvcName, namespace string) error {
-	if w.client == nil {
-		return fmt.Errorf("client not initialized")
-	}
-
-	// Check if PVC already exists
-	pvc := &corev1.PersistentVolumeClaim{}
-	namespacedName := types.NamespacedName{
-		Name:      pvcName,
-		Namespace: namespace,
-	}
-
-	err := w.client.Get(context.Background(), namespacedName, pvc)
-	if err == nil {
-		// PVC exists, nothing to do
-		klog.Info("PVC already exists", "pvc", pvcName, "namespace", namespace)
-		return nil
-	}
-
-	// Check if error is "not found" - if so, create the PVC
-	if client.IgnoreNotFound(err) == nil {
-		// PVC doesn't exist, create it
-		klog.Info("Creating PVC", "pvc", pvcName, "namespace", namespace)
-
-		// Get PVC configuration from environment variables or use defaults
-		storageSize := getEnvOrDefault("NETCLIENT_PVC_STORAGE_SIZE", "1Gi")
-		storageClass := getEnvOrDefault("NETCLIENT_PVC_STORAGE_CLASS", "") // Empty means use default
-
-		// Create PVC spec
-		pvc = &corev1.PersistentVolumeClaim{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:      pvcName,
-				Namespace: namespace,
-				Labels: map[string]string{
-					"app.kubernetes.io/component":  "netclient",
-					"app.kubernetes.io/managed-by": "netmaker-k8s-ops-webhook",
-				},
+// netclientClaimTemplate returns the StatefulSet volumeClaimTemplate holding /etc/netclient
+func netclientClaimTemplate() corev1.PersistentVolumeClaim {
+	// Get PVC configuration from environment variables or use defaults
+	storageSize := getEnvOrDefault("NETCLIENT_PVC_STORAGE_SIZE", "1Gi")
+	storageClass := getEnvOrDefault("NETCLIENT_PVC_STORAGE_CLASS", "") // Empty means use default
+
+	claim := corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "etc-netclient",
+			Labels: map[string]string{
+				"app.kubernetes.io/component":  "netclient",
+				"app.kubernetes.io/managed-by": webhookManagedBy,
 			},
-			Spec: corev1.PersistentVolumeClaimSpec{
-				AccessModes: []corev1.PersistentVolumeAccessMode{
-					corev1.ReadWriteOnce,
-				},
-				Resources: corev1.VolumeResourceRequirements{
-					Requests: corev1.ResourceList{
-						corev1.ResourceStorage: resource.MustParse(storageSize),
-					},
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes: []corev1.PersistentVolumeAccessMode{
+				corev1.ReadWriteOnce,
+			},
+			Resources: corev1.VolumeResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceStorage: resource.MustParse(storageSize),
 				},
 			},
-		}
-
-		// Set storage class if specified
-		if storageClass != "" {
-			pvc.Spec.StorageClassName = &storageClass
-		}
-
-		// Create the PVC
-		if err := w.client.Create(context.Background(), pvc); err != nil {
-			return fmt.Errorf("failed to create PVC %s in namespace %s: %w", pvcName, namespace, err)
-		}
-
-		klog.Info("Successfully created PVC", "pvc", pvcName, "namespace", namespace, "storageSize", storageSize)
-		return nil
+		},
+	}
+	// Set storage class if specified
+	if storageClass != "" {
+		claim.Spec.StorageClassName = &storageClass
 	}
+	return claim
+}
 
-	// Some other error occurred
-	return fmt.Errorf("failed to check PVC existence: %w", err)
+// hasPVCAnnotation checks if the workload explicitly asks for a netclient PVC
+func hasPVCAnnotation(annotations map[string]string, namespace string) bool {
+	return annotations["netmaker.io/pvc-name"] != "" || annotations[fmt.Sprintf("netmaker.io/pvc-name.%s", namespace)] != ""
 }
 
 // getPVCNameFromPod gets the PVC name from pod annotations or environment variable
@@ -580,44 +867,11 @@ func getPVCNameFromPod(annotations map[string]string, namespace string) string {
 	return ""
 }
 
-// getNetclientTokenFromSecret reads the netclient token from a Kubernetes secret
-func (w *NetclientSidecarWebhook) getNetclientTokenFromSecret(pod *corev1.Pod) (string, error) {
-	// Check if client is available
-	if w.client == nil {
-		return "", fmt.Errorf("client not initialized")
-	}
-
-	// Get secret configuration from pod labels or environment variables
-	secretName := w.getSecretNameFromPod(pod)
-	secretKey := w.getSecretKeyFromPod(pod)
-	secretNamespace := w.getSecretNamespaceFromPod(pod)
-
-	// Create secret object
-	secret := &corev1.Secret{}
-	secretNamespacedName := types.NamespacedName{
-		Name:      secretName,
-		Namespace: secretNamespace,
-	}
-
-	// Get the secret
-	if err := w.client.Get(context.Background(), secretNamespacedName, secret); err != nil {
-		return "", err
-	}
-
-	// Extract the token
-	tokenBytes, exists := secret.Data[secretKey]
-	if !exists {
-		return "", fmt.Errorf("key %s not found in secret %s in namespace %s", secretKey, secretName, secretNamespace)
-	}
-
-	return string(tokenBytes), nil
-}
-
 // getSecretNameFromPod gets the secret name from pod labels or environment variable
 func (w *NetclientSidecarWebhook) getSecretNameFromPod(pod *corev1.Pod) string {
 	// Check if pod has custom secret name label
 	if pod.Labels != nil {
-		if secretName, exists := pod.Labels["netmaker.io/secret-name"]; exists && secretName != "" {
+		if secretName, exists := pod.Labels[secretNameLabel]; exists && secretName != "" {
 			return secretName
 		}
 	}
@@ -630,7 +884,7 @@ func (w *NetclientSidecarWebhook) getSecretNameFromPod(pod *corev1.Pod) string {
 func (w *NetclientSidecarWebhook) getSecretKeyFromPod(pod *corev1.Pod) string {
 	// Check if pod has custom secret key label
 	if pod.Labels != nil {
-		if secretKey, exists := pod.Labels["netmaker.io/secret-key"]; exists && secretKey != "" {
+		if secretKey, exists := pod.Labels[secretKeyLabel]; exists && secretKey != "" {
 			return secretKey
 		}
 	}
@@ -643,7 +897,7 @@ func (w *NetclientSidecarWebhook) getSecretKeyFromPod(pod *corev1.Pod) string {
 func (w *NetclientSidecarWebhook) getSecretNamespaceFromPod(pod *corev1.Pod) string {
 	// Check if pod has custom secret namespace label
 	if pod.Labels != nil {
-		if secretNamespace, exists := pod.Labels["netmaker.io/secret-namespace"]; exists && secretNamespace != "" {
+		if secretNamespace, exists := pod.Labels[secretNamespaceLabel]; exists && secretNamespace != "" {
 			return secretNamespace
 		}
 	}
@@ -0,0 +1,1603 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	jsonpatchapply "github.com/evanphx/json-patch/v5"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"gomodules.xyz/jsonpatch/v2"
+	admissionv1 "k8s.io/api/admission/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/version"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/gravitl/netmaker-k8s-ops/internal/controller"
+)
+
+const testNamespace = "default"
+
+// newTestWebhook returns a webhook backed by a fake client holding the default token secret
+func newTestWebhook(objects ...runtime.Object) *NetclientSidecarWebhook {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "netclient-token", Namespace: testNamespace},
+		Data:       map[string][]byte{"token": []byte("test-token")},
+	}
+	objects = append(objects, secret)
+	return &NetclientSidecarWebhook{
+		decoder: admission.NewDecoder(scheme.Scheme),
+		client:  fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRuntimeObjects(objects...).Build(),
+	}
+}
+
+// newAdmissionRequest wraps obj in a CREATE admission request
+func newAdmissionRequest(kind string, obj runtime.Object) admission.Request {
+	raw, err := json.Marshal(obj)
+	Expect(err).NotTo(HaveOccurred())
+	return admission.Request{
+		AdmissionRequest: admissionv1.AdmissionRequest{
+			UID:       "test",
+			Kind:      metav1.GroupVersionKind{Kind: kind},
+			Namespace: testNamespace,
+			Operation: admissionv1.Create,
+			Object:    runtime.RawExtension{Raw: raw},
+		},
+	}
+}
+
+// testPodTemplate returns a labeled pod template with a single app container
+func testPodTemplate() corev1.PodTemplateSpec {
+	return corev1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: map[string]string{
+				"app":                   "demo",
+				"netmaker.io/netclient": "enabled",
+			},
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "app", Image: "nginx"}},
+		},
+	}
+}
+
+// ephemeralPodTemplate returns testPodTemplate with StatefulSet netclient state kept in an emptyDir
+func ephemeralPodTemplate() corev1.PodTemplateSpec {
+	template := testPodTemplate()
+	template.Annotations = map[string]string{"netmaker.io/netclient-state": "ephemeral"}
+	return template
+}
+
+func testObjectMeta() metav1.ObjectMeta {
+	return metav1.ObjectMeta{Name: "demo", Namespace: testNamespace}
+}
+
+// findPatch returns the patch operation for path, or nil
+func findPatch(patches []jsonpatch.JsonPatchOperation, path string) *jsonpatch.JsonPatchOperation {
+	for i := range patches {
+		if patches[i].Path == path {
+			return &patches[i]
+		}
+	}
+	return nil
+}
+
+// applyPatches applies the admission response patches to a raw object
+func applyPatches(raw []byte, patches []jsonpatch.JsonPatchOperation) []byte {
+	patchJSON, err := json.Marshal(patches)
+	Expect(err).NotTo(HaveOccurred())
+	patch, err := jsonpatchapply.DecodePatch(patchJSON)
+	Expect(err).NotTo(HaveOccurred())
+	patched, err := patch.Apply(raw)
+	Expect(err).NotTo(HaveOccurred())
+	return patched
+}
+
+// patchValueNames returns the "name" fields of a patch value holding an object or a list of objects
+func patchValueNames(value interface{}) []string {
+	var names []string
+	switch v := value.(type) {
+	case map[string]interface{}:
+		names = append(names, v["name"].(string))
+	case []interface{}:
+		for _, item := range v {
+			names = append(names, item.(map[string]interface{})["name"].(string))
+		}
+	}
+	return names
+}
+
+// patchValueKeys returns the sorted keys of a patch value holding an object
+func patchValueKeys(value interface{}) []string {
+	var keys []string
+	for key := range value.(map[string]interface{}) {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+var _ = Describe("NetclientSidecarWebhook", func() {
+	DescribeTable("only adds the netclient container and volumes",
+		func(kind string, obj runtime.Object, specPath string) {
+			w := newTestWebhook()
+			resp := w.Handle(context.Background(), newAdmissionRequest(kind, obj))
+
+			// The admitted object gets the injection summary, and workload templates also record what was
+			// injected, pods can't be uninjected
+			annotationsPath := strings.TrimSuffix(specPath, "/spec") + "/metadata/annotations"
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(resp.Patches).NotTo(BeEmpty())
+			for _, patch := range resp.Patches {
+				Expect(patch.Operation).To(Equal("add"), "unexpected patch %s %s", patch.Operation, patch.Path)
+				if patch.Path == "/metadata/annotations" {
+					Expect(patchValueKeys(patch.Value)).To(Equal([]string{injectedAnnotation}))
+					continue
+				}
+				if kind != "Pod" && strings.HasPrefix(patch.Path, annotationsPath) {
+					Expect(patch.Path + fmt.Sprint(patch.Value)).To(ContainSubstring("netclient-injected-resources"))
+					continue
+				}
+				Expect(strings.HasPrefix(patch.Path, specPath+"/")).To(BeTrue(), "patch outside the pod spec: %s", patch.Path)
+			}
+
+			container := findPatch(resp.Patches, specPath+"/containers/1")
+			Expect(container).NotTo(BeNil())
+			Expect(patchValueNames(container.Value)).To(Equal([]string{"netclient"}))
+
+			volumes := findPatch(resp.Patches, specPath+"/volumes")
+			Expect(volumes).NotTo(BeNil())
+			Expect(patchValueNames(volumes.Value)).To(Equal([]string{"etc-netclient", "log-netclient"}))
+
+			if kind == "Pod" {
+				Expect(resp.Patches).To(HaveLen(3))
+			} else {
+				Expect(resp.Patches).To(HaveLen(4))
+			}
+		},
+		Entry("Pod", "Pod", &corev1.Pod{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+			ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: testNamespace, Labels: testPodTemplate().Labels},
+			Spec:       testPodTemplate().Spec,
+		}, "/spec"),
+		Entry("Deployment", "Deployment", &appsv1.Deployment{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"},
+			ObjectMeta: testObjectMeta(),
+			Spec:       appsv1.DeploymentSpec{Template: testPodTemplate()},
+		}, "/spec/template/spec"),
+		Entry("StatefulSet", "StatefulSet", &appsv1.StatefulSet{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "StatefulSet"},
+			ObjectMeta: testObjectMeta(),
+			Spec:       appsv1.StatefulSetSpec{ServiceName: "demo", Template: ephemeralPodTemplate()},
+		}, "/spec/template/spec"),
+		Entry("DaemonSet", "DaemonSet", &appsv1.DaemonSet{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "DaemonSet"},
+			ObjectMeta: testObjectMeta(),
+			Spec:       appsv1.DaemonSetSpec{Template: testPodTemplate()},
+		}, "/spec/template/spec"),
+		Entry("Job", "Job", &batchv1.Job{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "batch/v1", Kind: "Job"},
+			ObjectMeta: testObjectMeta(),
+			Spec:       batchv1.JobSpec{Template: testPodTemplate()},
+		}, "/spec/template/spec"),
+		Entry("CronJob", "CronJob", &batchv1.CronJob{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "batch/v1", Kind: "CronJob"},
+			ObjectMeta: testObjectMeta(),
+			Spec: batchv1.CronJobSpec{
+				Schedule:    "*/5 * * * *",
+				JobTemplate: batchv1.JobTemplateSpec{Spec: batchv1.JobSpec{Template: testPodTemplate()}},
+			},
+		}, "/spec/jobTemplate/spec/template/spec"),
+		Entry("ReplicaSet", "ReplicaSet", &appsv1.ReplicaSet{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "ReplicaSet"},
+			ObjectMeta: testObjectMeta(),
+			Spec:       appsv1.ReplicaSetSpec{Template: testPodTemplate()},
+		}, "/spec/template/spec"),
+	)
+
+	Context("with native sidecars", func() {
+		It("injects netclient as the first restartable init container", func() {
+			template := testPodTemplate()
+			template.Spec.InitContainers = []corev1.Container{{Name: "migrate", Image: "busybox"}}
+			job := &batchv1.Job{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "batch/v1", Kind: "Job"},
+				ObjectMeta: testObjectMeta(),
+				Spec:       batchv1.JobSpec{Template: template},
+			}
+
+			w := newTestWebhook()
+			w.SetNativeSidecars(true)
+			resp := w.Handle(context.Background(), newAdmissionRequest("Job", job))
+
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(findPatch(resp.Patches, "/spec/template/spec/containers/1")).To(BeNil())
+
+			raw, err := json.Marshal(job)
+			Expect(err).NotTo(HaveOccurred())
+			patched := applyPatches(raw, resp.Patches)
+			var result batchv1.Job
+			Expect(json.Unmarshal(patched, &result)).To(Succeed())
+
+			initContainers := result.Spec.Template.Spec.InitContainers
+			Expect(initContainers).To(HaveLen(2))
+			Expect(initContainers[0].Name).To(Equal("netclient"))
+			Expect(initContainers[0].RestartPolicy).NotTo(BeNil())
+			Expect(*initContainers[0].RestartPolicy).To(Equal(corev1.ContainerRestartPolicyAlways))
+			Expect(initContainers[0].StartupProbe).NotTo(BeNil())
+			Expect(initContainers[1].Name).To(Equal("migrate"))
+			Expect(result.Spec.Template.Spec.Containers).To(HaveLen(1))
+		})
+
+		It("does not inject twice", func() {
+			template := testPodTemplate()
+			template.Spec.InitContainers = []corev1.Container{{Name: "netclient", Image: "gravitl/netclient"}}
+			deployment := &appsv1.Deployment{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"},
+				ObjectMeta: testObjectMeta(),
+				Spec:       appsv1.DeploymentSpec{Template: template},
+			}
+
+			w := newTestWebhook()
+			w.SetNativeSidecars(true)
+			resp := w.Handle(context.Background(), newAdmissionRequest("Deployment", deployment))
+
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(resp.Patches).To(BeEmpty())
+		})
+	})
+
+	Context("without native sidecars", func() {
+		It("stops netclient once the job containers finish", func() {
+			template := testPodTemplate()
+			template.Spec.RestartPolicy = corev1.RestartPolicyNever
+			template.Spec.Containers[0].Command = []string{"/app/run"}
+			template.Spec.Containers[0].Args = []string{"--once"}
+			job := &batchv1.Job{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "batch/v1", Kind: "Job"},
+				ObjectMeta: testObjectMeta(),
+				Spec:       batchv1.JobSpec{Template: template},
+			}
+
+			resp := newTestWebhook().Handle(context.Background(), newAdmissionRequest("Job", job))
+			Expect(resp.Allowed).To(BeTrue())
+
+			raw, err := json.Marshal(job)
+			Expect(err).NotTo(HaveOccurred())
+			var result batchv1.Job
+			Expect(json.Unmarshal(applyPatches(raw, resp.Patches), &result)).To(Succeed())
+
+			podSpec := result.Spec.Template.Spec
+			Expect(podSpec.Containers).To(HaveLen(2))
+			app, netclient := podSpec.Containers[0], podSpec.Containers[1]
+
+			// The original command is kept as positional parameters of the wrapper
+			Expect(app.Command[:2]).To(Equal([]string{"/bin/sh", "-c"}))
+			Expect(app.Command[len(app.Command)-1]).To(Equal("/app/run"))
+			Expect(app.Args).To(Equal([]string{"--once"}))
+			Expect(app.Env).To(ContainElement(corev1.EnvVar{Name: doneFileEnv, Value: lifecycleMountPath + "/app.done"}))
+
+			Expect(netclient.Name).To(Equal("netclient"))
+			Expect(netclient.Command).To(HaveLen(3))
+			Expect(netclient.Command[2]).To(ContainSubstring(lifecycleMountPath + "/app.done"))
+			Expect(netclient.VolumeMounts).To(ContainElement(HaveField("Name", lifecycleVolumeName)))
+			Expect(podSpec.Volumes).To(ContainElement(HaveField("Name", lifecycleVolumeName)))
+		})
+
+		It("warns about job containers without a command", func() {
+			template := testPodTemplate()
+			template.Spec.RestartPolicy = corev1.RestartPolicyOnFailure
+			template.Spec.Containers[0].Command = nil
+			job := &batchv1.Job{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "batch/v1", Kind: "Job"},
+				ObjectMeta: testObjectMeta(),
+				Spec:       batchv1.JobSpec{Template: template},
+			}
+
+			resp := newTestWebhook().Handle(context.Background(), newAdmissionRequest("Job", job))
+
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(resp.Warnings).To(ContainElement(And(ContainSubstring("container app has no command"), ContainSubstring(doneFileEnv))))
+			Expect(findPatch(resp.Patches, "/spec/template/spec/containers/0/command")).To(BeNil())
+		})
+
+		It("leaves long-running pods unchanged", func() {
+			deployment := &appsv1.Deployment{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"},
+				ObjectMeta: testObjectMeta(),
+				Spec:       appsv1.DeploymentSpec{Template: testPodTemplate()},
+			}
+			deployment.Spec.Template.Spec.Containers[0].Command = []string{"/app/serve"}
+
+			resp := newTestWebhook().Handle(context.Background(), newAdmissionRequest("Deployment", deployment))
+
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(findPatch(resp.Patches, "/spec/template/spec/containers/0/command/0")).To(BeNil())
+			container := findPatch(resp.Patches, "/spec/template/spec/containers/1")
+			Expect(container).NotTo(BeNil())
+			Expect(container.Value).NotTo(HaveKey("command"))
+		})
+	})
+
+	DescribeTable("detects native sidecar support from the API server version",
+		func(gitVersion string, expected bool) {
+			Expect(NativeSidecarsSupported(&version.Info{GitVersion: gitVersion})).To(Equal(expected))
+		},
+		Entry("1.28", "v1.28.9", false),
+		Entry("1.29", "v1.29.0", true),
+		Entry("1.30 with a vendor suffix", "v1.30.2-eks-1552ad0", true),
+		Entry("unparseable", "unknown", false),
+	)
+
+	Context("token handling", func() {
+		tokenEnv := func(container corev1.Container) *corev1.EnvVar {
+			for i := range container.Env {
+				if container.Env[i].Name == "TOKEN" {
+					return &container.Env[i]
+				}
+			}
+			return nil
+		}
+
+		It("references the token secret instead of embedding the token", func() {
+			pod := &corev1.Pod{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+				ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: testNamespace, Labels: testPodTemplate().Labels},
+				Spec:       testPodTemplate().Spec,
+			}
+
+			resp := newTestWebhook().Handle(context.Background(), newAdmissionRequest("Pod", pod))
+			Expect(resp.Allowed).To(BeTrue())
+
+			patchJSON, err := json.Marshal(resp.Patches)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(patchJSON)).NotTo(ContainSubstring("test-token"))
+
+			raw, err := json.Marshal(pod)
+			Expect(err).NotTo(HaveOccurred())
+			var result corev1.Pod
+			Expect(json.Unmarshal(applyPatches(raw, resp.Patches), &result)).To(Succeed())
+			env := tokenEnv(result.Spec.Containers[1])
+			Expect(env).NotTo(BeNil())
+			Expect(env.Value).To(BeEmpty())
+			Expect(env.ValueFrom.SecretKeyRef.Name).To(Equal("netclient-token"))
+			Expect(env.ValueFrom.SecretKeyRef.Key).To(Equal("token"))
+		})
+
+		It("references a mirror of a token secret from another namespace", func() {
+			GinkgoT().Setenv("OPERATOR_NAMESPACE", "netmaker")
+			GinkgoT().Setenv("NETCLIENT_SECRET_NAME", "shared-token")
+			source := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "shared-token", Namespace: "netmaker"},
+				Data:       map[string][]byte{"token": []byte("shared")},
+			}
+			template := testPodTemplate()
+			template.Labels["netmaker.io/secret-namespace"] = "netmaker"
+			deployment := &appsv1.Deployment{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"},
+				ObjectMeta: testObjectMeta(),
+				Spec:       appsv1.DeploymentSpec{Template: template},
+			}
+
+			w := newTestWebhook(source)
+			resp := w.Handle(context.Background(), newAdmissionRequest("Deployment", deployment))
+			Expect(resp.Allowed).To(BeTrue())
+
+			raw, err := json.Marshal(deployment)
+			Expect(err).NotTo(HaveOccurred())
+			var result appsv1.Deployment
+			Expect(json.Unmarshal(applyPatches(raw, resp.Patches), &result)).To(Succeed())
+			env := tokenEnv(result.Spec.Template.Spec.Containers[1])
+			Expect(env.ValueFrom.SecretKeyRef.Name).To(Equal("shared-token-netmaker"))
+			// The controller creates the mirror, admission itself has no side effects
+			Expect(result.Spec.Template.Annotations[tokenSourceAnnotation]).To(Equal("netmaker/shared-token"))
+			secrets := &corev1.SecretList{}
+			Expect(w.client.List(context.Background(), secrets)).To(Succeed())
+			Expect(secrets.Items).To(HaveLen(2))
+		})
+
+		DescribeTable("rejects token secrets from another namespace other than the configured one",
+			func(labels map[string]string) {
+				GinkgoT().Setenv("OPERATOR_NAMESPACE", "netmaker")
+				template := testPodTemplate()
+				for key, value := range labels {
+					template.Labels[key] = value
+				}
+				deployment := &appsv1.Deployment{
+					TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"},
+					ObjectMeta: testObjectMeta(),
+					Spec:       appsv1.DeploymentSpec{Template: template},
+				}
+
+				resp := newTestWebhook().Handle(context.Background(), newAdmissionRequest("Deployment", deployment))
+				Expect(resp.Allowed).To(BeFalse())
+				Expect(resp.Result.Code).To(Equal(int32(http.StatusBadRequest)))
+			},
+			Entry("another namespace", map[string]string{"netmaker.io/secret-namespace": "kube-system"}),
+			Entry("another secret", map[string]string{
+				"netmaker.io/secret-namespace": "netmaker", "netmaker.io/secret-name": "webhook-certs"}),
+			Entry("another key", map[string]string{
+				"netmaker.io/secret-namespace": "netmaker", "netmaker.io/secret-key": "tls.key"}),
+		)
+
+		It("rejects the workload when no token is available", func() {
+			DeferCleanup(os.Setenv, "NETCLIENT_TOKEN", os.Getenv("NETCLIENT_TOKEN"))
+			Expect(os.Unsetenv("NETCLIENT_TOKEN")).To(Succeed())
+
+			template := testPodTemplate()
+			template.Labels["netmaker.io/secret-name"] = "missing"
+			deployment := &appsv1.Deployment{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"},
+				ObjectMeta: testObjectMeta(),
+				Spec:       appsv1.DeploymentSpec{Template: template},
+			}
+
+			resp := newTestWebhook().Handle(context.Background(), newAdmissionRequest("Deployment", deployment))
+
+			Expect(resp.Allowed).To(BeFalse())
+			Expect(resp.Result.Message).To(ContainSubstring("missing"))
+		})
+
+		It("rejects a token secret without the key", func() {
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "team-token", Namespace: testNamespace},
+				Data:       map[string][]byte{"other": []byte("value")},
+			}
+			template := testPodTemplate()
+			template.Labels["netmaker.io/secret-name"] = "team-token"
+			deployment := &appsv1.Deployment{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"},
+				ObjectMeta: testObjectMeta(),
+				Spec:       appsv1.DeploymentSpec{Template: template},
+			}
+
+			resp := newTestWebhook(secret).Handle(context.Background(), newAdmissionRequest("Deployment", deployment))
+
+			Expect(resp.Allowed).To(BeFalse())
+			Expect(resp.Result.Message).To(ContainSubstring("has no key token"))
+		})
+	})
+
+	Context("annotation overrides", func() {
+		newDeployment := func(annotations map[string]string) *appsv1.Deployment {
+			template := testPodTemplate()
+			template.Annotations = annotations
+			return &appsv1.Deployment{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"},
+				ObjectMeta: testObjectMeta(),
+				Spec:       appsv1.DeploymentSpec{Template: template},
+			}
+		}
+
+		It("applies the netclient overrides", func() {
+			deployment := newDeployment(map[string]string{
+				netclientImageAnnotation:     "registry.example.com/netclient:v1.5.0",
+				networkAnnotation:            "edge",
+				serverAnnotation:             "api.netmaker.example.com",
+				logLevelAnnotation:           "DEBUG",
+				netclientResourcesAnnotation: `{"limits":{"memory":"256Mi"},"requests":{"cpu":"100m"}}`,
+			})
+
+			resp := newTestWebhook().Handle(context.Background(), newAdmissionRequest("Deployment", deployment))
+			Expect(resp.Allowed).To(BeTrue())
+
+			raw, err := json.Marshal(deployment)
+			Expect(err).NotTo(HaveOccurred())
+			var result appsv1.Deployment
+			Expect(json.Unmarshal(applyPatches(raw, resp.Patches), &result)).To(Succeed())
+
+			netclient := result.Spec.Template.Spec.Containers[1]
+			Expect(netclient.Image).To(Equal("registry.example.com/netclient:v1.5.0"))
+			Expect(netclient.Env).To(ContainElements(
+				corev1.EnvVar{Name: "NETWORK", Value: "edge"},
+				corev1.EnvVar{Name: "SERVER", Value: "api.netmaker.example.com"},
+				corev1.EnvVar{Name: "LOG_LEVEL", Value: "debug"},
+			))
+			Expect(netclient.Resources.Limits.Memory().String()).To(Equal("256Mi"))
+			Expect(netclient.Resources.Limits.Cpu().String()).To(Equal("200m"))
+			Expect(netclient.Resources.Requests.Cpu().String()).To(Equal("100m"))
+		})
+
+		It("rejects malformed overrides with a clear error", func() {
+			deployment := newDeployment(map[string]string{
+				netclientImageAnnotation:     "not an image",
+				logLevelAnnotation:           "verbose",
+				netclientResourcesAnnotation: `{"limit":{}}`,
+			})
+
+			resp := newTestWebhook().Handle(context.Background(), newAdmissionRequest("Deployment", deployment))
+
+			Expect(resp.Allowed).To(BeFalse())
+			Expect(resp.Result.Code).To(Equal(int32(http.StatusBadRequest)))
+			Expect(resp.Result.Message).To(ContainSubstring(netclientImageAnnotation))
+			Expect(resp.Result.Message).To(ContainSubstring(logLevelAnnotation))
+			Expect(resp.Result.Message).To(ContainSubstring(netclientResourcesAnnotation))
+		})
+
+		It("rejects requests above the limit", func() {
+			deployment := newDeployment(map[string]string{
+				netclientResourcesAnnotation: `{"requests":{"memory":"1Gi"}}`,
+			})
+
+			resp := newTestWebhook().Handle(context.Background(), newAdmissionRequest("Deployment", deployment))
+
+			Expect(resp.Allowed).To(BeFalse())
+			Expect(resp.Result.Message).To(ContainSubstring("exceeds limit"))
+		})
+
+		It("lowers the default request to a lower limit", func() {
+			deployment := newDeployment(map[string]string{
+				netclientResourcesAnnotation: `{"limits":{"memory":"48Mi"}}`,
+			})
+
+			resp := newTestWebhook().Handle(context.Background(), newAdmissionRequest("Deployment", deployment))
+			Expect(resp.Allowed).To(BeTrue())
+
+			raw, err := json.Marshal(deployment)
+			Expect(err).NotTo(HaveOccurred())
+			var result appsv1.Deployment
+			Expect(json.Unmarshal(applyPatches(raw, resp.Patches), &result)).To(Succeed())
+
+			netclient := result.Spec.Template.Spec.Containers[1]
+			Expect(netclient.Resources.Limits.Memory().String()).To(Equal("48Mi"))
+			Expect(netclient.Resources.Requests.Memory().String()).To(Equal("48Mi"))
+			Expect(netclient.Resources.Requests.Cpu().String()).To(Equal("50m"))
+		})
+
+		It("merges the readiness probe override", func() {
+			deployment := newDeployment(map[string]string{
+				netclientReadinessProbeAnnotation: `{"periodSeconds":10,"failureThreshold":30}`,
+			})
+
+			resp := newTestWebhook().Handle(context.Background(), newAdmissionRequest("Deployment", deployment))
+			Expect(resp.Allowed).To(BeTrue())
+
+			raw, err := json.Marshal(deployment)
+			Expect(err).NotTo(HaveOccurred())
+			var result appsv1.Deployment
+			Expect(json.Unmarshal(applyPatches(raw, resp.Patches), &result)).To(Succeed())
+
+			probe := result.Spec.Template.Spec.Containers[1].ReadinessProbe
+			Expect(probe.PeriodSeconds).To(Equal(int32(10)))
+			Expect(probe.FailureThreshold).To(Equal(int32(30)))
+			Expect(probe.TimeoutSeconds).To(Equal(int32(3)))
+			Expect(probe.Exec.Command[2]).To(ContainSubstring("ip addr show netmaker"))
+		})
+
+		It("replaces the readiness check with the probe handler of the override", func() {
+			probe := &corev1.Probe{
+				ProbeHandler: corev1.ProbeHandler{Exec: &corev1.ExecAction{Command: []string{"/bin/sh", "-c", "ip link show netmaker"}}},
+			}
+			applyReadinessProbeOverride(probe, &corev1.Probe{
+				ProbeHandler: corev1.ProbeHandler{Exec: &corev1.ExecAction{Command: []string{"/bin/sh", "-c", "ping -c1 10.101.0.1"}}},
+			})
+			Expect(probe.Exec.Command[2]).To(Equal("ping -c1 10.101.0.1"))
+		})
+
+		It("rejects malformed readiness probe overrides", func() {
+			for _, value := range []string{`{"period":10}`, `{"periodSeconds":-1}`} {
+				deployment := newDeployment(map[string]string{netclientReadinessProbeAnnotation: value})
+
+				resp := newTestWebhook().Handle(context.Background(), newAdmissionRequest("Deployment", deployment))
+
+				Expect(resp.Allowed).To(BeFalse())
+				Expect(resp.Result.Code).To(Equal(int32(http.StatusBadRequest)))
+				Expect(resp.Result.Message).To(ContainSubstring(netclientReadinessProbeAnnotation))
+			}
+		})
+	})
+
+	Context("Netmaker DNS", func() {
+		kubeDNS := &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "kube-dns", Namespace: "kube-system"},
+			Spec:       corev1.ServiceSpec{ClusterIP: "10.96.0.10"},
+		}
+		admit := func(kind string, obj runtime.Object, w *NetclientSidecarWebhook) (admission.Response, corev1.PodTemplateSpec) {
+			resp := w.Handle(context.Background(), newAdmissionRequest(kind, obj))
+			if !resp.Allowed {
+				return resp, corev1.PodTemplateSpec{}
+			}
+			raw, err := json.Marshal(obj)
+			Expect(err).NotTo(HaveOccurred())
+			var result appsv1.Deployment
+			Expect(json.Unmarshal(applyPatches(raw, resp.Patches), &result)).To(Succeed())
+			return resp, result.Spec.Template
+		}
+		newDeployment := func(annotations map[string]string) *appsv1.Deployment {
+			template := testPodTemplate()
+			template.Annotations = annotations
+			return &appsv1.Deployment{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"},
+				ObjectMeta: testObjectMeta(),
+				Spec:       appsv1.DeploymentSpec{Template: template},
+			}
+		}
+
+		It("adds the Netmaker resolver to the pod dnsConfig", func() {
+			deployment := newDeployment(map[string]string{
+				dnsAnnotation:           "dnsconfig",
+				dnsNameserverAnnotation: "100.64.0.1",
+				networkAnnotation:       "edge",
+			})
+
+			resp, template := admit("Deployment", deployment, newTestWebhook())
+			Expect(resp.Allowed).To(BeTrue())
+
+			Expect(template.Spec.DNSPolicy).To(BeEmpty())
+			Expect(template.Spec.DNSConfig.Nameservers).To(Equal([]string{"100.64.0.1"}))
+			Expect(template.Spec.DNSConfig.Searches).To(Equal([]string{"edge"}))
+			// Cluster DNS answers NXDOMAIN first, so this only works with a stub domain
+			Expect(resp.Warnings).To(ContainElement(ContainSubstring("stub domain")))
+		})
+
+		It("injects a resolver sidecar that splits Netmaker and cluster names", func() {
+			deployment := newDeployment(map[string]string{
+				dnsAnnotation:           "sidecar",
+				dnsNameserverAnnotation: "100.64.0.1",
+				dnsSearchAnnotation:     "edge, edge.example.com",
+			})
+
+			resp, template := admit("Deployment", deployment, newTestWebhook(kubeDNS))
+			Expect(resp.Allowed).To(BeTrue())
+
+			names := []string{}
+			for _, container := range template.Spec.Containers {
+				names = append(names, container.Name)
+			}
+			Expect(names).To(Equal([]string{"app", "netclient", dnsResolverContainerName}))
+			Expect(template.Spec.DNSPolicy).To(Equal(corev1.DNSNone))
+			Expect(template.Spec.DNSConfig.Nameservers).To(Equal([]string{"127.0.0.1"}))
+			Expect(template.Spec.DNSConfig.Searches).To(Equal([]string{
+				"default.svc.cluster.local", "svc.cluster.local", "cluster.local", "edge", "edge.example.com",
+			}))
+
+			corefile := template.Annotations[dnsCorefileAnnotation]
+			Expect(corefile).To(ContainSubstring("edge edge.example.com {\n  bind 127.0.0.1\n  forward . 100.64.0.1"))
+			Expect(corefile).To(ContainSubstring(". {\n  bind 127.0.0.1\n  forward . 10.96.0.10"))
+		})
+
+		It("rejects DNS without a Netmaker resolver", func() {
+			resp, _ := admit("Deployment", newDeployment(map[string]string{dnsAnnotation: "dnsconfig", networkAnnotation: "edge"}), newTestWebhook())
+
+			Expect(resp.Allowed).To(BeFalse())
+			Expect(resp.Result.Code).To(Equal(int32(http.StatusBadRequest)))
+			Expect(resp.Result.Message).To(ContainSubstring(dnsNameserverAnnotation))
+		})
+
+		It("rejects malformed DNS annotations", func() {
+			resp, _ := admit("Deployment", newDeployment(map[string]string{
+				dnsAnnotation:           "coredns",
+				dnsNameserverAnnotation: "resolver.local",
+				dnsSearchAnnotation:     "Not_A_Domain",
+			}), newTestWebhook())
+
+			Expect(resp.Allowed).To(BeFalse())
+			Expect(resp.Result.Message).To(ContainSubstring(dnsAnnotation + " "))
+			Expect(resp.Result.Message).To(ContainSubstring(dnsNameserverAnnotation))
+			Expect(resp.Result.Message).To(ContainSubstring(dnsSearchAnnotation))
+		})
+	})
+
+	Context("multiple networks", func() {
+		partnersToken := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "partners-token", Namespace: testNamespace},
+			Data:       map[string][]byte{"enrollment": []byte("partners")},
+		}
+		newDeployment := func(annotations map[string]string) *appsv1.Deployment {
+			template := testPodTemplate()
+			template.Annotations = annotations
+			return &appsv1.Deployment{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"},
+				ObjectMeta: testObjectMeta(),
+				Spec:       appsv1.DeploymentSpec{Template: template},
+			}
+		}
+
+		It("joins every network with its own token", func() {
+			deployment := newDeployment(map[string]string{
+				networksAnnotation: "prod=netclient-token, partners=partners-token:enrollment",
+				dnsAnnotation:      "dnsconfig", dnsNameserverAnnotation: "100.64.0.1",
+			})
+
+			resp := newTestWebhook(partnersToken).Handle(context.Background(), newAdmissionRequest("Deployment", deployment))
+			Expect(resp.Allowed).To(BeTrue())
+
+			raw, err := json.Marshal(deployment)
+			Expect(err).NotTo(HaveOccurred())
+			var result appsv1.Deployment
+			Expect(json.Unmarshal(applyPatches(raw, resp.Patches), &result)).To(Succeed())
+
+			netclient := result.Spec.Template.Spec.Containers[1]
+			Expect(netclient.Env).To(ContainElements(
+				corev1.EnvVar{Name: "TOKEN", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "netclient-token"}, Key: "token",
+				}}},
+				corev1.EnvVar{Name: "NETWORK", Value: "prod"},
+				corev1.EnvVar{Name: "NETWORK_1", Value: "partners"},
+				corev1.EnvVar{Name: "TOKEN_1", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "partners-token"}, Key: "enrollment",
+				}}},
+			))
+			Expect(netclient.Command).To(HaveLen(3))
+			Expect(netclient.Command[2]).To(ContainSubstring(`netclient join -t "$token"`))
+			Expect(result.Spec.Template.Spec.DNSConfig.Searches).To(Equal([]string{"prod", "partners"}))
+			Expect(result.Spec.Template.Annotations).NotTo(HaveKey(tokenSourceAnnotation))
+		})
+
+		It("joins the extra networks before waiting for batch containers", func() {
+			deployment := newDeployment(map[string]string{networksAnnotation: "prod=netclient-token,partners=partners-token:enrollment"})
+			job := &batchv1.Job{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "batch/v1", Kind: "Job"},
+				ObjectMeta: testObjectMeta(),
+				Spec:       batchv1.JobSpec{Template: deployment.Spec.Template},
+			}
+			job.Spec.Template.Spec.RestartPolicy = corev1.RestartPolicyNever
+
+			resp := newTestWebhook(partnersToken).Handle(context.Background(), newAdmissionRequest("Job", job))
+			Expect(resp.Allowed).To(BeTrue())
+
+			container := findPatch(resp.Patches, "/spec/template/spec/containers/1")
+			Expect(container).NotTo(BeNil())
+			command := container.Value.(map[string]interface{})["command"].([]interface{})
+			Expect(command[2]).To(ContainSubstring("netclient join"))
+			Expect(command[2]).To(ContainSubstring("app containers finished"))
+		})
+
+		It("rejects missing token secrets and conflicting settings", func() {
+			deployment := newDeployment(map[string]string{
+				networksAnnotation: "prod=netclient-token,partners=missing-token",
+				networkAnnotation:  "prod",
+			})
+
+			resp := newTestWebhook().Handle(context.Background(), newAdmissionRequest("Deployment", deployment))
+			Expect(resp.Allowed).To(BeFalse())
+			Expect(resp.Result.Message).To(ContainSubstring("set only one of"))
+
+			delete(deployment.Spec.Template.Annotations, networkAnnotation)
+			resp = newTestWebhook().Handle(context.Background(), newAdmissionRequest("Deployment", deployment))
+			Expect(resp.Allowed).To(BeFalse())
+			Expect(resp.Result.Code).To(Equal(int32(http.StatusBadRequest)))
+			Expect(resp.Result.Message).To(ContainSubstring("token secret default/missing-token for network partners not found"))
+		})
+
+		It("rejects malformed entries", func() {
+			resp := newTestWebhook().Handle(context.Background(), newAdmissionRequest("Deployment",
+				newDeployment(map[string]string{networksAnnotation: "prod=netclient-token,prod=other,partners"})))
+
+			Expect(resp.Allowed).To(BeFalse())
+			Expect(resp.Result.Message).To(ContainSubstring("lists network prod twice"))
+			Expect(resp.Result.Message).To(ContainSubstring(`entry "partners" must be <network>=<secret>[:<key>]`))
+		})
+	})
+
+	Context("removing the label", func() {
+		// admit runs obj through the webhook and returns the patched object in out
+		admit := func(w *NetclientSidecarWebhook, kind string, obj runtime.Object, out runtime.Object) admission.Response {
+			req := newAdmissionRequest(kind, obj)
+			req.Operation = admissionv1.Update
+			resp := w.Handle(context.Background(), req)
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(json.Unmarshal(applyPatches(req.Object.Raw, resp.Patches), out)).To(Succeed())
+			return resp
+		}
+
+		It("restores the deployment template it injected into", func() {
+			template := testPodTemplate()
+			template.Annotations = map[string]string{
+				dnsAnnotation:           "dnsconfig",
+				dnsNameserverAnnotation: "10.101.0.1",
+				networkAnnotation:       "edge",
+				"example.com/keep":      "yes",
+			}
+			template.Spec.DNSConfig = &corev1.PodDNSConfig{Options: []corev1.PodDNSConfigOption{{Name: "ndots", Value: &[]string{"2"}[0]}}}
+			original := &appsv1.Deployment{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"},
+				ObjectMeta: testObjectMeta(),
+				Spec:       appsv1.DeploymentSpec{Template: template},
+			}
+			w := newTestWebhook()
+
+			var injected appsv1.Deployment
+			admit(w, "Deployment", original, &injected)
+			Expect(injected.Spec.Template.Spec.Containers).To(HaveLen(2))
+			Expect(injected.Spec.Template.Spec.DNSConfig.Nameservers).To(Equal([]string{"10.101.0.1"}))
+			Expect(injected.Spec.Template.Annotations).To(HaveKey(injectedResourcesAnnotation))
+
+			delete(injected.Spec.Template.Labels, netclientLabel)
+			var removed appsv1.Deployment
+			resp := admit(w, "Deployment", &injected, &removed)
+			Expect(resp.Result.Message).To(ContainSubstring("netclient sidecar removed"))
+
+			expected := original.Spec.Template.DeepCopy()
+			delete(expected.Labels, netclientLabel)
+			Expect(removed.Spec.Template).To(Equal(*expected))
+		})
+
+		It("unwraps the app commands of cronjobs", func() {
+			template := testPodTemplate()
+			template.Spec.RestartPolicy = corev1.RestartPolicyOnFailure
+			template.Spec.Containers[0].Command = []string{"python", "job.py"}
+			template.Spec.Containers[0].Env = []corev1.EnvVar{{Name: "MODE", Value: "batch"}}
+			original := &batchv1.CronJob{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "batch/v1", Kind: "CronJob"},
+				ObjectMeta: testObjectMeta(),
+				Spec: batchv1.CronJobSpec{
+					Schedule:    "0 * * * *",
+					JobTemplate: batchv1.JobTemplateSpec{Spec: batchv1.JobSpec{Template: template}},
+				},
+			}
+			w := newTestWebhook()
+
+			var injected batchv1.CronJob
+			admit(w, "CronJob", original, &injected)
+			Expect(injected.Spec.JobTemplate.Spec.Template.Spec.Containers[0].Command[0]).To(Equal("/bin/sh"))
+
+			delete(injected.Spec.JobTemplate.Spec.Template.Labels, netclientLabel)
+			injected.Spec.JobTemplate.Spec.Template.Labels[netclientLabel] = "disabled"
+			var removed batchv1.CronJob
+			admit(w, "CronJob", &injected, &removed)
+
+			expected := original.Spec.JobTemplate.Spec.Template.DeepCopy()
+			expected.Labels[netclientLabel] = "disabled"
+			Expect(removed.Spec.JobTemplate.Spec.Template).To(Equal(*expected))
+		})
+
+		It("leaves templates owned by another workload alone", func() {
+			replicaSet := &appsv1.ReplicaSet{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "ReplicaSet"},
+				ObjectMeta: testObjectMeta(),
+				Spec:       appsv1.ReplicaSetSpec{Template: testPodTemplate()},
+			}
+			w := newTestWebhook()
+			var injected appsv1.ReplicaSet
+			admit(w, "ReplicaSet", replicaSet, &injected)
+
+			delete(injected.Spec.Template.Labels, netclientLabel)
+			injected.OwnerReferences = []metav1.OwnerReference{{
+				APIVersion: "apps/v1", Kind: "Deployment", Name: "demo", UID: "uid", Controller: &[]bool{true}[0],
+			}}
+			resp := w.Handle(context.Background(), newAdmissionRequest("ReplicaSet", &injected))
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(resp.Patches).To(BeEmpty())
+		})
+	})
+
+	Context("status reporting", func() {
+		admit := func(w *NetclientSidecarWebhook) *appsv1.Deployment {
+			deployment := &appsv1.Deployment{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"},
+				ObjectMeta: testObjectMeta(),
+				Spec:       appsv1.DeploymentSpec{Template: testPodTemplate()},
+			}
+			resp := w.Handle(context.Background(), newAdmissionRequest("Deployment", deployment))
+			Expect(resp.Allowed).To(BeTrue())
+			raw, err := json.Marshal(deployment)
+			Expect(err).NotTo(HaveOccurred())
+			var result appsv1.Deployment
+			Expect(json.Unmarshal(applyPatches(raw, resp.Patches), &result)).To(Succeed())
+			return &result
+		}
+
+		It("serves the sidecar status and adds the readiness gate when enabled", func() {
+			DeferCleanup(os.Unsetenv, "NETCLIENT_STATUS_PORT")
+			DeferCleanup(os.Unsetenv, "NETCLIENT_READINESS_GATE")
+			Expect(os.Setenv("NETCLIENT_STATUS_PORT", "9193")).To(Succeed())
+			Expect(os.Setenv("NETCLIENT_READINESS_GATE", "true")).To(Succeed())
+
+			result := admit(newTestWebhook())
+			template := result.Spec.Template
+			Expect(template.Annotations).To(HaveKeyWithValue(statusPortAnnotation, "9193"))
+			Expect(template.Spec.ReadinessGates).To(ConsistOf(corev1.PodReadinessGate{ConditionType: connectedConditionType}))
+
+			netclient := template.Spec.Containers[1]
+			Expect(netclient.Ports).To(ConsistOf(corev1.ContainerPort{Name: statusPortName, ContainerPort: 9193, Protocol: corev1.ProtocolTCP}))
+			Expect(netclient.Command).To(HaveLen(3))
+			Expect(netclient.Env).To(ContainElement(corev1.EnvVar{Name: statusAddressEnv,
+				ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: "status.podIP"}}}))
+			// Bound to the pod IP, so Netmaker peers can't read it over the netmaker interface
+			Expect(netclient.Command[2]).To(ContainSubstring(`nc -l -s "$NETCLIENT_STATUS_ADDRESS" -p 9193`))
+			// Only the handshake times, the peer keys stay in the pod
+			Expect(netclient.Command[2]).To(ContainSubstring(`wg show netmaker latest-handshakes 2>/dev/null | awk '{print "handshake=" $2}'`))
+			Expect(netclient.Command[2]).To(HaveSuffix("wait $pid\n"))
+		})
+
+		It("leaves the sidecar alone by default", func() {
+			result := admit(newTestWebhook())
+			template := result.Spec.Template
+			Expect(template.Annotations).NotTo(HaveKey(statusPortAnnotation))
+			Expect(template.Spec.ReadinessGates).To(BeEmpty())
+			Expect(template.Spec.Containers[1].Command).To(BeEmpty())
+		})
+	})
+
+	Context("injection audit", func() {
+		newAuditDeployment := func(annotations map[string]string) *appsv1.Deployment {
+			template := testPodTemplate()
+			template.Annotations = annotations
+			return &appsv1.Deployment{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"},
+				ObjectMeta: testObjectMeta(),
+				Spec:       appsv1.DeploymentSpec{Template: template},
+			}
+		}
+		// newAuditWebhook returns a test webhook reporting events to the returned recorder
+		newAuditWebhook := func() (*NetclientSidecarWebhook, *record.FakeRecorder) {
+			recorder := record.NewFakeRecorder(10)
+			w := newTestWebhook()
+			w.SetEventRecorder(recorder)
+			return w, recorder
+		}
+		injections := func(kind, outcome string) float64 {
+			return testutil.ToFloat64(injectionsTotal.WithLabelValues(testNamespace, kind, outcome))
+		}
+
+		It("summarizes the injection on the workload and reports it", func() {
+			w, recorder := newAuditWebhook()
+			before := injections("Deployment", injectionOutcomeInjected)
+			deployment := newAuditDeployment(map[string]string{networkAnnotation: "edge"})
+			req := newAdmissionRequest("Deployment", deployment)
+			resp := w.Handle(context.Background(), req)
+			Expect(resp.Allowed).To(BeTrue())
+
+			var result appsv1.Deployment
+			Expect(json.Unmarshal(applyPatches(req.Object.Raw, resp.Patches), &result)).To(Succeed())
+			Expect(result.Spec.Template.Annotations).NotTo(HaveKey(injectedAnnotation))
+			var summary injectionSummary
+			Expect(json.Unmarshal([]byte(result.Annotations[injectedAnnotation]), &summary)).To(Succeed())
+			Expect(summary).To(Equal(injectionSummary{
+				Version:     Version,
+				Image:       "gravitl/netclient:v1.4.0",
+				Networks:    []string{"edge"},
+				TokenSecret: &tokenSecretRef{Name: "netclient-token", Key: "token"},
+				Volumes: map[string]string{
+					"etc-netclient": "emptyDir",
+					"log-netclient": "emptyDir/Memory",
+				},
+			}))
+
+			Expect(recorder.Events).To(Receive(Equal("Normal NetclientInjected netclient sidecar added to deployment")))
+			Expect(injections("Deployment", injectionOutcomeInjected)).To(Equal(before + 1))
+		})
+
+		It("records the claim template of statefulsets", func() {
+			statefulSet := &appsv1.StatefulSet{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "StatefulSet"},
+				ObjectMeta: testObjectMeta(),
+				Spec:       appsv1.StatefulSetSpec{ServiceName: "demo", Template: testPodTemplate()},
+			}
+			w, _ := newAuditWebhook()
+			req := newAdmissionRequest("StatefulSet", statefulSet)
+			resp := w.Handle(context.Background(), req)
+			Expect(resp.Allowed).To(BeTrue())
+
+			var result appsv1.StatefulSet
+			Expect(json.Unmarshal(applyPatches(req.Object.Raw, resp.Patches), &result)).To(Succeed())
+			var summary injectionSummary
+			Expect(json.Unmarshal([]byte(result.Annotations[injectedAnnotation]), &summary)).To(Succeed())
+			Expect(summary.Volumes).To(HaveKeyWithValue("etc-netclient", "volumeClaimTemplate/etc-netclient"))
+		})
+
+		It("drops the summary when the sidecar is removed", func() {
+			w, recorder := newAuditWebhook()
+			req := newAdmissionRequest("Deployment", newAuditDeployment(nil))
+			resp := w.Handle(context.Background(), req)
+			var injected appsv1.Deployment
+			Expect(json.Unmarshal(applyPatches(req.Object.Raw, resp.Patches), &injected)).To(Succeed())
+			Expect(injected.Annotations).To(HaveKey(injectedAnnotation))
+			Eventually(recorder.Events).Should(Receive())
+
+			delete(injected.Spec.Template.Labels, netclientLabel)
+			req = newAdmissionRequest("Deployment", &injected)
+			req.Operation = admissionv1.Update
+			resp = w.Handle(context.Background(), req)
+			var removed appsv1.Deployment
+			Expect(json.Unmarshal(applyPatches(req.Object.Raw, resp.Patches), &removed)).To(Succeed())
+			Expect(removed.Annotations).NotTo(HaveKey(injectedAnnotation))
+			Expect(recorder.Events).To(Receive(HavePrefix("Normal NetclientRemoved netclient sidecar removed")))
+		})
+
+		It("reports rejected workloads as warnings", func() {
+			w, recorder := newAuditWebhook()
+			before := injections("Deployment", injectionOutcomeRejected)
+			resp := w.Handle(context.Background(), newAdmissionRequest("Deployment",
+				newAuditDeployment(map[string]string{"netmaker.io/pvc-name": "shared"})))
+			Expect(resp.Allowed).To(BeFalse())
+
+			Expect(recorder.Events).To(Receive(HavePrefix("Warning NetclientInjectionFailed")))
+			Expect(injections("Deployment", injectionOutcomeRejected)).To(Equal(before + 1))
+		})
+
+		It("records nothing for dry-run requests", func() {
+			w, recorder := newAuditWebhook()
+			before := injections("Deployment", injectionOutcomeInjected)
+			req := newAdmissionRequest("Deployment", newAuditDeployment(nil))
+			dryRun := true
+			req.DryRun = &dryRun
+			resp := w.Handle(context.Background(), req)
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(findPatch(resp.Patches, "/metadata/annotations")).NotTo(BeNil())
+
+			Expect(recorder.Events).NotTo(Receive())
+			Expect(injections("Deployment", injectionOutcomeInjected)).To(Equal(before))
+		})
+	})
+
+	Context("waiting for the network", func() {
+		newWaitingDeployment := func(annotations map[string]string) *appsv1.Deployment {
+			template := testPodTemplate()
+			template.Annotations = annotations
+			return &appsv1.Deployment{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"},
+				ObjectMeta: testObjectMeta(),
+				Spec:       appsv1.DeploymentSpec{Template: template},
+			}
+		}
+		admit := func(w *NetclientSidecarWebhook, deployment *appsv1.Deployment) corev1.PodSpec {
+			resp := w.Handle(context.Background(), newAdmissionRequest("Deployment", deployment))
+			Expect(resp.Allowed).To(BeTrue())
+			raw, err := json.Marshal(deployment)
+			Expect(err).NotTo(HaveOccurred())
+			var result appsv1.Deployment
+			Expect(json.Unmarshal(applyPatches(raw, resp.Patches), &result)).To(Succeed())
+			return result.Spec.Template.Spec
+		}
+
+		It("starts netclient first and holds the app in its postStart hook", func() {
+			spec := admit(newTestWebhook(), newWaitingDeployment(map[string]string{
+				waitForNetworkAnnotation: "true",
+				waitPeerAnnotation:       "10.101.0.1",
+				waitTimeoutAnnotation:    "90s",
+			}))
+
+			Expect(spec.Containers).To(HaveLen(2))
+			Expect(spec.Containers[0].Name).To(Equal("netclient"))
+			Expect(spec.Containers[1].Name).To(Equal("app"))
+			hook := spec.Containers[0].Lifecycle.PostStart.Exec.Command
+			Expect(hook[2]).To(ContainSubstring("+ 90 ))"))
+			Expect(hook[2]).To(ContainSubstring("ping -c 1 -W 1 10.101.0.1"))
+			Expect(hook[2]).To(ContainSubstring("Netmaker peer 10.101.0.1 is not reachable after 90s"))
+		})
+
+		It("checks the peer in the native sidecar startup probe", func() {
+			w := newTestWebhook()
+			w.SetNativeSidecars(true)
+			spec := admit(w, newWaitingDeployment(map[string]string{
+				waitForNetworkAnnotation: "true",
+				waitPeerAnnotation:       "db.edge",
+			}))
+
+			probe := spec.InitContainers[0].StartupProbe
+			Expect(probe.Exec.Command[2]).To(ContainSubstring("ping -c 1 -W 1 db.edge"))
+			Expect(probe.PeriodSeconds * probe.FailureThreshold).To(Equal(int32(120)))
+			Expect(spec.Containers[0].Lifecycle).To(BeNil())
+		})
+
+		It("rejects an invalid timeout", func() {
+			deployment := newWaitingDeployment(map[string]string{
+				waitForNetworkAnnotation: "yes",
+				waitTimeoutAnnotation:    "10m",
+			})
+
+			resp := newTestWebhook().Handle(context.Background(), newAdmissionRequest("Deployment", deployment))
+			Expect(resp.Allowed).To(BeFalse())
+			Expect(resp.Result.Message).To(ContainSubstring(waitForNetworkAnnotation))
+			Expect(resp.Result.Message).To(ContainSubstring(waitTimeoutAnnotation))
+		})
+	})
+
+	Context("static IPs", func() {
+		It("copies StatefulSet addresses onto the pod template", func() {
+			statefulSet := &appsv1.StatefulSet{
+				TypeMeta: metav1.TypeMeta{APIVersion: "apps/v1", Kind: "StatefulSet"},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "demo",
+					Namespace:   testNamespace,
+					Annotations: map[string]string{staticIPAnnotation: "10.101.0.10, 10.101.0.11"},
+				},
+				Spec: appsv1.StatefulSetSpec{ServiceName: "demo", Template: testPodTemplate()},
+			}
+
+			resp := newTestWebhook().Handle(context.Background(), newAdmissionRequest("StatefulSet", statefulSet))
+
+			Expect(resp.Allowed).To(BeTrue())
+			raw, err := json.Marshal(statefulSet)
+			Expect(err).NotTo(HaveOccurred())
+			var result appsv1.StatefulSet
+			Expect(json.Unmarshal(applyPatches(raw, resp.Patches), &result)).To(Succeed())
+			Expect(result.Spec.Template.Annotations).To(HaveKeyWithValue(staticIPAnnotation, "10.101.0.10, 10.101.0.11"))
+		})
+
+		It("rejects a static IP shared by the pods of a Deployment", func() {
+			template := testPodTemplate()
+			template.Annotations = map[string]string{staticIPAnnotation: "10.101.0.10"}
+			deployment := &appsv1.Deployment{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"},
+				ObjectMeta: testObjectMeta(),
+				Spec:       appsv1.DeploymentSpec{Template: template},
+			}
+
+			resp := newTestWebhook().Handle(context.Background(), newAdmissionRequest("Deployment", deployment))
+
+			Expect(resp.Allowed).To(BeFalse())
+			Expect(resp.Result.Message).To(ContainSubstring("use a StatefulSet"))
+		})
+
+		It("rejects several addresses on a single pod", func() {
+			pod := &corev1.Pod{
+				TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "demo",
+					Namespace:   testNamespace,
+					Labels:      map[string]string{netclientLabel: "enabled"},
+					Annotations: map[string]string{staticIPAnnotation: "10.101.0.10,10.101.0.11"},
+				},
+				Spec: testPodTemplate().Spec,
+			}
+
+			resp := newTestWebhook().Handle(context.Background(), newAdmissionRequest("Pod", pod))
+
+			Expect(resp.Allowed).To(BeFalse())
+			Expect(resp.Result.Message).To(ContainSubstring("on a Pod takes one address"))
+		})
+
+		It("rejects addresses that aren't IPv4", func() {
+			pod := &corev1.Pod{
+				TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "demo",
+					Namespace:   testNamespace,
+					Labels:      map[string]string{netclientLabel: "enabled"},
+					Annotations: map[string]string{staticIPAnnotation: "fd00::10"},
+				},
+				Spec: testPodTemplate().Spec,
+			}
+
+			resp := newTestWebhook().Handle(context.Background(), newAdmissionRequest("Pod", pod))
+
+			Expect(resp.Allowed).To(BeFalse())
+			Expect(resp.Result.Message).To(ContainSubstring(`"fd00::10" is not an IPv4 address`))
+		})
+	})
+
+	Context("injection policy", func() {
+		newUnlabeledDeployment := func(namespace string) *appsv1.Deployment {
+			template := testPodTemplate()
+			delete(template.Labels, netclientLabel)
+			deployment := &appsv1.Deployment{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"},
+				ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: namespace},
+				Spec:       appsv1.DeploymentSpec{Template: template},
+			}
+			return deployment
+		}
+		enabledNamespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name:   testNamespace,
+			Labels: map[string]string{injectionKey: "enabled"},
+		}}
+
+		It("injects unlabeled workloads in an enabled namespace", func() {
+			deployment := newUnlabeledDeployment(testNamespace)
+
+			resp := newTestWebhook(enabledNamespace).Handle(context.Background(), newAdmissionRequest("Deployment", deployment))
+
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(findPatch(resp.Patches, "/spec/template/spec/containers/1")).NotTo(BeNil())
+		})
+
+		It("honors the per-workload opt-out annotation", func() {
+			deployment := newUnlabeledDeployment(testNamespace)
+			deployment.Spec.Template.Annotations = map[string]string{injectionKey: "disabled"}
+
+			resp := newTestWebhook(enabledNamespace).Handle(context.Background(), newAdmissionRequest("Deployment", deployment))
+
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(resp.Patches).To(BeEmpty())
+		})
+
+		It("leaves node-routed workloads to the node-level netclient", func() {
+			deployment := newUnlabeledDeployment(testNamespace)
+			deployment.Spec.Template.Labels[netclientLabel] = "node"
+
+			resp := newTestWebhook(enabledNamespace).Handle(context.Background(), newAdmissionRequest("Deployment", deployment))
+
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(resp.Patches).To(BeEmpty())
+			Expect(resp.Result.Message).To(ContainSubstring("node-level netclient"))
+		})
+
+		It("never injects into denied namespaces", func() {
+			pod := &corev1.Pod{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+				ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "kube-system", Labels: testPodTemplate().Labels},
+				Spec:       testPodTemplate().Spec,
+			}
+			req := newAdmissionRequest("Pod", pod)
+			req.Namespace = "kube-system"
+
+			resp := newTestWebhook().Handle(context.Background(), req)
+
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(resp.Patches).To(BeEmpty())
+			Expect(resp.Result.Message).To(ContainSubstring("excluded"))
+		})
+	})
+
+	Context("configured pod template kinds", func() {
+		rolloutKind := metav1.GroupVersionKind{Group: "argoproj.io", Version: "v1alpha1", Kind: "Rollout"}
+		knativeKind := metav1.GroupVersionKind{Group: "serving.knative.dev", Version: "v1", Kind: "Service"}
+
+		// newKindsWebhook returns a test webhook injecting into Argo Rollouts and Knative Services
+		newKindsWebhook := func() *NetclientSidecarWebhook {
+			DeferCleanup(os.Unsetenv, "NETCLIENT_POD_TEMPLATE_KINDS")
+			Expect(os.Setenv("NETCLIENT_POD_TEMPLATE_KINDS", `[
+				{"apiVersion": "argoproj.io/v1alpha1", "kind": "Rollout", "path": "{.spec.template}"},
+				{"apiVersion": "serving.knative.dev/v1", "kind": "Service", "path": ".spec.template"}
+			]`)).To(Succeed())
+			kinds, err := PodTemplateKindsFromEnv()
+			Expect(err).NotTo(HaveOccurred())
+			// The cleanup controller follows pods to the same templates
+			Expect(PodTemplateOwners(kinds)).To(Equal([]controller.PodTemplateOwner{
+				{GroupVersionKind: schema.GroupVersionKind{Group: "argoproj.io", Version: "v1alpha1", Kind: "Rollout"}, Fields: []string{"spec", "template"}},
+				{GroupVersionKind: schema.GroupVersionKind{Group: "serving.knative.dev", Version: "v1", Kind: "Service"}, Fields: []string{"spec", "template"}},
+			}))
+			w := newTestWebhook()
+			w.SetPodTemplateKinds(kinds)
+			return w
+		}
+		// newRollout returns an Argo Rollout with the labeled test pod template
+		newRollout := func() map[string]interface{} {
+			podTemplate := testPodTemplate()
+			template, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&podTemplate)
+			Expect(err).NotTo(HaveOccurred())
+			return map[string]interface{}{
+				"apiVersion": "argoproj.io/v1alpha1",
+				"kind":       "Rollout",
+				"metadata":   map[string]interface{}{"name": "demo", "namespace": testNamespace},
+				"spec": map[string]interface{}{
+					"replicas": int64(2),
+					"strategy": map[string]interface{}{"canary": map[string]interface{}{
+						"steps": []interface{}{map[string]interface{}{"setWeight": int64(20)}},
+					}},
+					"template": template,
+				},
+			}
+		}
+		// admit runs object through the webhook as kind and returns the patched object
+		admit := func(w *NetclientSidecarWebhook, kind metav1.GroupVersionKind, operation admissionv1.Operation, object map[string]interface{}) (admission.Response, map[string]interface{}) {
+			raw, err := json.Marshal(object)
+			Expect(err).NotTo(HaveOccurred())
+			req := admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+				UID:       "test",
+				Kind:      kind,
+				Namespace: testNamespace,
+				Operation: operation,
+				Object:    runtime.RawExtension{Raw: raw},
+			}}
+			resp := w.Handle(context.Background(), req)
+			Expect(resp.Allowed).To(BeTrue(), "%v", resp.Result)
+			patched := map[string]interface{}{}
+			Expect(json.Unmarshal(applyPatches(raw, resp.Patches), &patched)).To(Succeed())
+			return resp, patched
+		}
+		// templateOf decodes the pod template at fields of object
+		templateOf := func(object map[string]interface{}, fields ...string) corev1.PodTemplateSpec {
+			value, found, err := unstructured.NestedMap(object, fields...)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(found).To(BeTrue())
+			var template corev1.PodTemplateSpec
+			Expect(runtime.DefaultUnstructuredConverter.FromUnstructured(value, &template)).To(Succeed())
+			return template
+		}
+
+		It("injects into the pod template of rollouts and keeps the rest of the object", func() {
+			resp, patched := admit(newKindsWebhook(), rolloutKind, admissionv1.Create, newRollout())
+			Expect(resp.Result.Message).To(Equal("netclient sidecar added to rollout"))
+			for _, patch := range resp.Patches {
+				Expect(patch.Path).To(Or(HavePrefix("/spec/template/"), Equal("/metadata/annotations")))
+			}
+
+			template := templateOf(patched, "spec", "template")
+			Expect(template.Spec.Containers).To(HaveLen(2))
+			Expect(template.Spec.Containers[1].Name).To(Equal("netclient"))
+			Expect(template.Annotations).To(HaveKey(injectedResourcesAnnotation))
+			steps, _, _ := unstructured.NestedSlice(patched, "spec", "strategy", "canary", "steps")
+			Expect(steps).To(HaveLen(1))
+			Expect(patched["metadata"]).To(HaveKeyWithValue("annotations", HaveKey(injectedAnnotation)))
+		})
+
+		It("keeps pod template fields it doesn't know about", func() {
+			service := map[string]interface{}{
+				"apiVersion": "serving.knative.dev/v1",
+				"kind":       "Service",
+				"metadata": map[string]interface{}{
+					"name":      "demo",
+					"namespace": testNamespace,
+					"labels":    map[string]interface{}{netclientLabel: "enabled"},
+				},
+				"spec": map[string]interface{}{"template": map[string]interface{}{
+					"spec": map[string]interface{}{
+						"containerConcurrency": int64(10),
+						"timeoutSeconds":       int64(300),
+						"containers":           []interface{}{map[string]interface{}{"image": "ghcr.io/example/app"}},
+					},
+				}},
+			}
+			_, patched := admit(newKindsWebhook(), knativeKind, admissionv1.Create, service)
+
+			spec, _, _ := unstructured.NestedMap(patched, "spec", "template", "spec")
+			Expect(spec).To(HaveKeyWithValue("containerConcurrency", BeNumerically("==", 10)))
+			Expect(spec).To(HaveKeyWithValue("timeoutSeconds", BeNumerically("==", 300)))
+			Expect(templateOf(patched, "spec", "template").Spec.Containers).To(HaveLen(2))
+		})
+
+		It("removes the sidecar when the rollout drops the label", func() {
+			w := newKindsWebhook()
+			original := newRollout()
+			_, injected := admit(w, rolloutKind, admissionv1.Create, original)
+
+			Expect(unstructured.SetNestedField(injected, "disabled", "spec", "template", "metadata", "labels", netclientLabel)).To(Succeed())
+			resp, removed := admit(w, rolloutKind, admissionv1.Update, injected)
+			Expect(resp.Result.Message).To(HavePrefix(removedMessagePrefix))
+
+			expected := testPodTemplate()
+			expected.Labels[netclientLabel] = "disabled"
+			Expect(templateOf(removed, "spec", "template")).To(Equal(expected))
+			Expect(removed["metadata"]).NotTo(HaveKey("annotations"))
+		})
+
+		It("leaves kinds that aren't configured alone", func() {
+			resp, _ := admit(newTestWebhook(), rolloutKind, admissionv1.Create, newRollout())
+			Expect(resp.Patches).To(BeEmpty())
+			Expect(resp.Result.Message).To(ContainSubstring("not supported"))
+		})
+
+		DescribeTable("rejects invalid configuration",
+			func(config, message string) {
+				DeferCleanup(os.Unsetenv, "NETCLIENT_POD_TEMPLATE_KINDS")
+				Expect(os.Setenv("NETCLIENT_POD_TEMPLATE_KINDS", config)).To(Succeed())
+				_, err := PodTemplateKindsFromEnv()
+				Expect(err).To(MatchError(ContainSubstring(message)))
+			},
+			Entry("malformed JSON", `{"kind": "Rollout"}`, "not a JSON list"),
+			Entry("missing kind", `[{"apiVersion": "argoproj.io/v1alpha1", "path": "{.spec.template}"}]`, "has no kind"),
+			Entry("built-in group", `[{"apiVersion": "apps/v1", "kind": "Deployment", "path": "{.spec.template}"}]`, "is built in"),
+			Entry("KubeVirt VM template", `[{"apiVersion": "kubevirt.io/v1", "kind": "VirtualMachine", "path": "{.spec.template}"}]`, "describe virtual machines"),
+			Entry("filter in the path", `[{"apiVersion": "argoproj.io/v1alpha1", "kind": "Rollout", "path": "{.spec.templates[0]}"}]`, "JSONPath of field names"),
+			Entry("metadata path", `[{"apiVersion": "argoproj.io/v1alpha1", "kind": "Rollout", "path": "{.metadata}"}]`, "JSONPath of field names"),
+		)
+	})
+
+	Context("persistent netclient state", func() {
+		pvcAnnotations := map[string]string{"netmaker.io/pvc-name": "netclient-state"}
+
+		It("adds a volumeClaimTemplate to StatefulSets", func() {
+			template := testPodTemplate()
+			template.Annotations = pvcAnnotations
+			statefulSet := &appsv1.StatefulSet{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "StatefulSet"},
+				ObjectMeta: testObjectMeta(),
+				Spec:       appsv1.StatefulSetSpec{ServiceName: "demo", Template: template},
+			}
+
+			resp := newTestWebhook().Handle(context.Background(), newAdmissionRequest("StatefulSet", statefulSet))
+			Expect(resp.Allowed).To(BeTrue())
+
+			claims := findPatch(resp.Patches, "/spec/volumeClaimTemplates")
+			Expect(claims).NotTo(BeNil())
+			Expect(claims.Value).To(ContainElement(HaveKeyWithValue("metadata", HaveKeyWithValue("name", "etc-netclient"))))
+			volumes := findPatch(resp.Patches, "/spec/template/spec/volumes")
+			Expect(patchValueNames(volumes.Value)).To(Equal([]string{"log-netclient"}))
+		})
+
+		It("gives every StatefulSet ordinal its own claim by default", func() {
+			statefulSet := &appsv1.StatefulSet{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "StatefulSet"},
+				ObjectMeta: testObjectMeta(),
+				Spec:       appsv1.StatefulSetSpec{ServiceName: "demo", Template: testPodTemplate()},
+			}
+
+			resp := newTestWebhook().Handle(context.Background(), newAdmissionRequest("StatefulSet", statefulSet))
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(resp.Warnings).To(BeEmpty())
+
+			claims := findPatch(resp.Patches, "/spec/volumeClaimTemplates")
+			Expect(claims).NotTo(BeNil())
+			Expect(claims.Value).To(ContainElement(HaveKeyWithValue("metadata", HaveKeyWithValue("name", "etc-netclient"))))
+		})
+
+		It("keeps ephemeral StatefulSet state in an emptyDir", func() {
+			statefulSet := &appsv1.StatefulSet{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "StatefulSet"},
+				ObjectMeta: testObjectMeta(),
+				Spec:       appsv1.StatefulSetSpec{ServiceName: "demo", Template: ephemeralPodTemplate()},
+			}
+
+			resp := newTestWebhook().Handle(context.Background(), newAdmissionRequest("StatefulSet", statefulSet))
+			Expect(resp.Allowed).To(BeTrue())
+
+			Expect(findPatch(resp.Patches, "/spec/volumeClaimTemplates")).To(BeNil())
+			volumes := findPatch(resp.Patches, "/spec/template/spec/volumes")
+			Expect(patchValueNames(volumes.Value)).To(Equal([]string{"etc-netclient", "log-netclient"}))
+		})
+
+		It("warns when an existing StatefulSet can't get a claim", func() {
+			statefulSet := &appsv1.StatefulSet{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "StatefulSet"},
+				ObjectMeta: testObjectMeta(),
+				Spec:       appsv1.StatefulSetSpec{ServiceName: "demo", Template: testPodTemplate()},
+			}
+			req := newAdmissionRequest("StatefulSet", statefulSet)
+			req.Operation = admissionv1.Update
+
+			resp := newTestWebhook().Handle(context.Background(), req)
+			Expect(resp.Allowed).To(BeTrue())
+
+			Expect(findPatch(resp.Patches, "/spec/volumeClaimTemplates")).To(BeNil())
+			volumes := findPatch(resp.Patches, "/spec/template/spec/volumes")
+			Expect(patchValueNames(volumes.Value)).To(Equal([]string{"etc-netclient", "log-netclient"}))
+			Expect(resp.Warnings).To(ContainElement(ContainSubstring("recreate")))
+		})
+
+		It("rejects an unknown state mode", func() {
+			template := testPodTemplate()
+			template.Annotations = map[string]string{"netmaker.io/netclient-state": "sticky"}
+			statefulSet := &appsv1.StatefulSet{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "StatefulSet"},
+				ObjectMeta: testObjectMeta(),
+				Spec:       appsv1.StatefulSetSpec{ServiceName: "demo", Template: template},
+			}
+
+			resp := newTestWebhook().Handle(context.Background(), newAdmissionRequest("StatefulSet", statefulSet))
+			Expect(resp.Allowed).To(BeFalse())
+			Expect(resp.Result.Code).To(Equal(int32(http.StatusBadRequest)))
+		})
+
+		It("refuses a shared claim for Deployments", func() {
+			template := testPodTemplate()
+			template.Annotations = pvcAnnotations
+			deployment := &appsv1.Deployment{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"},
+				ObjectMeta: testObjectMeta(),
+				Spec:       appsv1.DeploymentSpec{Template: template},
+			}
+
+			resp := newTestWebhook().Handle(context.Background(), newAdmissionRequest("Deployment", deployment))
+
+			Expect(resp.Allowed).To(BeFalse())
+			Expect(resp.Result.Code).To(Equal(int32(http.StatusBadRequest)))
+			Expect(resp.Result.Message).To(ContainSubstring("StatefulSet"))
+		})
+
+		It("leaves PVC creation for pods to the controller", func() {
+			pod := &corev1.Pod{
+				TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "demo",
+					Namespace:   testNamespace,
+					Labels:      testPodTemplate().Labels,
+					Annotations: pvcAnnotations,
+				},
+				Spec: testPodTemplate().Spec,
+			}
+			req := newAdmissionRequest("Pod", pod)
+			dryRun := true
+			req.DryRun = &dryRun
+
+			w := newTestWebhook()
+			resp := w.Handle(context.Background(), req)
+			Expect(resp.Allowed).To(BeTrue())
+
+			Expect(findPatch(resp.Patches, "/metadata/annotations/netmaker.io~1netclient-pvc")).NotTo(BeNil())
+			claims := &corev1.PersistentVolumeClaimList{}
+			Expect(w.client.List(context.Background(), claims)).To(Succeed())
+			Expect(claims.Items).To(BeEmpty())
+		})
+	})
+
+	It("produces patches that apply to objects without pod template metadata", func() {
+		GinkgoT().Setenv("OPERATOR_NAMESPACE", "netmaker")
+		source := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "netclient-token", Namespace: "netmaker"},
+			Data:       map[string][]byte{"token": []byte("shared")},
+		}
+		raw := []byte(`{"apiVersion":"batch/v1","kind":"Job","metadata":{"name":"demo","namespace":"default",` +
+			`"labels":{"netmaker.io/netclient":"enabled","netmaker.io/secret-namespace":"netmaker"}},` +
+			`"spec":{"template":{"spec":{"restartPolicy":"Never","containers":[{"name":"app","image":"busybox"}]}}}}`)
+		req := admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+			UID:       "test",
+			Kind:      metav1.GroupVersionKind{Kind: "Job"},
+			Namespace: testNamespace,
+			Operation: admissionv1.Create,
+			Object:    runtime.RawExtension{Raw: raw},
+		}}
+
+		resp := newTestWebhook(source).Handle(context.Background(), req)
+		Expect(resp.Allowed).To(BeTrue())
+
+		var result batchv1.Job
+		Expect(json.Unmarshal(applyPatches(raw, resp.Patches), &result)).To(Succeed())
+		Expect(result.Spec.Template.Annotations[tokenSourceAnnotation]).To(Equal("netmaker/netclient-token"))
+		Expect(result.Spec.Template.Spec.Containers).To(HaveLen(2))
+	})
+
+	It("appends to existing volumes without touching them", func() {
+		template := testPodTemplate()
+		template.Spec.Volumes = []corev1.Volume{{
+			Name:         "data",
+			VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+		}}
+		deployment := &appsv1.Deployment{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"},
+			ObjectMeta: testObjectMeta(),
+			Spec:       appsv1.DeploymentSpec{Template: template},
+		}
+
+		resp := newTestWebhook().Handle(context.Background(), newAdmissionRequest("Deployment", deployment))
+
+		Expect(resp.Allowed).To(BeTrue())
+		Expect(findPatch(resp.Patches, "/spec/template/spec/volumes/0")).To(BeNil())
+		Expect(findPatch(resp.Patches, "/spec/template/spec/volumes/1")).NotTo(BeNil())
+		Expect(findPatch(resp.Patches, "/spec/template/spec/volumes/2")).NotTo(BeNil())
+	})
+
+	It("does not patch workloads without the netclient label", func() {
+		template := testPodTemplate()
+		delete(template.Labels, "netmaker.io/netclient")
+		deployment := &appsv1.Deployment{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"},
+			ObjectMeta: testObjectMeta(),
+			Spec:       appsv1.DeploymentSpec{Template: template},
+		}
+
+		resp := newTestWebhook().Handle(context.Background(), newAdmissionRequest("Deployment", deployment))
+
+		Expect(resp.Allowed).To(BeTrue())
+		Expect(resp.Patches).To(BeEmpty())
+	})
+
+	It("does not patch pods that already have a netclient container", func() {
+		template := testPodTemplate()
+		template.Spec.Containers = append(template.Spec.Containers, corev1.Container{Name: "netclient", Image: "gravitl/netclient"})
+		pod := &corev1.Pod{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+			ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: testNamespace, Labels: template.Labels},
+			Spec:       template.Spec,
+		}
+
+		resp := newTestWebhook().Handle(context.Background(), newAdmissionRequest("Pod", pod))
+
+		Expect(resp.Allowed).To(BeTrue())
+		Expect(resp.Patches).To(BeEmpty())
+	})
+})
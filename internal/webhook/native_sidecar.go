@@ -0,0 +1,35 @@
+package webhook
+
+import (
+	"strconv"
+
+	utilversion "k8s.io/apimachinery/pkg/util/version"
+	"k8s.io/apimachinery/pkg/version"
+	"k8s.io/klog/v2"
+)
+
+// minNativeSidecarVersion is the first Kubernetes release with SidecarContainers enabled by default
+var minNativeSidecarVersion = utilversion.MajorMinor(1, 29)
+
+// NativeSidecarsSupported reports whether netclient can be injected as a native sidecar on this API server
+// NETCLIENT_NATIVE_SIDECAR=true|false overrides the version check, e.g. when the feature gate was
+// enabled on an older cluster or disabled on a newer one
+func NativeSidecarsSupported(serverVersion *version.Info) bool {
+	if override := getEnvOrDefault("NETCLIENT_NATIVE_SIDECAR", ""); override != "" {
+		enabled, err := strconv.ParseBool(override)
+		if err == nil {
+			return enabled
+		}
+		klog.Warning("Ignoring invalid NETCLIENT_NATIVE_SIDECAR value", "value", override)
+	}
+
+	if serverVersion == nil {
+		return false
+	}
+	parsed, err := utilversion.ParseGeneric(serverVersion.GitVersion)
+	if err != nil {
+		klog.Warning("Failed to parse API server version, using regular netclient sidecars", "version", serverVersion.GitVersion, "error", err)
+		return false
+	}
+	return parsed.AtLeast(minNativeSidecarVersion)
+}
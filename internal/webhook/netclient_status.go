@@ -0,0 +1,93 @@
+package webhook
+
+import (
+	"fmt"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+
+	"github.com/gravitl/netmaker-k8s-ops/internal/controller"
+)
+
+const (
+	// statusPortAnnotation tells the operator which port the sidecar serves its Netmaker status on
+	statusPortAnnotation = controller.NetclientStatusPortAnnotation
+	// connectedConditionType is the pod condition the operator reports the sidecar's connection in
+	connectedConditionType = "netmaker.io/netclient-connected"
+	// statusPortName names the status port on the netclient container
+	statusPortName = "nm-status"
+	// statusAddressEnv holds the pod IP the status server listens on
+	statusAddressEnv = "NETCLIENT_STATUS_ADDRESS"
+)
+
+// netclientStatusPort returns the port injected sidecars serve their status on, 0 when status reporting is off
+// It is set operator-wide with NETCLIENT_STATUS_PORT
+func netclientStatusPort() int32 {
+	value := getEnvOrDefault("NETCLIENT_STATUS_PORT", "")
+	if value == "" {
+		return 0
+	}
+	port, err := strconv.ParseInt(value, 10, 32)
+	if err != nil || port < 1 || port > 65535 {
+		klog.Warning("Ignoring invalid NETCLIENT_STATUS_PORT value", "value", value)
+		return 0
+	}
+	return int32(port)
+}
+
+// netclientReadinessGate reports whether injected pods wait for the operator to see netclient connected
+// The gate needs the status port, otherwise the condition is never reported and the pods never become ready
+func netclientReadinessGate() bool {
+	value := getEnvOrDefault("NETCLIENT_READINESS_GATE", "false")
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		klog.Warning("Ignoring invalid NETCLIENT_READINESS_GATE value", "value", value)
+		return false
+	}
+	return enabled
+}
+
+// addStatusReporting exposes the sidecar's status port and tells the operator where to find it
+// The server itself is part of the netclient start script, see buildStatusServerScript.
+func addStatusReporting(target *podTarget, netclient *corev1.Container, port int32) {
+	netclient.Ports = append(netclient.Ports, corev1.ContainerPort{
+		Name:          statusPortName,
+		ContainerPort: port,
+		Protocol:      corev1.ProtocolTCP,
+	})
+	netclient.Env = append(netclient.Env, corev1.EnvVar{
+		Name:      statusAddressEnv,
+		ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: "status.podIP"}},
+	})
+	// The health controller reads the pods, which only inherit the template annotations
+	target.setAnnotation(statusPortAnnotation, strconv.Itoa(int(port)))
+
+	if !netclientReadinessGate() {
+		return
+	}
+	for _, gate := range target.spec.ReadinessGates {
+		if gate.ConditionType == connectedConditionType {
+			return
+		}
+	}
+	target.spec.ReadinessGates = append(target.spec.ReadinessGates, corev1.PodReadinessGate{ConditionType: connectedConditionType})
+}
+
+// buildStatusServerScript serves the sidecar's Netmaker status as plain key=value lines on port
+// Only the host ID, the netmaker interface addresses and the handshake times are served, without the peer keys.
+// The server listens on the pod IP only, so it isn't reachable through the netmaker interface.
+// busybox nc serves one connection at a time; the document is written when the previous request was answered,
+// and its "now" line lets the operator compute handshake ages as of that moment.
+func buildStatusServerScript(port int32) string {
+	return fmt.Sprintf(`netclient_status() {
+  echo "now=$(date +%%s)"
+  echo "host_id=$(grep -o '"id": *"[^"]*"' /etc/netclient/netclient.json 2>/dev/null | head -n 1 | sed 's/.*"\([^"]*\)"$/\1/')"
+  ip -o -4 addr show netmaker 2>/dev/null | awk '{print "address=" $4}'
+  wg show netmaker latest-handshakes 2>/dev/null | awk '{print "handshake=" $2}'
+}
+while true; do
+  { printf 'HTTP/1.0 200 OK\r\nContent-Type: text/plain\r\n\r\n'; netclient_status; } | nc -l -s "$%s" -p %d >/dev/null 2>&1 || sleep 5
+done &
+`, statusAddressEnv, port)
+}
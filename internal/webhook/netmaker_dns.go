@@ -0,0 +1,223 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// dnsAnnotation opts a workload into Netmaker DNS resolution: "dnsconfig" or "sidecar"
+	dnsAnnotation = "netmaker.io/dns"
+	// dnsNameserverAnnotation overrides the Netmaker DNS resolver address (default NETCLIENT_DNS_NAMESERVER)
+	dnsNameserverAnnotation = "netmaker.io/dns-nameserver"
+	// dnsSearchAnnotation overrides the comma separated Netmaker search domains (default the network name)
+	dnsSearchAnnotation = "netmaker.io/dns-search"
+	// dnsCorefileAnnotation holds the generated resolver config, projected into the resolver container
+	// through the downward API so the webhook doesn't have to create a ConfigMap
+	dnsCorefileAnnotation = "netmaker.io/dns-corefile"
+
+	// dnsModeConfig appends the Netmaker resolver and search domains to the pod dnsConfig
+	dnsModeConfig = "dnsconfig"
+	// dnsModeSidecar runs a local resolver that splits queries between Netmaker and cluster DNS
+	dnsModeSidecar = "sidecar"
+
+	dnsResolverContainerName = "netmaker-dns"
+	dnsResolverVolumeName    = "netmaker-dns-config"
+	dnsResolverConfigPath    = "/etc/coredns"
+)
+
+// applyNetmakerDNS configures the pod to resolve Netmaker host names when the workload opts in
+func (w *NetclientSidecarWebhook) applyNetmakerDNS(target *podTarget, namespace string, networks []string, overrides *netclientOverrides) error {
+	if overrides.DNSMode == "" {
+		return nil
+	}
+
+	nameserver := overrides.DNSNameserver
+	if nameserver == "" {
+		nameserver = getEnvOrDefault("NETCLIENT_DNS_NAMESERVER", "")
+	}
+	searches := overrides.DNSSearch
+	if len(searches) == 0 {
+		// Netmaker names hosts <host>.<network>
+		searches = networks
+	}
+
+	var problems []string
+	if nameserver == "" {
+		problems = append(problems, fmt.Sprintf("%s needs %s or NETCLIENT_DNS_NAMESERVER on the operator", dnsAnnotation, dnsNameserverAnnotation))
+	}
+	if len(searches) == 0 {
+		problems = append(problems, fmt.Sprintf("%s needs %s or a Netmaker network", dnsAnnotation, dnsSearchAnnotation))
+	}
+	if len(problems) > 0 {
+		return &invalidAnnotationsError{problems: problems}
+	}
+
+	if overrides.DNSMode == dnsModeConfig {
+		addDNSConfig(target.spec, []string{nameserver}, searches)
+		// Cluster DNS answers NXDOMAIN for Netmaker names and resolvers don't fall through on NXDOMAIN
+		target.warnings = append(target.warnings, fmt.Sprintf(
+			"%s: %s only resolves Netmaker names when cluster DNS forwards %s to %s (a CoreDNS stub domain), use %s otherwise",
+			dnsAnnotation, dnsModeConfig, strings.Join(searches, ", "), nameserver, dnsModeSidecar))
+		klog.Info("Added Netmaker DNS to pod dnsConfig", "nameserver", nameserver, "search", searches, "namespace", namespace)
+		return nil
+	}
+	return w.addDNSResolverSidecar(target, namespace, nameserver, searches)
+}
+
+// addDNSConfig appends nameservers and search domains to the pod dnsConfig, keeping the DNS policy
+// With ClusterFirst, kubelet lists the Netmaker resolver after cluster DNS, and resolvers only move on to it when
+// cluster DNS doesn't respond, not when it answers NXDOMAIN. Netmaker names only resolve when cluster DNS
+// forwards the Netmaker domain (stub domain); the search domains then let pods use short host names
+func addDNSConfig(podSpec *corev1.PodSpec, nameservers, searches []string) {
+	if podSpec.DNSConfig == nil {
+		podSpec.DNSConfig = &corev1.PodDNSConfig{}
+	}
+	podSpec.DNSConfig.Nameservers = appendMissing(podSpec.DNSConfig.Nameservers, nameservers...)
+	podSpec.DNSConfig.Searches = appendMissing(podSpec.DNSConfig.Searches, searches...)
+}
+
+// addDNSResolverSidecar injects a CoreDNS container listening on 127.0.0.1 and points the pod at it
+// Queries for the Netmaker search domains go to the Netmaker resolver over the WireGuard tunnel, everything
+// else to cluster DNS, so service names keep working and Netmaker names don't depend on resolver fallback
+func (w *NetclientSidecarWebhook) addDNSResolverSidecar(target *podTarget, namespace, nameserver string, searches []string) error {
+	podSpec := target.spec
+	if !w.nativeSidecars && isBatchPodSpec(podSpec) {
+		// A regular resolver container never exits and would keep the Job from completing
+		return &invalidAnnotationsError{problems: []string{fmt.Sprintf(
+			"%s: %s needs native sidecars (Kubernetes 1.29+) for pods that run to completion, "+
+				"use %s with a cluster DNS stub domain for the Netmaker domain",
+			dnsAnnotation, dnsModeSidecar, dnsModeConfig)}}
+	}
+	for _, containers := range [][]corev1.Container{podSpec.InitContainers, podSpec.Containers} {
+		for _, container := range containers {
+			if container.Name == dnsResolverContainerName {
+				return nil
+			}
+		}
+	}
+
+	clusterDNS, err := w.clusterDNSAddress()
+	if err != nil {
+		return err
+	}
+	clusterDomain := getEnvOrDefault("CLUSTER_DOMAIN", "cluster.local")
+
+	target.setAnnotation(dnsCorefileAnnotation, buildCorefile(nameserver, clusterDNS, searches))
+	podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+		Name: dnsResolverVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			DownwardAPI: &corev1.DownwardAPIVolumeSource{
+				Items: []corev1.DownwardAPIVolumeFile{{
+					Path:     "Corefile",
+					FieldRef: &corev1.ObjectFieldSelector{FieldPath: fmt.Sprintf("metadata.annotations['%s']", dnsCorefileAnnotation)},
+				}},
+			},
+		},
+	})
+
+	resolver := corev1.Container{
+		Name:  dnsResolverContainerName,
+		Image: getEnvOrDefault("NETCLIENT_DNS_IMAGE", "coredns/coredns:1.11.3"),
+		Args:  []string{"-conf", dnsResolverConfigPath + "/Corefile"},
+		VolumeMounts: []corev1.VolumeMount{{
+			Name:      dnsResolverVolumeName,
+			MountPath: dnsResolverConfigPath,
+			ReadOnly:  true,
+		}},
+		SecurityContext: &corev1.SecurityContext{
+			Capabilities: &corev1.Capabilities{
+				Add: []corev1.Capability{"NET_BIND_SERVICE"},
+			},
+		},
+		Resources: corev1.ResourceRequirements{
+			Limits: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("100m"),
+				corev1.ResourceMemory: resource.MustParse("64Mi"),
+			},
+			Requests: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("10m"),
+				corev1.ResourceMemory: resource.MustParse("16Mi"),
+			},
+		},
+	}
+	if w.nativeSidecars {
+		// Start right after netclient so init containers can resolve Netmaker names too
+		restartPolicy := corev1.ContainerRestartPolicyAlways
+		resolver.RestartPolicy = &restartPolicy
+		index := 0
+		for i, container := range podSpec.InitContainers {
+			if container.Name == "netclient" {
+				index = i + 1
+			}
+		}
+		podSpec.InitContainers = append(podSpec.InitContainers[:index], append([]corev1.Container{resolver}, podSpec.InitContainers[index:]...)...)
+	} else {
+		podSpec.Containers = append(podSpec.Containers, resolver)
+	}
+
+	// The local resolver replaces the cluster resolver, so recreate the cluster search path kubelet would add
+	podSpec.DNSPolicy = corev1.DNSNone
+	ndots := "5"
+	podSpec.DNSConfig = &corev1.PodDNSConfig{
+		Nameservers: []string{"127.0.0.1"},
+		Searches: appendMissing([]string{
+			fmt.Sprintf("%s.svc.%s", namespace, clusterDomain),
+			"svc." + clusterDomain,
+			clusterDomain,
+		}, searches...),
+		Options: []corev1.PodDNSConfigOption{{Name: "ndots", Value: &ndots}},
+	}
+	klog.Info("Added Netmaker DNS resolver sidecar", "nameserver", nameserver, "clusterDNS", clusterDNS, "search", searches, "namespace", namespace)
+	return nil
+}
+
+// clusterDNSAddress returns the cluster DNS Service IP the resolver forwards non-Netmaker names to
+// NETCLIENT_CLUSTER_DNS overrides the lookup of the kube-system/kube-dns Service
+func (w *NetclientSidecarWebhook) clusterDNSAddress() (string, error) {
+	if address := getEnvOrDefault("NETCLIENT_CLUSTER_DNS", ""); address != "" {
+		return address, nil
+	}
+	if w.client == nil {
+		return "", fmt.Errorf("cluster DNS address unknown, set NETCLIENT_CLUSTER_DNS")
+	}
+	service := &corev1.Service{}
+	if err := w.client.Get(context.Background(), types.NamespacedName{Name: "kube-dns", Namespace: "kube-system"}, service); err != nil {
+		return "", fmt.Errorf("failed to look up cluster DNS, set NETCLIENT_CLUSTER_DNS: %w", err)
+	}
+	if service.Spec.ClusterIP == "" || service.Spec.ClusterIP == corev1.ClusterIPNone {
+		return "", fmt.Errorf("kube-system/kube-dns has no cluster IP, set NETCLIENT_CLUSTER_DNS")
+	}
+	return service.Spec.ClusterIP, nil
+}
+
+// buildCorefile creates the CoreDNS config for the resolver sidecar
+func buildCorefile(nameserver, clusterDNS string, searches []string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s {\n  bind 127.0.0.1\n  forward . %s\n  cache 30\n}\n", strings.Join(searches, " "), nameserver)
+	fmt.Fprintf(&b, ". {\n  bind 127.0.0.1\n  forward . %s\n  cache 30\n}\n", clusterDNS)
+	return b.String()
+}
+
+// appendMissing appends the values that aren't in list yet
+func appendMissing(list []string, values ...string) []string {
+	for _, value := range values {
+		found := false
+		for _, existing := range list {
+			if existing == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, value)
+		}
+	}
+	return list
+}
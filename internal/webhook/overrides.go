@@ -0,0 +1,308 @@
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/gravitl/netmaker-k8s-ops/internal/controller"
+)
+
+const (
+	// netclientImageAnnotation overrides the injected netclient image
+	netclientImageAnnotation = "netmaker.io/netclient-image"
+	// networkAnnotation overrides the Netmaker network netclient joins
+	networkAnnotation = "netmaker.io/network"
+	// serverAnnotation overrides the Netmaker server netclient connects to
+	serverAnnotation = "netmaker.io/server"
+	// logLevelAnnotation overrides the netclient log level
+	logLevelAnnotation = "netmaker.io/log-level"
+	// netclientResourcesAnnotation overrides the netclient resources, as JSON ResourceRequirements
+	netclientResourcesAnnotation = "netmaker.io/netclient-resources"
+	// netclientReadinessProbeAnnotation overrides the netclient readiness probe, as a JSON Probe
+	netclientReadinessProbeAnnotation = "netmaker.io/netclient-readiness-probe"
+	// netclientStateAnnotation selects where StatefulSet pods keep their netclient state:
+	// "persistent" (default, one claim per ordinal) or "ephemeral" (emptyDir, a new host on every restart)
+	netclientStateAnnotation = "netmaker.io/netclient-state"
+	netclientStatePersistent = "persistent"
+	netclientStateEphemeral  = "ephemeral"
+	// staticIPAnnotation requests a fixed Netmaker address, assigned by the static IP controller after enrollment
+	staticIPAnnotation = "netmaker.io/static-ip"
+)
+
+var (
+	// imagePattern is a loose image reference check: no whitespace, optional registry, tag and digest
+	imagePattern = regexp.MustCompile(`^[a-z0-9]+([._/:@-][a-zA-Z0-9_.-]+)*$`)
+	// networkPattern matches Netmaker network names
+	networkPattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,32}$`)
+	// serverPattern matches a Netmaker server host, optionally with a port
+	serverPattern = regexp.MustCompile(`^[a-zA-Z0-9.-]+(:[0-9]{1,5})?$`)
+
+	validLogLevels = []string{"debug", "info", "warn", "error"}
+)
+
+// netclientOverrides holds the per-workload netclient settings from annotations
+// Empty fields keep the operator-wide defaults
+type netclientOverrides struct {
+	Image     string
+	Network   string
+	Server    string
+	LogLevel  string
+	Resources *corev1.ResourceRequirements
+	// ReadinessProbe replaces the probe handler and timings it sets, see applyReadinessProbeOverride
+	ReadinessProbe *corev1.Probe
+	// DNSMode, DNSNameserver and DNSSearch configure Netmaker DNS resolution, see netmaker_dns.go
+	DNSMode       string
+	DNSNameserver string
+	DNSSearch     []string
+	// WaitForNetwork, WaitPeer and WaitTimeout hold app containers until netclient joined, see wait_for_network.go
+	WaitForNetwork bool
+	WaitPeer       string
+	WaitTimeout    time.Duration
+	// Networks are all the networks the sidecar joins, primary first, see multi_network.go
+	Networks []networkMembership
+	// StaticIPs are the Netmaker addresses the static IP controller assigns after enrollment, one per StatefulSet ordinal
+	StaticIPs []net.IP
+}
+
+// invalidAnnotationsError reports malformed netclient annotations; the workload is rejected with a 400
+type invalidAnnotationsError struct {
+	problems []string
+}
+
+func (e *invalidAnnotationsError) Error() string {
+	return fmt.Sprintf("invalid netclient annotations: %s", strings.Join(e.problems, "; "))
+}
+
+// parseNetclientOverrides reads and validates the netclient override annotations
+func parseNetclientOverrides(annotations map[string]string) (*netclientOverrides, error) {
+	overrides := &netclientOverrides{}
+	var problems []string
+
+	if value, ok := annotations[netclientImageAnnotation]; ok {
+		if !imagePattern.MatchString(value) {
+			problems = append(problems, fmt.Sprintf("%s %q is not a valid image reference", netclientImageAnnotation, value))
+		}
+		overrides.Image = value
+	}
+	if value, ok := annotations[networkAnnotation]; ok {
+		if !networkPattern.MatchString(value) {
+			problems = append(problems, fmt.Sprintf("%s %q must be 1-32 letters, digits, '-' or '_'", networkAnnotation, value))
+		}
+		overrides.Network = value
+	}
+	if value, ok := annotations[networksAnnotation]; ok {
+		memberships, networkProblems := parseNetworkMemberships(value)
+		problems = append(problems, networkProblems...)
+		if _, single := annotations[networkAnnotation]; single {
+			problems = append(problems, fmt.Sprintf("set only one of %s and %s", networkAnnotation, networksAnnotation))
+		}
+		overrides.Networks = memberships
+	}
+	if value, ok := annotations[serverAnnotation]; ok {
+		if !serverPattern.MatchString(value) {
+			problems = append(problems, fmt.Sprintf("%s %q must be a host name with an optional port", serverAnnotation, value))
+		}
+		overrides.Server = value
+	}
+	if value, ok := annotations[logLevelAnnotation]; ok {
+		level := strings.ToLower(value)
+		valid := false
+		for _, l := range validLogLevels {
+			if level == l {
+				valid = true
+			}
+		}
+		if !valid {
+			problems = append(problems, fmt.Sprintf("%s %q must be one of %s", logLevelAnnotation, value, strings.Join(validLogLevels, ", ")))
+		}
+		overrides.LogLevel = level
+	}
+	if value, ok := annotations[netclientStateAnnotation]; ok && value != netclientStatePersistent && value != netclientStateEphemeral {
+		problems = append(problems, fmt.Sprintf("%s %q must be %s or %s", netclientStateAnnotation, value, netclientStatePersistent, netclientStateEphemeral))
+	}
+	if value, ok := annotations[dnsAnnotation]; ok {
+		mode := strings.ToLower(value)
+		if mode != dnsModeConfig && mode != dnsModeSidecar {
+			problems = append(problems, fmt.Sprintf("%s %q must be %s or %s", dnsAnnotation, value, dnsModeConfig, dnsModeSidecar))
+		}
+		overrides.DNSMode = mode
+	}
+	if value, ok := annotations[dnsNameserverAnnotation]; ok {
+		if net.ParseIP(value) == nil {
+			problems = append(problems, fmt.Sprintf("%s %q must be an IP address", dnsNameserverAnnotation, value))
+		}
+		overrides.DNSNameserver = value
+	}
+	if value, ok := annotations[dnsSearchAnnotation]; ok {
+		for _, domain := range strings.Split(value, ",") {
+			domain = strings.TrimSpace(domain)
+			if errs := validation.IsDNS1123Subdomain(domain); len(errs) > 0 {
+				problems = append(problems, fmt.Sprintf("%s domain %q is invalid: %s", dnsSearchAnnotation, domain, strings.Join(errs, ", ")))
+				continue
+			}
+			overrides.DNSSearch = append(overrides.DNSSearch, domain)
+		}
+	}
+	if value, ok := annotations[waitForNetworkAnnotation]; ok {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s %q must be true or false", waitForNetworkAnnotation, value))
+		}
+		overrides.WaitForNetwork = enabled
+	}
+	if value, ok := annotations[waitPeerAnnotation]; ok {
+		if net.ParseIP(value) == nil && len(validation.IsDNS1123Subdomain(value)) > 0 {
+			problems = append(problems, fmt.Sprintf("%s %q must be an IP address or host name", waitPeerAnnotation, value))
+		}
+		overrides.WaitPeer = value
+	}
+	if value, ok := annotations[waitTimeoutAnnotation]; ok {
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout < time.Second || timeout > maxWaitTimeout {
+			problems = append(problems, fmt.Sprintf("%s %q must be a duration between 1s and %s", waitTimeoutAnnotation, value, maxWaitTimeout))
+		}
+		overrides.WaitTimeout = timeout
+	}
+	if value, ok := annotations[staticIPAnnotation]; ok {
+		addresses, err := controller.ParseStaticIPs(value)
+		if err != nil {
+			problems = append(problems, err.Error())
+		}
+		overrides.StaticIPs = addresses
+	}
+	if value, ok := annotations[netclientResourcesAnnotation]; ok {
+		resources := &corev1.ResourceRequirements{}
+		decoder := json.NewDecoder(strings.NewReader(value))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(resources); err != nil {
+			problems = append(problems, fmt.Sprintf(`%s must be JSON like {"limits":{"memory":"256Mi"},"requests":{"cpu":"100m"}}: %v`,
+				netclientResourcesAnnotation, err))
+		} else {
+			overrides.Resources = resources
+		}
+	}
+	if value, ok := annotations[netclientReadinessProbeAnnotation]; ok {
+		probe := &corev1.Probe{}
+		decoder := json.NewDecoder(strings.NewReader(value))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(probe); err != nil {
+			problems = append(problems, fmt.Sprintf(`%s must be JSON like {"periodSeconds":10,"failureThreshold":30}: %v`,
+				netclientReadinessProbeAnnotation, err))
+		} else if probe.InitialDelaySeconds < 0 || probe.PeriodSeconds < 0 || probe.TimeoutSeconds < 0 ||
+			probe.SuccessThreshold < 0 || probe.FailureThreshold < 0 {
+			problems = append(problems, fmt.Sprintf("%s timings must not be negative", netclientReadinessProbeAnnotation))
+		} else {
+			overrides.ReadinessProbe = probe
+		}
+	}
+
+	if len(problems) > 0 {
+		return nil, &invalidAnnotationsError{problems: problems}
+	}
+	return overrides, nil
+}
+
+// applyResourceOverrides merges override into the default resources and checks requests don't exceed limits
+// A limit set below the default request lowers the request to the limit; only an explicit request above its
+// limit is rejected
+func applyResourceOverrides(resources *corev1.ResourceRequirements, override *corev1.ResourceRequirements) error {
+	if override == nil {
+		return nil
+	}
+	for name, quantity := range override.Limits {
+		resources.Limits[name] = quantity
+	}
+	for name, quantity := range override.Requests {
+		resources.Requests[name] = quantity
+	}
+	for name, request := range resources.Requests {
+		limit, ok := resources.Limits[name]
+		if !ok || request.Cmp(limit) <= 0 {
+			continue
+		}
+		if _, requested := override.Requests[name]; !requested {
+			resources.Requests[name] = limit
+			continue
+		}
+		return &invalidAnnotationsError{problems: []string{
+			fmt.Sprintf("%s: %s request %s exceeds limit %s", netclientResourcesAnnotation, name, request.String(), limit.String()),
+		}}
+	}
+	return nil
+}
+
+// applyReadinessProbeOverride merges override into the default netclient readiness probe
+// A handler in the override replaces the default check, timings that are set replace the default timings
+func applyReadinessProbeOverride(probe *corev1.Probe, override *corev1.Probe) {
+	if override == nil {
+		return
+	}
+	if override.Exec != nil || override.HTTPGet != nil || override.TCPSocket != nil || override.GRPC != nil {
+		probe.ProbeHandler = override.ProbeHandler
+	}
+	if override.InitialDelaySeconds > 0 {
+		probe.InitialDelaySeconds = override.InitialDelaySeconds
+	}
+	if override.PeriodSeconds > 0 {
+		probe.PeriodSeconds = override.PeriodSeconds
+	}
+	if override.TimeoutSeconds > 0 {
+		probe.TimeoutSeconds = override.TimeoutSeconds
+	}
+	if override.SuccessThreshold > 0 {
+		probe.SuccessThreshold = override.SuccessThreshold
+	}
+	if override.FailureThreshold > 0 {
+		probe.FailureThreshold = override.FailureThreshold
+	}
+}
+
+// checkStaticIPTarget checks that every pod of the workload can hold its own static IP
+// An address belongs to one Netmaker host, so only single pods and StatefulSet ordinals can reserve one
+func checkStaticIPTarget(target *podTarget, annotations map[string]string, overrides *netclientOverrides) error {
+	if len(overrides.StaticIPs) == 0 {
+		return nil
+	}
+	switch target.kind {
+	case "StatefulSet":
+		if annotations[netclientStateAnnotation] == netclientStateEphemeral {
+			target.warnings = append(target.warnings, fmt.Sprintf("%s with ephemeral netclient state: every restart enrolls a new host, "+
+				"and the address stays taken until the old host is removed from Netmaker", staticIPAnnotation))
+		}
+		return nil
+	case "Pod":
+		if len(overrides.StaticIPs) == 1 {
+			return nil
+		}
+		if owner := metav1.GetControllerOf(target.meta); owner != nil && owner.Kind == "StatefulSet" {
+			// The static IP controller picks the address of the pod's ordinal
+			return nil
+		}
+		return &invalidAnnotationsError{problems: []string{fmt.Sprintf("%s on a Pod takes one address", staticIPAnnotation)}}
+	default:
+		return &invalidAnnotationsError{problems: []string{fmt.Sprintf(
+			"%s can't be shared by the pods of a %s; use a StatefulSet with one address per ordinal", staticIPAnnotation, target.kind)}}
+	}
+}
+
+// injectionErrorResponse turns an injection error into an admission response
+// Malformed annotations are the user's fault and rejected with 400, anything else is a server error
+func injectionErrorResponse(err error) admission.Response {
+	var invalid *invalidAnnotationsError
+	if errors.As(err, &invalid) {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	return admission.Errored(http.StatusInternalServerError, err)
+}
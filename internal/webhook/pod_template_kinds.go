@@ -0,0 +1,233 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/gravitl/netmaker-k8s-ops/internal/controller"
+)
+
+// PodTemplateKind is a resource kind with a pod template the webhook injects netclient into, such as an Argo
+// Rollout or a Knative Service. Kinds are configured operator-wide with NETCLIENT_POD_TEMPLATE_KINDS.
+type PodTemplateKind struct {
+	// APIVersion is the group and version of the kind, e.g. argoproj.io/v1alpha1
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	// Path is the JSONPath of the pod template in the object, e.g. {.spec.template}
+	Path string `json:"path"`
+
+	groupVersion schema.GroupVersion
+	fields       []string
+}
+
+// builtinGroups hold the kinds the webhook handles without configuration
+var builtinGroups = map[string]bool{"": true, "apps": true, "batch": true}
+
+// vmGroups hold kinds whose templates describe virtual machines, not pods; their launcher pods are labeled instead
+var vmGroups = map[string]bool{"kubevirt.io": true, "pool.kubevirt.io": true}
+
+// PodTemplateKindsFromEnv reads the kinds listed in NETCLIENT_POD_TEMPLATE_KINDS, a JSON list of
+// {"apiVersion", "kind", "path"} objects
+func PodTemplateKindsFromEnv() ([]PodTemplateKind, error) {
+	value := getEnvOrDefault("NETCLIENT_POD_TEMPLATE_KINDS", "")
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+	var kinds []PodTemplateKind
+	if err := json.Unmarshal([]byte(value), &kinds); err != nil {
+		return nil, fmt.Errorf("NETCLIENT_POD_TEMPLATE_KINDS is not a JSON list of pod template kinds: %w", err)
+	}
+	for i := range kinds {
+		if err := kinds[i].parse(); err != nil {
+			return nil, fmt.Errorf("NETCLIENT_POD_TEMPLATE_KINDS: %w", err)
+		}
+	}
+	return kinds, nil
+}
+
+// parse checks the kind and resolves its API version and template path
+func (k *PodTemplateKind) parse() error {
+	if k.Kind == "" {
+		return fmt.Errorf("pod template kind %s has no kind", k.APIVersion)
+	}
+	groupVersion, err := schema.ParseGroupVersion(k.APIVersion)
+	if err != nil || groupVersion.Version == "" {
+		return fmt.Errorf("%s has an invalid apiVersion %q", k.Kind, k.APIVersion)
+	}
+	if builtinGroups[groupVersion.Group] {
+		return fmt.Errorf("%s %s is built in, only list kinds outside the core, apps and batch groups", k.APIVersion, k.Kind)
+	}
+	if vmGroups[groupVersion.Group] {
+		return fmt.Errorf("%s %s templates describe virtual machines, not pods; put the netmaker.io/netclient label in the VM template instead", k.APIVersion, k.Kind)
+	}
+	fields, err := parseTemplatePath(k.Path)
+	if err != nil {
+		return fmt.Errorf("%s: %w", k.Kind, err)
+	}
+	k.groupVersion = groupVersion
+	k.fields = fields
+	return nil
+}
+
+// parseTemplatePath splits a JSONPath of field names like {.spec.template} into its fields
+// Filters, wildcards and array indices are not supported, a template path always names a single object
+func parseTemplatePath(path string) ([]string, error) {
+	trimmed := strings.TrimSpace(path)
+	trimmed = strings.TrimSuffix(strings.TrimPrefix(trimmed, "{"), "}")
+	trimmed = strings.TrimPrefix(trimmed, "$")
+	invalid := fmt.Errorf("path %q must be a JSONPath of field names, like {.spec.template}", path)
+	if !strings.HasPrefix(trimmed, ".") {
+		return nil, invalid
+	}
+	fields := strings.Split(trimmed[1:], ".")
+	for _, field := range fields {
+		if field == "" || strings.ContainsAny(field, "[]*@?()'\" ") {
+			return nil, invalid
+		}
+	}
+	if fields[0] == "metadata" {
+		return nil, invalid
+	}
+	return fields, nil
+}
+
+// PodTemplateOwners returns the kinds for the cleanup controller, which follows pods to their templates
+func PodTemplateOwners(kinds []PodTemplateKind) []controller.PodTemplateOwner {
+	owners := make([]controller.PodTemplateOwner, 0, len(kinds))
+	for _, kind := range kinds {
+		owners = append(owners, controller.PodTemplateOwner{
+			GroupVersionKind: kind.groupVersion.WithKind(kind.Kind),
+			Fields:           kind.fields,
+		})
+	}
+	return owners
+}
+
+// SetPodTemplateKinds makes the webhook inject into the pod templates of kinds, see PodTemplateKindsFromEnv
+func (w *NetclientSidecarWebhook) SetPodTemplateKinds(kinds []PodTemplateKind) {
+	w.podTemplateKinds = kinds
+}
+
+// podTemplateKindFor returns the configured kind of an admission request, nil if the kind isn't configured
+func (w *NetclientSidecarWebhook) podTemplateKindFor(gvk metav1.GroupVersionKind) *PodTemplateKind {
+	for i := range w.podTemplateKinds {
+		kind := &w.podTemplateKinds[i]
+		if kind.Kind == gvk.Kind && kind.groupVersion.Group == gvk.Group && kind.groupVersion.Version == gvk.Version {
+			return kind
+		}
+	}
+	return nil
+}
+
+// podTemplateObject is an admitted object of a configured kind with its metadata and pod template decoded
+// It encodes back to the original object with the decoded parts replaced, so fields the webhook doesn't
+// know about are kept
+type podTemplateObject struct {
+	metav1.ObjectMeta
+	template corev1.PodTemplateSpec
+	fields   []string
+	object   map[string]interface{}
+}
+
+// decodePodTemplateObject decodes the object of an admission request, nil if it has no pod template at fields
+func decodePodTemplateObject(raw []byte, fields []string) (*podTemplateObject, error) {
+	object := map[string]interface{}{}
+	if err := json.Unmarshal(raw, &object); err != nil {
+		return nil, err
+	}
+	value, found, err := unstructured.NestedFieldNoCopy(object, fields...)
+	if err != nil || !found || value == nil {
+		return nil, err
+	}
+	templateMap, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf(".%s is not a pod template", strings.Join(fields, "."))
+	}
+
+	decoded := &podTemplateObject{fields: fields, object: object}
+	if metadata, ok := object["metadata"].(map[string]interface{}); ok {
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(metadata, &decoded.ObjectMeta); err != nil {
+			return nil, fmt.Errorf("invalid metadata: %w", err)
+		}
+	}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(templateMap, &decoded.template); err != nil {
+		return nil, fmt.Errorf(".%s is not a pod template: %w", strings.Join(fields, "."), err)
+	}
+	return decoded, nil
+}
+
+// deepCopy returns a copy of o that can be changed without changing o
+func (o *podTemplateObject) deepCopy() *podTemplateObject {
+	return &podTemplateObject{
+		ObjectMeta: *o.ObjectMeta.DeepCopy(),
+		template:   *o.template.DeepCopy(),
+		fields:     o.fields,
+		object:     o.object,
+	}
+}
+
+// MarshalJSON encodes the original object with the decoded metadata and pod template
+func (o *podTemplateObject) MarshalJSON() ([]byte, error) {
+	object := runtime.DeepCopyJSON(o.object)
+	metadata, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&o.ObjectMeta)
+	if err != nil {
+		return nil, err
+	}
+	template, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&o.template)
+	if err != nil {
+		return nil, err
+	}
+	object["metadata"] = metadata
+	if err := unstructured.SetNestedMap(object, template, o.fields...); err != nil {
+		return nil, err
+	}
+	return json.Marshal(object)
+}
+
+// handlePodTemplateKind handles webhook requests for a configured pod template kind
+func (w *NetclientSidecarWebhook) handlePodTemplateKind(ctx context.Context, req admission.Request, kind *PodTemplateKind) admission.Response {
+	object, err := decodePodTemplateObject(req.Object.Raw, kind.fields)
+	if err != nil {
+		return admission.Errored(http.StatusBadRequest, fmt.Errorf("failed to decode %s: %w", kind.Kind, err))
+	}
+	if object == nil {
+		return admission.Allowed(fmt.Sprintf("%s has no pod template at %s", kind.Kind, kind.Path))
+	}
+	template := &object.template
+
+	// Check if injection is enabled for the object
+	if inject, reason := w.shouldInject(ctx, req.Namespace, mergeAnnotations(object.Annotations, template.Annotations), object.Labels, template.Labels); !inject {
+		// Remove a sidecar injected before the object dropped the label
+		modified := object.deepCopy()
+		return uninjectResponse(req, reason, object, modified, &modified.template)
+	}
+
+	// Check if netclient sidecar already exists
+	if hasNetclientSidecar(&template.Spec) {
+		return admission.Allowed("netclient sidecar already exists")
+	}
+
+	// Add netclient sidecar to pod template
+	modified := object.deepCopy()
+	// Merge annotations: pod template annotations take priority over the object annotations
+	mergedAnnotations := mergeAnnotations(object.Annotations, template.Annotations)
+	mergedLabels := mergeLabels(object.Labels, template.Labels)
+	target := newPodTarget(kind.Kind, &modified.ObjectMeta, &modified.template)
+	if err := w.addNetclientSidecarToPodTemplate(target, mergedLabels, mergedAnnotations, req.Namespace); err != nil {
+		return injectionErrorResponse(err)
+	}
+
+	resp := patchResponse("netclient sidecar added to "+strings.ToLower(kind.Kind), req.Object.Raw, object, modified)
+	resp.Warnings = append(resp.Warnings, target.warnings...)
+	return resp
+}
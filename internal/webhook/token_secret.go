@@ -0,0 +1,128 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/gravitl/netmaker-k8s-ops/internal/controller"
+)
+
+const (
+	// tokenSourceAnnotation tells the controller to create the token secret the injected netclient references
+	// The value is "<namespace>/<name>" of the secret to mirror, or tokenSourceEnv to use the operator's token
+	tokenSourceAnnotation = controller.TokenSourceAnnotation
+	// tokenSourceEnv marks token secrets filled from the operator's NETCLIENT_TOKEN
+	tokenSourceEnv = "NETCLIENT_TOKEN"
+	// netclientPVCAnnotation tells the controller to create the claim a pod's netclient state lives on
+	netclientPVCAnnotation = controller.NetclientPVCAnnotation
+	// webhookManagedBy is the managed-by label value for objects created for injected sidecars
+	webhookManagedBy = "netmaker-k8s-ops-webhook"
+)
+
+// tokenSecretRef returns the secret key the injected netclient reads its token from
+// Pods can only reference secrets in their own namespace, so a token secret that lives elsewhere
+// (netmaker.io/secret-namespace) is referenced through a mirror in the pod namespace. When no secret
+// exists, the operator's NETCLIENT_TOKEN is stored in one instead of being written into the pod spec.
+// The returned source is non-empty when the controller has to create that secret.
+func (w *NetclientSidecarWebhook) tokenSecretRef(pod *corev1.Pod) (*corev1.SecretKeySelector, string, error) {
+	secretName := w.getSecretNameFromPod(pod)
+	secretKey := w.getSecretKeyFromPod(pod)
+	secretNamespace := w.getSecretNamespaceFromPod(pod)
+
+	ref := &corev1.SecretKeySelector{
+		LocalObjectReference: corev1.LocalObjectReference{Name: secretName},
+		Key:                  secretKey,
+	}
+	if secretNamespace != pod.Namespace {
+		// The controller only copies the configured token secret from the operator namespace, so anyone
+		// able to create a pod can't use the mirror to read other secrets
+		if err := checkMirroredTokenSecret(secretName, secretKey, secretNamespace); err != nil {
+			return nil, "", err
+		}
+		ref.Name = mirroredSecretName(secretName, secretNamespace)
+	}
+	if w.client == nil {
+		// Nothing can be verified; reference the secret and let the pod wait for it
+		return ref, "", nil
+	}
+
+	// Only the key is checked, the token itself is never read here
+	secret := &corev1.Secret{}
+	err := w.client.Get(context.Background(), types.NamespacedName{Name: secretName, Namespace: secretNamespace}, secret)
+	switch {
+	case client.IgnoreNotFound(err) != nil:
+		return nil, "", fmt.Errorf("failed to read token secret %s/%s: %w", secretNamespace, secretName, err)
+	case err == nil && len(secret.Data[secretKey]) == 0:
+		return nil, "", fmt.Errorf("token secret %s/%s has no key %s", secretNamespace, secretName, secretKey)
+	case err == nil && secretNamespace == pod.Namespace:
+		return ref, "", nil
+	case err == nil:
+		return ref, fmt.Sprintf("%s/%s", secretNamespace, secretName), nil
+	}
+	// Fallback to environment variable
+	if getEnvOrDefault("NETCLIENT_TOKEN", "") == "" {
+		return nil, "", fmt.Errorf("token not found in secret %s/%s key %s or NETCLIENT_TOKEN", secretNamespace, secretName, secretKey)
+	}
+	return ref, tokenSourceEnv, nil
+}
+
+// checkMirroredTokenSecret checks that a token secret from another namespace is the configured one in the operator namespace
+func checkMirroredTokenSecret(secretName, secretKey, secretNamespace string) error {
+	configuredName := getEnvOrDefault("NETCLIENT_SECRET_NAME", "netclient-token")
+	configuredKey := getEnvOrDefault("NETCLIENT_SECRET_KEY", "token")
+	operatorNamespace := getEnvOrDefault("OPERATOR_NAMESPACE", "netmaker-k8s-ops-system")
+
+	var problems []string
+	if secretNamespace != operatorNamespace {
+		problems = append(problems, fmt.Sprintf("%s must be the pod namespace or the operator namespace %s", secretNamespaceLabel, operatorNamespace))
+	}
+	if secretName != configuredName {
+		problems = append(problems, fmt.Sprintf("only the token secret %s can be read from namespace %s", configuredName, secretNamespace))
+	}
+	if secretKey != configuredKey {
+		problems = append(problems, fmt.Sprintf("only the key %s can be read from namespace %s", configuredKey, secretNamespace))
+	}
+	if len(problems) > 0 {
+		return &invalidAnnotationsError{problems: problems}
+	}
+	return nil
+}
+
+// checkNetworkTokens checks that the token secret of every network listed in netmaker.io/networks exists
+// They are referenced from the pod namespace as they are; there is no NETCLIENT_TOKEN fallback per network
+func (w *NetclientSidecarWebhook) checkNetworkTokens(namespace string, memberships []networkMembership) error {
+	if w.client == nil {
+		return nil
+	}
+	var problems []string
+	for _, membership := range memberships {
+		secret := &corev1.Secret{}
+		err := w.client.Get(context.Background(), types.NamespacedName{Name: membership.SecretName, Namespace: namespace}, secret)
+		switch {
+		case client.IgnoreNotFound(err) != nil:
+			return fmt.Errorf("failed to read token secret %s/%s: %w", namespace, membership.SecretName, err)
+		case err != nil:
+			problems = append(problems, fmt.Sprintf("token secret %s/%s for network %s not found", namespace, membership.SecretName, membership.Network))
+		case len(secret.Data[membership.SecretKey]) == 0:
+			problems = append(problems, fmt.Sprintf("token secret %s/%s for network %s has no key %s",
+				namespace, membership.SecretName, membership.Network, membership.SecretKey))
+		}
+	}
+	if len(problems) > 0 {
+		return &invalidAnnotationsError{problems: problems}
+	}
+	return nil
+}
+
+// mirroredSecretName returns the name of the copy of a token secret from another namespace
+func mirroredSecretName(secretName, secretNamespace string) string {
+	name := fmt.Sprintf("%s-%s", secretName, secretNamespace)
+	if len(name) > 253 {
+		name = name[:253]
+	}
+	return name
+}
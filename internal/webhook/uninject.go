@@ -0,0 +1,294 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/gravitl/netmaker-k8s-ops/internal/controller"
+)
+
+const (
+	// injectedResourcesAnnotation records on a pod template what injection added, so it can be removed again
+	injectedResourcesAnnotation = controller.NetclientInjectedResourcesAnnotation
+)
+
+// injectedResources is everything injection added to or changed in a pod template
+// Containers, volumes, env vars, mounts and annotations are recorded by name; changed commands and DNS
+// settings keep their original values
+type injectedResources struct {
+	Containers     []string            `json:"containers,omitempty"`
+	InitContainers []string            `json:"initContainers,omitempty"`
+	Volumes        []string            `json:"volumes,omitempty"`
+	Env            map[string][]string `json:"env,omitempty"`
+	VolumeMounts   map[string][]string `json:"volumeMounts,omitempty"`
+	Commands       map[string][]string `json:"commands,omitempty"`
+	Annotations    []string            `json:"annotations,omitempty"`
+	ReadinessGates []string            `json:"readinessGates,omitempty"`
+	DNS            *originalDNS        `json:"dns,omitempty"`
+}
+
+// originalDNS is the DNS setup of a pod template before injection changed it
+type originalDNS struct {
+	Policy corev1.DNSPolicy     `json:"policy,omitempty"`
+	Config *corev1.PodDNSConfig `json:"config,omitempty"`
+}
+
+// recordInjectedResources compares the injected pod template with its state before injection and
+// stores the difference in the netmaker.io/netclient-injected-resources annotation
+func recordInjectedResources(target *podTarget, before *corev1.PodTemplateSpec) error {
+	injected := injectedResources{
+		Containers:     addedContainers(before.Spec.Containers, target.spec.Containers),
+		InitContainers: addedContainers(before.Spec.InitContainers, target.spec.InitContainers),
+	}
+	for _, volume := range target.spec.Volumes {
+		if !hasVolume(before.Spec.Volumes, volume.Name) {
+			injected.Volumes = append(injected.Volumes, volume.Name)
+		}
+	}
+	for _, containers := range [][]corev1.Container{before.Spec.InitContainers, before.Spec.Containers} {
+		for _, original := range containers {
+			injected.recordContainerChanges(&original, findContainer(target.spec, original.Name))
+		}
+	}
+	for key := range target.meta.Annotations {
+		if _, ok := before.Annotations[key]; !ok {
+			injected.Annotations = append(injected.Annotations, key)
+		}
+	}
+	sort.Strings(injected.Annotations)
+	for _, gate := range target.spec.ReadinessGates {
+		if !hasReadinessGate(before.Spec.ReadinessGates, gate.ConditionType) {
+			injected.ReadinessGates = append(injected.ReadinessGates, string(gate.ConditionType))
+		}
+	}
+	if before.Spec.DNSPolicy != target.spec.DNSPolicy || !reflect.DeepEqual(before.Spec.DNSConfig, target.spec.DNSConfig) {
+		injected.DNS = &originalDNS{Policy: before.Spec.DNSPolicy, Config: before.Spec.DNSConfig}
+	}
+
+	data, err := json.Marshal(injected)
+	if err != nil {
+		return fmt.Errorf("failed to record injected resources: %w", err)
+	}
+	target.setAnnotation(injectedResourcesAnnotation, string(data))
+	return nil
+}
+
+// recordContainerChanges records the env vars and mounts injection added to an app container, and its
+// original command if injection wrapped it
+func (r *injectedResources) recordContainerChanges(original, injected *corev1.Container) {
+	if injected == nil {
+		return
+	}
+	for _, env := range injected.Env {
+		if !hasEnv(original.Env, env.Name) {
+			if r.Env == nil {
+				r.Env = map[string][]string{}
+			}
+			r.Env[original.Name] = append(r.Env[original.Name], env.Name)
+		}
+	}
+	for _, mount := range injected.VolumeMounts {
+		if !hasVolumeMount(original.VolumeMounts, mount.Name) {
+			if r.VolumeMounts == nil {
+				r.VolumeMounts = map[string][]string{}
+			}
+			r.VolumeMounts[original.Name] = append(r.VolumeMounts[original.Name], mount.Name)
+		}
+	}
+	if !reflect.DeepEqual(original.Command, injected.Command) {
+		if r.Commands == nil {
+			r.Commands = map[string][]string{}
+		}
+		r.Commands[original.Name] = original.Command
+	}
+}
+
+// removeInjectedResources reverts the changes recorded in a pod template's netmaker.io/netclient-injected-resources
+// annotation; it returns false when the template has no record
+func removeInjectedResources(template *corev1.PodTemplateSpec) (bool, error) {
+	value, ok := template.Annotations[injectedResourcesAnnotation]
+	if !ok {
+		return false, nil
+	}
+	var injected injectedResources
+	if err := json.Unmarshal([]byte(value), &injected); err != nil {
+		return false, &invalidAnnotationsError{problems: []string{
+			fmt.Sprintf("%s is not valid JSON, remove the netclient sidecar by hand: %v", injectedResourcesAnnotation, err),
+		}}
+	}
+
+	spec := &template.Spec
+	spec.Containers = removeContainers(spec.Containers, injected.Containers)
+	spec.InitContainers = removeContainers(spec.InitContainers, injected.InitContainers)
+	var volumes []corev1.Volume
+	for _, volume := range spec.Volumes {
+		if !contains(injected.Volumes, volume.Name) {
+			volumes = append(volumes, volume)
+		}
+	}
+	spec.Volumes = volumes
+
+	for _, containers := range [][]corev1.Container{spec.InitContainers, spec.Containers} {
+		for i := range containers {
+			container := &containers[i]
+			var env []corev1.EnvVar
+			for _, e := range container.Env {
+				if !contains(injected.Env[container.Name], e.Name) {
+					env = append(env, e)
+				}
+			}
+			container.Env = env
+			var mounts []corev1.VolumeMount
+			for _, mount := range container.VolumeMounts {
+				if !contains(injected.VolumeMounts[container.Name], mount.Name) {
+					mounts = append(mounts, mount)
+				}
+			}
+			container.VolumeMounts = mounts
+			if command, ok := injected.Commands[container.Name]; ok {
+				container.Command = command
+			}
+		}
+	}
+
+	var gates []corev1.PodReadinessGate
+	for _, gate := range spec.ReadinessGates {
+		if !contains(injected.ReadinessGates, string(gate.ConditionType)) {
+			gates = append(gates, gate)
+		}
+	}
+	spec.ReadinessGates = gates
+	if injected.DNS != nil {
+		spec.DNSPolicy = injected.DNS.Policy
+		spec.DNSConfig = injected.DNS.Config
+	}
+
+	for _, key := range injected.Annotations {
+		delete(template.Annotations, key)
+	}
+	delete(template.Annotations, injectedResourcesAnnotation)
+	if len(template.Annotations) == 0 {
+		template.Annotations = nil
+	}
+	return true, nil
+}
+
+// uninjectResponse removes the netclient sidecar from a workload that no longer asks for it
+// Only workloads without a controlling owner are changed: the templates of owned ReplicaSets and Jobs
+// follow their Deployment or CronJob, and Job templates are immutable
+func uninjectResponse(req admission.Request, reason string, original interface{}, modified metav1.Object, template *corev1.PodTemplateSpec) admission.Response {
+	if metav1.GetControllerOf(modified) != nil {
+		return admission.Allowed(reason)
+	}
+	removed, err := removeInjectedResources(template)
+	if err != nil {
+		return injectionErrorResponse(err)
+	}
+	if !removed {
+		return admission.Allowed(reason)
+	}
+	annotations := modified.GetAnnotations()
+	delete(annotations, injectedAnnotation)
+	if len(annotations) == 0 {
+		annotations = nil
+	}
+	modified.SetAnnotations(annotations)
+	return patchResponse(removedMessagePrefix+": "+reason, req.Object.Raw, original, modified)
+}
+
+// addedContainers returns the names of the containers in after that aren't in before
+func addedContainers(before, after []corev1.Container) []string {
+	var names []string
+	for _, container := range after {
+		found := false
+		for _, existing := range before {
+			if existing.Name == container.Name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			names = append(names, container.Name)
+		}
+	}
+	return names
+}
+
+// removeContainers returns containers without the ones named in names
+func removeContainers(containers []corev1.Container, names []string) []corev1.Container {
+	var kept []corev1.Container
+	for _, container := range containers {
+		if !contains(names, container.Name) {
+			kept = append(kept, container)
+		}
+	}
+	return kept
+}
+
+// findContainer returns the container or init container called name, nil if there is none
+func findContainer(podSpec *corev1.PodSpec, name string) *corev1.Container {
+	for _, containers := range [][]corev1.Container{podSpec.InitContainers, podSpec.Containers} {
+		for i := range containers {
+			if containers[i].Name == name {
+				return &containers[i]
+			}
+		}
+	}
+	return nil
+}
+
+// hasVolume checks if volumes has one called name
+func hasVolume(volumes []corev1.Volume, name string) bool {
+	for _, volume := range volumes {
+		if volume.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// hasEnv checks if env sets name
+func hasEnv(env []corev1.EnvVar, name string) bool {
+	for _, e := range env {
+		if e.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// hasVolumeMount checks if mounts mount the volume called name
+func hasVolumeMount(mounts []corev1.VolumeMount, name string) bool {
+	for _, mount := range mounts {
+		if mount.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// hasReadinessGate checks if gates include conditionType
+func hasReadinessGate(gates []corev1.PodReadinessGate, conditionType corev1.PodConditionType) bool {
+	for _, gate := range gates {
+		if gate.ConditionType == conditionType {
+			return true
+		}
+	}
+	return false
+}
+
+// contains checks if values holds value
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
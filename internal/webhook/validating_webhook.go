@@ -0,0 +1,277 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/gravitl/netmaker-k8s-ops/internal/controller"
+)
+
+const (
+	// pvcNameAnnotation names the claim a pod keeps its netclient state in; a ".<namespace>" suffix scopes it to one namespace
+	pvcNameAnnotation = "netmaker.io/pvc-name"
+	// secretNameLabel, secretKeyLabel and secretNamespaceLabel select the netclient token secret of a workload
+	secretNameLabel      = "netmaker.io/secret-name"
+	secretKeyLabel       = "netmaker.io/secret-key"
+	secretNamespaceLabel = "netmaker.io/secret-namespace"
+)
+
+// workloadAnnotationKeys are the netmaker.io annotations users may set on workloads and pod templates
+var workloadAnnotationKeys = map[string]bool{
+	netclientImageAnnotation:          true,
+	networkAnnotation:                 true,
+	networksAnnotation:                true,
+	serverAnnotation:                  true,
+	logLevelAnnotation:                true,
+	netclientResourcesAnnotation:      true,
+	netclientReadinessProbeAnnotation: true,
+	netclientStateAnnotation:          true,
+	dnsAnnotation:                     true,
+	dnsNameserverAnnotation:           true,
+	dnsSearchAnnotation:               true,
+	injectionKey:                      true,
+	pvcNameAnnotation:                 true,
+	waitForNetworkAnnotation:          true,
+	waitPeerAnnotation:                true,
+	waitTimeoutAnnotation:             true,
+	staticIPAnnotation:                true,
+}
+
+// managedAnnotationKeys are set by the operator itself on injected pods and the pods it creates
+// The controllers' annotations come from controller.ManagedAnnotations, see init
+var managedAnnotationKeys = map[string]bool{
+	dnsCorefileAnnotation: true,
+}
+
+func init() {
+	for _, key := range controller.ManagedAnnotations {
+		managedAnnotationKeys[key] = true
+	}
+}
+
+// NetmakerAnnotationValidator rejects Services and workloads with invalid netmaker.io annotations
+// Without it, typos and conflicting settings are accepted and only show up in the operator logs
+type NetmakerAnnotationValidator struct {
+	decoder admission.Decoder
+	// operatorUser is the operator's service account user, the only one allowed to record a pod's Netmaker host
+	operatorUser string
+}
+
+// NewNetmakerAnnotationValidator creates a new annotation validator
+func NewNetmakerAnnotationValidator(decoder admission.Decoder) *NetmakerAnnotationValidator {
+	return &NetmakerAnnotationValidator{decoder: decoder}
+}
+
+// SetOperatorUser sets the user name the operator's requests come from, system:serviceaccount:<namespace>:<name>
+func (v *NetmakerAnnotationValidator) SetOperatorUser(username string) {
+	v.operatorUser = username
+}
+
+// workloadMetadata holds the parts of any supported workload the validator looks at
+type workloadMetadata struct {
+	metav1.ObjectMeta `json:"metadata"`
+	Spec              struct {
+		Template    *podTemplateMetadata `json:"template"`
+		JobTemplate *struct {
+			Spec struct {
+				Template *podTemplateMetadata `json:"template"`
+			} `json:"spec"`
+		} `json:"jobTemplate"`
+	} `json:"spec"`
+}
+
+type podTemplateMetadata struct {
+	metav1.ObjectMeta `json:"metadata"`
+}
+
+// Handle validates the netmaker.io annotations of the admitted object
+func (v *NetmakerAnnotationValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	if req.Operation == admissionv1.Delete {
+		return admission.Allowed("")
+	}
+
+	var problems, warnings []string
+	if req.Kind.Kind == "Service" {
+		service := &corev1.Service{}
+		if err := v.decoder.Decode(req, service); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		problems, warnings = controller.ValidateServiceAnnotations(service)
+	} else {
+		workload := &workloadMetadata{}
+		if err := json.Unmarshal(req.Object.Raw, workload); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		problems, warnings = validateWorkloadMetadata(&workload.ObjectMeta)
+		template := workload.Spec.Template
+		if workload.Spec.JobTemplate != nil {
+			template = workload.Spec.JobTemplate.Spec.Template
+		}
+		if template != nil {
+			templateProblems, templateWarnings := validateWorkloadMetadata(&template.ObjectMeta)
+			problems = append(problems, prefixAll("pod template: ", templateProblems)...)
+			warnings = append(warnings, prefixAll("pod template: ", templateWarnings)...)
+		}
+		hostIDProblems, err := v.checkHostIDAnnotation(req, workload)
+		if err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		problems = append(problems, hostIDProblems...)
+	}
+
+	if len(problems) > 0 {
+		klog.Info("Rejecting invalid netmaker.io annotations", "kind", req.Kind.Kind, "name", req.Name, "namespace", req.Namespace, "problems", problems)
+		resp := admission.Denied(fmt.Sprintf("invalid netmaker.io annotations: %s", strings.Join(problems, "; ")))
+		resp.Warnings = warnings
+		return resp
+	}
+	return admission.Allowed("").WithWarnings(warnings...)
+}
+
+// checkHostIDAnnotation only lets the operator record a pod's netmaker.io/netclient-host-id
+// The cleanup and static IP controllers act on the Netmaker host it names, so nobody else may add or change it,
+// and workloads and pod templates, which would copy it to every pod, may not carry it at all
+func (v *NetmakerAnnotationValidator) checkHostIDAnnotation(req admission.Request, workload *workloadMetadata) ([]string, error) {
+	if req.Kind.Kind != "Pod" {
+		var problems []string
+		if _, ok := workload.Annotations[controller.NetclientHostIDAnnotation]; ok {
+			problems = append(problems, fmt.Sprintf("%s is only set on pods, by the operator", controller.NetclientHostIDAnnotation))
+		}
+		template := workload.Spec.Template
+		if workload.Spec.JobTemplate != nil {
+			template = workload.Spec.JobTemplate.Spec.Template
+		}
+		if template != nil {
+			if _, ok := template.Annotations[controller.NetclientHostIDAnnotation]; ok {
+				problems = append(problems, fmt.Sprintf("pod template: %s is only set on pods, by the operator", controller.NetclientHostIDAnnotation))
+			}
+		}
+		return problems, nil
+	}
+
+	hostID := workload.Annotations[controller.NetclientHostIDAnnotation]
+	previous := ""
+	if len(req.OldObject.Raw) > 0 {
+		old := &workloadMetadata{}
+		if err := json.Unmarshal(req.OldObject.Raw, old); err != nil {
+			return nil, err
+		}
+		previous = old.Annotations[controller.NetclientHostIDAnnotation]
+	}
+	// Removing the annotation only makes the operator forget the host
+	if hostID == "" || hostID == previous || (v.operatorUser != "" && req.UserInfo.Username == v.operatorUser) {
+		return nil, nil
+	}
+	return []string{fmt.Sprintf("%s is set by the operator", controller.NetclientHostIDAnnotation)}, nil
+}
+
+// validateWorkloadMetadata checks the netmaker.io labels and annotations of a workload or pod template
+func validateWorkloadMetadata(meta *metav1.ObjectMeta) (problems []string, warnings []string) {
+	annotations := meta.Annotations
+
+	keys := make([]string, 0, len(annotations))
+	for key := range annotations {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		switch {
+		case !strings.HasPrefix(key, "netmaker.io/"), workloadAnnotationKeys[key], managedAnnotationKeys[key]:
+		case strings.HasPrefix(key, pvcNameAnnotation+"."):
+			problems = append(problems, validateDNSName(key, annotations[key])...)
+		case key == secretNameLabel || key == secretKeyLabel || key == secretNamespaceLabel:
+			problems = append(problems, fmt.Sprintf("%s is read from labels, not annotations", key))
+		default:
+			problems = append(problems, fmt.Sprintf("unknown annotation %s", key))
+		}
+	}
+
+	if value, ok := meta.Labels[netclientLabel]; ok && value != "enabled" && value != "disabled" && value != "node" {
+		problems = append(problems, fmt.Sprintf("label %s %q must be enabled, disabled or node", netclientLabel, value))
+	}
+	if value, ok := annotations[injectionKey]; ok && value != "disabled" {
+		problems = append(problems, fmt.Sprintf("%s %q must be disabled; enable injection with the %s label", injectionKey, value, netclientLabel))
+	}
+	if annotations[injectionKey] == "disabled" && meta.Labels[netclientLabel] == "enabled" {
+		problems = append(problems, fmt.Sprintf("%s is disabled but the %s label enables injection", injectionKey, netclientLabel))
+	}
+
+	overrides, err := parseNetclientOverrides(annotations)
+	if err != nil {
+		if invalid, ok := err.(*invalidAnnotationsError); ok {
+			problems = append(problems, invalid.problems...)
+		} else {
+			problems = append(problems, err.Error())
+		}
+	} else {
+		if overrides.DNSMode == "" {
+			for _, key := range []string{dnsNameserverAnnotation, dnsSearchAnnotation} {
+				if _, ok := annotations[key]; ok {
+					warnings = append(warnings, fmt.Sprintf("%s has no effect without %s", key, dnsAnnotation))
+				}
+			}
+		}
+		if len(overrides.Networks) > 0 {
+			for _, key := range []string{secretNameLabel, secretKeyLabel, secretNamespaceLabel} {
+				if _, ok := meta.Labels[key]; ok {
+					warnings = append(warnings, fmt.Sprintf("label %s is ignored, %s names the token secret of every network", key, networksAnnotation))
+				}
+			}
+		}
+		if !overrides.WaitForNetwork {
+			for _, key := range []string{waitPeerAnnotation, waitTimeoutAnnotation} {
+				if _, ok := annotations[key]; ok {
+					warnings = append(warnings, fmt.Sprintf("%s has no effect without %s: \"true\"", key, waitForNetworkAnnotation))
+				}
+			}
+		}
+	}
+
+	if value, ok := annotations[pvcNameAnnotation]; ok {
+		problems = append(problems, validateDNSName(pvcNameAnnotation, value)...)
+		if annotations[netclientStateAnnotation] == netclientStateEphemeral {
+			problems = append(problems, fmt.Sprintf("%s conflicts with %s: %s", pvcNameAnnotation, netclientStateAnnotation, netclientStateEphemeral))
+		}
+	}
+	for _, key := range []string{secretNameLabel, secretNamespaceLabel} {
+		if value, ok := meta.Labels[key]; ok {
+			problems = append(problems, validateDNSName("label "+key, value)...)
+		}
+	}
+	if value, ok := meta.Labels[secretKeyLabel]; ok {
+		for _, msg := range validation.IsConfigMapKey(value) {
+			problems = append(problems, fmt.Sprintf("label %s %q: %s", secretKeyLabel, value, msg))
+		}
+	}
+
+	return problems, warnings
+}
+
+// validateDNSName checks that a label or annotation holds a valid object name
+func validateDNSName(key, value string) []string {
+	var problems []string
+	for _, msg := range validation.IsDNS1123Subdomain(value) {
+		problems = append(problems, fmt.Sprintf("%s %q: %s", key, value, msg))
+	}
+	return problems
+}
+
+// prefixAll prefixes every message
+func prefixAll(prefix string, messages []string) []string {
+	prefixed := make([]string, 0, len(messages))
+	for _, message := range messages {
+		prefixed = append(prefixed, prefix+message)
+	}
+	return prefixed
+}
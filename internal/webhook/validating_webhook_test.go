@@ -0,0 +1,254 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/gravitl/netmaker-k8s-ops/internal/controller"
+)
+
+var _ = Describe("NetmakerAnnotationValidator", func() {
+	validator := NewNetmakerAnnotationValidator(admission.NewDecoder(scheme.Scheme))
+
+	newService := func(annotations map[string]string) *corev1.Service {
+		return &corev1.Service{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Service"},
+			ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: testNamespace, Annotations: annotations},
+			Spec: corev1.ServiceSpec{
+				Ports: []corev1.ServicePort{{Name: "http", Port: 80}},
+			},
+		}
+	}
+
+	DescribeTable("rejects invalid Service annotations",
+		func(annotations map[string]string, message string) {
+			resp := validator.Handle(context.Background(), newAdmissionRequest("Service", newService(annotations)))
+
+			Expect(resp.Allowed).To(BeFalse())
+			Expect(resp.Result.Message).To(ContainSubstring(message))
+		},
+		Entry("typo in the egress value", map[string]string{
+			"netmaker.io/egress": "enable", "netmaker.io/egress-target-ip": "10.0.0.1",
+		}, `"enable" must be enabled or disabled`),
+		Entry("both egress targets", map[string]string{
+			"netmaker.io/egress": "enabled", "netmaker.io/egress-target-ip": "10.0.0.1", "netmaker.io/egress-target-dns": "db.netmaker",
+		}, "set only one of"),
+		Entry("egress without a target", map[string]string{
+			"netmaker.io/egress": "enabled",
+		}, "neither"),
+		Entry("egress and ingress together", map[string]string{
+			"netmaker.io/egress": "enabled", "netmaker.io/egress-target-ip": "10.0.0.1", "netmaker.io/ingress": "enabled",
+		}, "can't both be enabled"),
+		Entry("malformed target IP", map[string]string{
+			"netmaker.io/egress": "enabled", "netmaker.io/egress-target-ip": "10.0.0.300",
+		}, "is not an IP address"),
+		Entry("malformed host name", map[string]string{
+			"netmaker.io/ingress": "enabled", "netmaker.io/ingress-dns-name": "api_server",
+		}, "netmaker.io/ingress-dns-name"),
+		Entry("malformed listen ports", map[string]string{
+			"netmaker.io/ingress": "enabled", "netmaker.io/ingress-listen-ports": "http:99999",
+		}, "netmaker.io/ingress-listen-ports"),
+		Entry("unknown PROXY protocol version", map[string]string{
+			"netmaker.io/ingress": "enabled", "netmaker.io/proxy-protocol": "v3",
+		}, "netmaker.io/proxy-protocol"),
+		Entry("several static IPs", map[string]string{
+			"netmaker.io/ingress": "enabled", "netmaker.io/static-ip": "10.101.0.10,10.101.0.11",
+		}, "takes one address"),
+		Entry("unknown key", map[string]string{
+			"netmaker.io/ingres": "enabled",
+		}, "unknown Service annotation netmaker.io/ingres"),
+	)
+
+	It("accepts valid Services and warns about deprecated annotations", func() {
+		service := newService(map[string]string{
+			"netmaker.io/egress":             "enabled",
+			"netmaker.io/egress-target-dns":  "db.netmaker",
+			"netmaker.io/egress-target-port": "5432",
+			"netmaker.io/proxy-protocol":     "v2",
+		})
+
+		resp := validator.Handle(context.Background(), newAdmissionRequest("Service", service))
+
+		Expect(resp.Allowed).To(BeTrue())
+		Expect(resp.Warnings).To(ConsistOf(ContainSubstring("netmaker.io/egress-target-port is deprecated")))
+	})
+
+	It("ignores annotations outside netmaker.io", func() {
+		service := newService(map[string]string{"example.com/egress": "whatever"})
+
+		resp := validator.Handle(context.Background(), newAdmissionRequest("Service", service))
+		Expect(resp.Allowed).To(BeTrue())
+	})
+
+	It("validates pod template annotations of workloads", func() {
+		template := testPodTemplate()
+		template.Annotations = map[string]string{
+			"netmaker.io/netclient-imag": "gravitl/netclient:v1.5.0",
+			logLevelAnnotation:           "loud",
+		}
+		deployment := &appsv1.Deployment{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"},
+			ObjectMeta: testObjectMeta(),
+			Spec:       appsv1.DeploymentSpec{Template: template},
+		}
+
+		resp := validator.Handle(context.Background(), newAdmissionRequest("Deployment", deployment))
+
+		Expect(resp.Allowed).To(BeFalse())
+		Expect(resp.Result.Message).To(ContainSubstring("pod template: unknown annotation netmaker.io/netclient-imag"))
+		Expect(resp.Result.Message).To(ContainSubstring(logLevelAnnotation))
+	})
+
+	It("rejects conflicting modes on CronJob pod templates", func() {
+		template := testPodTemplate()
+		template.Labels[netclientLabel] = "enable"
+		template.Annotations = map[string]string{
+			pvcNameAnnotation:        "netclient-state",
+			netclientStateAnnotation: netclientStateEphemeral,
+		}
+		cronJob := &batchv1.CronJob{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "batch/v1", Kind: "CronJob"},
+			ObjectMeta: testObjectMeta(),
+			Spec: batchv1.CronJobSpec{
+				Schedule:    "*/5 * * * *",
+				JobTemplate: batchv1.JobTemplateSpec{Spec: batchv1.JobSpec{Template: template}},
+			},
+		}
+
+		resp := validator.Handle(context.Background(), newAdmissionRequest("CronJob", cronJob))
+
+		Expect(resp.Allowed).To(BeFalse())
+		Expect(resp.Result.Message).To(ContainSubstring("conflicts with"))
+		Expect(resp.Result.Message).To(ContainSubstring(`label netmaker.io/netclient "enable"`))
+	})
+
+	It("accepts annotations the operator sets on injected pods", func() {
+		pod := &corev1.Pod{
+			TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "demo",
+				Namespace: testNamespace,
+				Labels:    map[string]string{netclientLabel: "enabled", secretNameLabel: "netclient-token"},
+				Annotations: map[string]string{
+					pvcNameAnnotation:      "netclient-state",
+					netclientPVCAnnotation: "netclient-state",
+					tokenSourceAnnotation:  "env",
+					dnsCorefileAnnotation:  ". {\n}\n",
+				},
+			},
+			Spec: testPodTemplate().Spec,
+		}
+
+		resp := validator.Handle(context.Background(), newAdmissionRequest("Pod", pod))
+		Expect(resp.Allowed).To(BeTrue())
+	})
+
+	It("accepts every annotation the controllers stamp", func() {
+		annotations := map[string]string{}
+		for _, key := range controller.ManagedAnnotations {
+			annotations[key] = "value"
+		}
+		problems, _ := validateWorkloadMetadata(&metav1.ObjectMeta{Annotations: annotations})
+		Expect(problems).To(BeEmpty())
+	})
+
+	Context("with the host ID annotation", func() {
+		const operatorUser = "system:serviceaccount:netmaker-k8s-ops-system:netmaker-k8s-ops-controller-manager"
+		validator := NewNetmakerAnnotationValidator(admission.NewDecoder(scheme.Scheme))
+		validator.SetOperatorUser(operatorUser)
+
+		podWithHostID := func(hostID string) *corev1.Pod {
+			pod := &corev1.Pod{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+				ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: testNamespace, Annotations: map[string]string{}},
+				Spec:       testPodTemplate().Spec,
+			}
+			if hostID != "" {
+				pod.Annotations[controller.NetclientHostIDAnnotation] = hostID
+			}
+			return pod
+		}
+		update := func(user, oldHostID, hostID string) admission.Response {
+			req := newAdmissionRequest("Pod", podWithHostID(hostID))
+			req.Operation = admissionv1.Update
+			req.UserInfo.Username = user
+			raw, err := json.Marshal(podWithHostID(oldHostID))
+			Expect(err).NotTo(HaveOccurred())
+			req.OldObject.Raw = raw
+			return validator.Handle(context.Background(), req)
+		}
+
+		DescribeTable("on pod updates",
+			func(user, oldHostID, hostID string, allowed bool) {
+				resp := update(user, oldHostID, hostID)
+				Expect(resp.Allowed).To(Equal(allowed))
+				if !allowed {
+					Expect(resp.Result.Message).To(ContainSubstring(controller.NetclientHostIDAnnotation))
+				}
+			},
+			Entry("lets the operator record it", operatorUser, "", "3f0c2a", true),
+			Entry("lets the operator replace it", operatorUser, "3f0c2a", "9b1d44", true),
+			Entry("keeps an unchanged value", "alice", "3f0c2a", "3f0c2a", true),
+			Entry("lets users remove it", "alice", "3f0c2a", "", true),
+			Entry("rejects users adding it", "alice", "", "3f0c2a", false),
+			Entry("rejects users changing it", "alice", "3f0c2a", "9b1d44", false),
+		)
+
+		It("rejects pods created with it", func() {
+			req := newAdmissionRequest("Pod", podWithHostID("3f0c2a"))
+			req.UserInfo.Username = "alice"
+
+			Expect(validator.Handle(context.Background(), req).Allowed).To(BeFalse())
+		})
+
+		It("rejects pod templates carrying it", func() {
+			template := testPodTemplate()
+			template.Annotations = map[string]string{controller.NetclientHostIDAnnotation: "3f0c2a"}
+			deployment := &appsv1.Deployment{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"},
+				ObjectMeta: testObjectMeta(),
+				Spec:       appsv1.DeploymentSpec{Template: template},
+			}
+			req := newAdmissionRequest("Deployment", deployment)
+			req.UserInfo.Username = operatorUser
+
+			resp := validator.Handle(context.Background(), req)
+			Expect(resp.Allowed).To(BeFalse())
+			Expect(resp.Result.Message).To(ContainSubstring("pod template: " + controller.NetclientHostIDAnnotation))
+		})
+	})
+
+	It("allows deletes", func() {
+		req := newAdmissionRequest("Service", newService(map[string]string{"netmaker.io/egress": "enable"}))
+		req.Operation = admissionv1.Delete
+
+		Expect(validator.Handle(context.Background(), req).Allowed).To(BeTrue())
+	})
+})
@@ -0,0 +1,96 @@
+package webhook
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// waitForNetworkAnnotation holds app containers until the netmaker interface is up ("true" or "false")
+	waitForNetworkAnnotation = "netmaker.io/wait-for-network"
+	// waitPeerAnnotation is an optional Netmaker peer (IP or host name) that must answer ping before apps start
+	waitPeerAnnotation = "netmaker.io/wait-peer"
+	// waitTimeoutAnnotation is how long to wait for the interface and peer, as a duration like "2m"
+	waitTimeoutAnnotation = "netmaker.io/wait-timeout"
+
+	defaultWaitTimeout = 2 * time.Minute
+	// maxWaitTimeout stays short because a running postStart hook holds kubelet's sync of the whole pod
+	maxWaitTimeout = 5 * time.Minute
+	// waitProbePeriod is the startup probe period used with native sidecars
+	waitProbePeriod = 2
+)
+
+// applyWaitForNetwork makes app containers wait until netclient has joined the network
+// With native sidecars the netclient startup probe already blocks the app containers, so it only gains the
+// peer check and the timeout. Regular containers are started in order and each postStart hook has to finish
+// before the next container starts, so netclient gets a postStart hook that waits and the caller puts it first.
+// Either way a timeout fails netclient with a message naming what wasn't ready, visible in the pod events.
+// A failed postStart hook doesn't stop kubelet from starting the remaining containers, so without native
+// sidecars the wait only delays the app containers by up to the timeout; it can't keep them from starting.
+func applyWaitForNetwork(netclient *corev1.Container, native bool, overrides *netclientOverrides) {
+	timeout := overrides.WaitTimeout
+	if timeout == 0 {
+		timeout = defaultWaitTimeout
+	}
+
+	if native {
+		netclient.StartupProbe = &corev1.Probe{
+			ProbeHandler: corev1.ProbeHandler{
+				Exec: &corev1.ExecAction{
+					Command: []string{"/bin/sh", "-c", buildNetworkCheckScript(overrides.WaitPeer)},
+				},
+			},
+			PeriodSeconds:    waitProbePeriod,
+			TimeoutSeconds:   3,
+			FailureThreshold: int32((timeout.Seconds() + waitProbePeriod - 1) / waitProbePeriod),
+		}
+		return
+	}
+
+	netclient.Lifecycle = &corev1.Lifecycle{
+		PostStart: &corev1.LifecycleHandler{
+			Exec: &corev1.ExecAction{
+				Command: []string{"/bin/sh", "-c", buildNetworkWaitScript(overrides.WaitPeer, timeout)},
+			},
+		},
+	}
+}
+
+// buildNetworkCheckScript checks once that the netmaker interface has an address and the peer answers
+func buildNetworkCheckScript(peer string) string {
+	var b strings.Builder
+	b.WriteString(`ip addr show netmaker 2>/dev/null | grep -q inet || { echo "netmaker interface has no address yet"; exit 1; }` + "\n")
+	if peer != "" {
+		fmt.Fprintf(&b, `ping -c 1 -W 1 %s >/dev/null 2>&1 || { echo "Netmaker peer %s is not reachable yet"; exit 1; }`+"\n", peer, peer)
+	}
+	return b.String()
+}
+
+// buildNetworkWaitScript waits until the netmaker interface has an address and the peer answers, or fails after timeout
+func buildNetworkWaitScript(peer string, timeout time.Duration) string {
+	seconds := int(timeout.Seconds())
+	var b strings.Builder
+	fmt.Fprintf(&b, "deadline=$(( $(date +%%s) + %d ))\n", seconds)
+	fmt.Fprintf(&b, `until ip addr show netmaker 2>/dev/null | grep -q inet; do
+  if [ "$(date +%%s)" -ge "$deadline" ]; then
+    echo "netmaker interface has no address after %ds" >&2
+    exit 1
+  fi
+  sleep 1
+done
+`, seconds)
+	if peer != "" {
+		fmt.Fprintf(&b, `until ping -c 1 -W 1 %s >/dev/null 2>&1; do
+  if [ "$(date +%%s)" -ge "$deadline" ]; then
+    echo "Netmaker peer %s is not reachable after %ds" >&2
+    exit 1
+  fi
+  sleep 1
+done
+`, peer, peer, seconds)
+	}
+	return b.String()
+}